@@ -0,0 +1,166 @@
+package appstore
+
+import (
+	"encoding/binary"
+	"log"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tendermint/tendermint/libs/db"
+)
+
+const analyzeProgressInterval = 1000000
+
+type KeySpaceStats struct {
+	NumKeys    uint64 `json:"numKeys"`
+	KeyBytes   uint64 `json:"keyBytes"`
+	ValueBytes uint64 `json:"valueBytes"`
+}
+
+func (s *KeySpaceStats) TotalBytes() uint64 {
+	return s.KeyBytes + s.ValueBytes
+}
+
+func (s *KeySpaceStats) add(key, value []byte) {
+	s.NumKeys++
+	s.KeyBytes += uint64(len(key))
+	s.ValueBytes += uint64(len(value))
+}
+
+// VersionRange is an inclusive range of consecutive IAVL tree versions.
+type VersionRange struct {
+	From int64 `json:"from"`
+	To   int64 `json:"to"`
+}
+
+// IAVLStorageStats breaks down the raw LevelDB key space of an IAVL store by the kind of data
+// stored in it. Byte totals are the uncompressed sizes of the keys & values, LevelDB compression
+// means the DB will usually take up less space on disk.
+type IAVLStorageStats struct {
+	Nodes   KeySpaceStats
+	Orphans KeySpaceStats
+	Roots   KeySpaceStats
+	Other   KeySpaceStats
+
+	NumVersions   uint64
+	Versions      []VersionRange
+	LatestVersion int64
+
+	// Set if the nodes reachable from the latest root were counted, these are the only nodes a
+	// clone of the latest version would contain.
+	CloneEstimated bool
+	LatestNodes    KeySpaceStats
+	LatestLeaves   uint64
+
+	TimeTaken time.Duration
+}
+
+func (s *IAVLStorageStats) TotalBytes() uint64 {
+	return s.Nodes.TotalBytes() + s.Orphans.TotalBytes() + s.Roots.TotalBytes() + s.Other.TotalBytes()
+}
+
+// CloneBytes returns the number of bytes a clone of the latest version would contain.
+func (s *IAVLStorageStats) CloneBytes() uint64 {
+	return s.LatestNodes.TotalBytes() + uint64(len(iavlRootKey(s.LatestVersion))) + uint64(hashSize)
+}
+
+// ReclaimableBytes returns an estimate of the number of bytes that would be freed up by replacing
+// the DB with a clone of the latest version.
+func (s *IAVLStorageStats) ReclaimableBytes() uint64 {
+	if !s.CloneEstimated || s.CloneBytes() > s.TotalBytes() {
+		return 0
+	}
+	return s.TotalBytes() - s.CloneBytes()
+}
+
+// AnalyzeIAVLStorage scans all the raw keys in an IAVL store DB and reports how much space is used
+// by nodes, orphans, roots and anything else. If estimateClone is true the nodes reachable from the
+// root of the latest version are walked to estimate how much space a clone would reclaim.
+func AnalyzeIAVLStorage(dbPath string, estimateClone bool, logLevel uint64) (*IAVLStorageStats, error) {
+	appDb, err := openReadOnlyDB(dbPath)
+	if err != nil {
+		return nil, err
+	}
+	defer appDb.Close()
+
+	startTime := time.Now()
+	stats := &IAVLStorageStats{}
+	numKeys := uint64(0)
+	it := appDb.Iterator(nil, nil)
+	for ; it.Valid(); it.Next() {
+		key := it.Key()
+		value := it.Value()
+		switch {
+		case len(key) == 1+hashSize && key[0] == iavlNodePrefix:
+			stats.Nodes.add(key, value)
+		case len(key) == 1+8+8+hashSize && key[0] == iavlOrphanPrefix:
+			stats.Orphans.add(key, value)
+		case len(key) == 1+8 && key[0] == iavlRootPrefix:
+			stats.Roots.add(key, value)
+			stats.addVersion(int64(binary.BigEndian.Uint64(key[1:])))
+		default:
+			stats.Other.add(key, value)
+		}
+
+		numKeys++
+		if logLevel > 0 && numKeys%analyzeProgressInterval == 0 {
+			log.Printf("%v keys scanned in %v, current key %X", numKeys, time.Since(startTime), key)
+		}
+	}
+	it.Close()
+
+	if estimateClone && stats.NumVersions > 0 {
+		rootHash := appDb.Get(iavlRootKey(stats.LatestVersion))
+		if err := countReachableNodes(appDb, rootHash, stats, logLevel); err != nil {
+			return nil, errors.Wrapf(err, "failed to walk IAVL tree version %v", stats.LatestVersion)
+		}
+		stats.CloneEstimated = true
+	}
+	stats.TimeTaken = time.Since(startTime)
+	return stats, nil
+}
+
+// addVersion must be called with versions in ascending order.
+func (s *IAVLStorageStats) addVersion(version int64) {
+	s.NumVersions++
+	s.LatestVersion = version
+	if n := len(s.Versions); n > 0 && s.Versions[n-1].To+1 == version {
+		s.Versions[n-1].To = version
+		return
+	}
+	s.Versions = append(s.Versions, VersionRange{From: version, To: version})
+}
+
+// countReachableNodes walks the tree from the given root and adds up the nodes it reaches.
+func countReachableNodes(appDb db.DB, rootHash []byte, stats *IAVLStorageStats, logLevel uint64) error {
+	if len(rootHash) == 0 {
+		return nil
+	}
+	startTime := time.Now()
+	pending := [][]byte{rootHash}
+	for len(pending) > 0 {
+		hash := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+
+		key := iavlNodeKey(hash)
+		buf := appDb.Get(key)
+		if buf == nil {
+			return errors.Errorf("node %X not found", hash)
+		}
+		node, err := decodeIAVLNode(buf)
+		if err != nil {
+			return errors.Wrapf(err, "failed to decode node %X", hash)
+		}
+		stats.LatestNodes.add(key, buf)
+		if node.isLeaf() {
+			stats.LatestLeaves++
+		} else {
+			pending = append(pending, node.rightHash, node.leftHash)
+		}
+
+		if logLevel > 0 && stats.LatestNodes.NumKeys%analyzeProgressInterval == 0 {
+			log.Printf("%v nodes of the latest version walked in %v", stats.LatestNodes.NumKeys, time.Since(startTime))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package appstore
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tendermint/iavl"
+	"github.com/tendermint/tendermint/libs/db"
+)
+
+func TestAnalyzeIAVLStorage(t *testing.T) {
+	for _, dir := range []string{"./tempAnalyze.db", "./tempAnalyzeClone.db"} {
+		_ = os.RemoveAll(dir)
+		defer os.RemoveAll(dir)
+	}
+
+	tempDB, err := db.NewGoLevelDB("tempAnalyze", ".")
+	require.NoError(t, err)
+	tree := iavl.NewMutableTree(tempDB, 0)
+	_, err = tree.Load()
+	require.NoError(t, err)
+	for version := 1; version <= 5; version++ {
+		for i := 0; i < 50; i++ {
+			tree.Set([]byte(fmt.Sprintf("key%d", i)), []byte(fmt.Sprintf("value%d-%d", i, version)))
+		}
+		_, _, err = tree.SaveVersion()
+		require.NoError(t, err)
+	}
+	require.NoError(t, tree.DeleteVersion(2))
+	tempDB.Close()
+
+	stats, err := AnalyzeIAVLStorage("./tempAnalyze.db", true, 0)
+	require.NoError(t, err)
+	require.Equal(t, uint64(4), stats.NumVersions)
+	require.Equal(t, []VersionRange{{From: 1, To: 1}, {From: 3, To: 5}}, stats.Versions)
+	require.Equal(t, int64(5), stats.LatestVersion)
+	require.Equal(t, uint64(4), stats.Roots.NumKeys)
+	require.True(t, stats.Orphans.NumKeys > 0)
+	require.True(t, stats.CloneEstimated)
+	require.Equal(t, uint64(50), stats.LatestLeaves)
+	require.Equal(t, uint64(99), stats.LatestNodes.NumKeys)
+	require.True(t, stats.ReclaimableBytes() > 0)
+
+	require.NoError(t, CloneIAVLTreeFromDB("./tempAnalyze.db", "", "./tempAnalyzeClone.db", 0, 0, 0, false, false))
+	cloneStats, err := AnalyzeIAVLStorage("./tempAnalyzeClone.db", true, 0)
+	require.NoError(t, err)
+	require.Equal(t, stats.LatestNodes, cloneStats.Nodes)
+	require.Equal(t, uint64(0), cloneStats.Orphans.NumKeys)
+	require.Equal(t, stats.CloneBytes(), cloneStats.TotalBytes())
+	require.Equal(t, uint64(0), cloneStats.ReclaimableBytes())
+}
@@ -1,6 +1,7 @@
 package appstore
 
 import (
+	"bytes"
 	"fmt"
 	"log"
 	"math"
@@ -16,8 +17,13 @@ import (
 
 // CloneIAVLTreeFromDB copies the IAVL tree matching the specified height to a new DB.
 // The srcValueDBPath parameter may be empty, otherwise it should be the path to app_state.db.
+// When srcValueDBPath is empty a checkpoint is stored in the destination DB with every intermediate
+// commit, if resume is true and the destination DB contains a checkpoint the clone continues from it.
+// Once the tree has been cloned its root hash is compared to the source tree, if verifyKeys is true
+// the keys & values of both trees are compared too.
 func CloneIAVLTreeFromDB(
 	srcDBPath, srcValueDBPath, destDBPath string, height int64, logLevel, savesPerCommit uint64,
+	resume, verifyKeys bool,
 ) error {
 	dbName := strings.TrimSuffix(path.Base(srcDBPath), ".db")
 	dbDir := path.Dir(srcDBPath)
@@ -41,26 +47,33 @@ func CloneIAVLTreeFromDB(
 		if _, err := tree.LoadVersion(height); err != nil {
 			return errors.Wrapf(err, "failed to load IAVL tree version %v", height)
 		}
-	} else {
-		dbName := strings.TrimSuffix(path.Base(srcValueDBPath), ".db")
-		dbDir := path.Dir(srcValueDBPath)
-		valueDB, err := db.NewGoLevelDB(dbName, dbDir)
-		if err != nil {
-			return errors.Wrapf(err, "failed to open %v", srcValueDBPath)
+		if err := cloneIAVLTreeWithCheckpoints(appDb, newAppDb, tree, logLevel, savesPerCommit, resume); err != nil {
+			return err
 		}
-		defer valueDB.Close()
+		return verifyClonedIAVLTree(tree, newAppDb, verifyKeys)
+	}
 
-		appNodeDB := iavl.NewNodeDB(appDb, 10000, valueDB.Get)
-		tree = iavl.NewMutableTreeWithNodeDB(appNodeDB)
-		lastVer, err := tree.LoadVersion(height)
-		if err != nil {
-			return errors.Wrapf(err, "failed to load IAVL tree version %v", height)
-		}
-		// If app_state.db is being used we can't load any arbitrary height, the app_state.db only
-		// has data for the latest height
-		if (height > 0) && (lastVer != height) {
-			return fmt.Errorf("height %d doesn't match latest IAVL tree version %d", height, lastVer)
-		}
+	if resume {
+		return errors.New("resuming a clone is not supported when app_state.db is used")
+	}
+	dbName = strings.TrimSuffix(path.Base(srcValueDBPath), ".db")
+	dbDir = path.Dir(srcValueDBPath)
+	valueDB, err := db.NewGoLevelDB(dbName, dbDir)
+	if err != nil {
+		return errors.Wrapf(err, "failed to open %v", srcValueDBPath)
+	}
+	defer valueDB.Close()
+
+	appNodeDB := iavl.NewNodeDB(appDb, 10000, valueDB.Get)
+	tree = iavl.NewMutableTreeWithNodeDB(appNodeDB)
+	lastVer, err := tree.LoadVersion(height)
+	if err != nil {
+		return errors.Wrapf(err, "failed to load IAVL tree version %v", height)
+	}
+	// If app_state.db is being used we can't load any arbitrary height, the app_state.db only
+	// has data for the latest height
+	if (height > 0) && (lastVer != height) {
+		return fmt.Errorf("height %d doesn't match latest IAVL tree version %d", height, lastVer)
 	}
 
 	newNdb := iavl.NewNodeDB(newAppDb, 10000, nil)
@@ -70,48 +83,15 @@ func CloneIAVLTreeFromDB(
 			return errors.Wrapf(err, "failed to save version %v to db", height)
 		}
 	} else {
-		leafCount := uint64(0)
-		leaves := uint(tree.Size())
-		debugPeriod := uint64(leaves / uint(math.Pow(10, float64(logLevel))))
-		if debugPeriod == 0 {
-			debugPeriod = 10
-		}
 		log.Printf("IAVL tree height %v with %v keys", tree.Height(), tree.Size())
 		startTime := time.Now()
-		lastVisted := time.Now()
 		// TODO: don't think this works correclty if version isn't latest, and even then
 		//       SaveVersionToDBDebug() needs a bit of cleanup
 		if _, _, err := tree.SaveVersionToDB(
 			height,
 			newNdb,
 			savesPerCommit,
-			func(height int8) bool {
-				if height != 0 {
-					return false
-				}
-				leafCount++
-				if leafCount%debugPeriod != 0 {
-					return false
-				}
-				now := time.Now()
-				elapsed := now.Sub(startTime).Seconds()
-				fractionDone := float64(leafCount) / float64(leaves)
-				expected := elapsed / fractionDone
-
-				var memStats runtime.MemStats
-				runtime.ReadMemStats(&memStats)
-				log.Printf(
-					"%v leaf nodes loaded %v%% of total. Time taken so far %v seconds %v seconds since last log. Expected to complete in %v seconds. Memroy used %vMb.",
-					leafCount,
-					uint(fractionDone*100),
-					elapsed,
-					now.Sub(lastVisted).Seconds(),
-					expected-elapsed,
-					memStats.Alloc/1000000,
-				)
-				lastVisted = now
-				return false
-			},
+			newCloneProgressFn(uint64(tree.Size()), 0, logLevel),
 		); err != nil {
 			return errors.Wrapf(err, "failed to save IAVL tree version %v", height)
 		}
@@ -120,5 +100,119 @@ func CloneIAVLTreeFromDB(
 		log.Printf("Finished reeading in database, time taken %v seconds", elapsed)
 	}
 
+	return verifyClonedIAVLTree(tree, newAppDb, verifyKeys)
+}
+
+// verifyClonedIAVLTree loads the cloned tree from the destination DB and checks that it matches the
+// source tree, returning an error if it doesn't.
+func verifyClonedIAVLTree(srcTree *iavl.MutableTree, destDB db.DB, verifyKeys bool) error {
+	destTree := iavl.NewMutableTree(destDB, 0)
+	if _, err := destTree.LoadVersion(srcTree.Version()); err != nil {
+		return errors.Wrapf(err, "failed to load cloned IAVL tree version %v", srcTree.Version())
+	}
+	result := verifyIAVLTrees(srcTree.ImmutableTree, destTree.ImmutableTree, verifyKeys)
+	if err := result.Err(); err != nil {
+		return errors.Wrap(err, "cloned IAVL tree doesn't match the source")
+	}
+	if verifyKeys {
+		log.Printf("Verified root hash %X and %v keys of IAVL tree version %v", result.DestRootHash, result.NumKeys, result.Version)
+	} else {
+		log.Printf("Verified root hash %X of IAVL tree version %v", result.DestRootHash, result.Version)
+	}
 	return nil
 }
+
+// cloneIAVLTreeWithCheckpoints copies the raw nodes of the loaded tree version to the destination
+// DB, committing a checkpoint with every intermediate commit so the clone can be resumed.
+func cloneIAVLTreeWithCheckpoints(
+	srcDB, destDB db.DB, tree *iavl.MutableTree, logLevel, savesPerCommit uint64, resume bool,
+) error {
+	version := tree.Version()
+	rootKey := iavlRootKey(version)
+	if !srcDB.Has(rootKey) {
+		return fmt.Errorf("root of IAVL tree version %d not found", version)
+	}
+	rootHash := srcDB.Get(rootKey)
+
+	var cp *cloneCheckpoint
+	if resume {
+		var err error
+		cp, err = loadCloneCheckpoint(destDB)
+		if err != nil {
+			return err
+		}
+		if cp == nil {
+			return errors.New("no clone checkpoint found in destination DB")
+		}
+		if cp.Version != version || !bytes.Equal(cp.RootHash, rootHash) {
+			return fmt.Errorf(
+				"clone checkpoint is for IAVL tree version %d with root %X, source tree version %d has root %X",
+				cp.Version, cp.RootHash, version, rootHash,
+			)
+		}
+		log.Printf(
+			"Resuming clone of IAVL tree version %v after %v nodes (%v leaves, %v bytes), last key copied %X",
+			cp.Version, cp.NumNodes, cp.NumLeaves, cp.NumBytes, cp.LastKey,
+		)
+	} else {
+		cp = newCloneCheckpoint(version, rootHash)
+		batch := destDB.NewBatch()
+		if err := cp.save(batch); err != nil {
+			return err
+		}
+		batch.WriteSync()
+	}
+
+	var debugFn func(int8) bool
+	if logLevel > 0 {
+		log.Printf("IAVL tree height %v with %v keys", tree.Height(), tree.Size())
+		debugFn = newCloneProgressFn(uint64(tree.Size()), cp.NumLeaves, logLevel)
+	}
+	startTime := time.Now()
+	if err := copyIAVLVersion(srcDB, destDB, cp, savesPerCommit, debugFn); err != nil {
+		return errors.Wrapf(err, "failed to save IAVL tree version %v", version)
+	}
+	log.Printf(
+		"Finished cloning IAVL tree version %v, %v nodes (%v leaves, %v bytes) copied, time taken %v",
+		version, cp.NumNodes, cp.NumLeaves, cp.NumBytes, time.Since(startTime),
+	)
+	return nil
+}
+
+// newCloneProgressFn returns a function that logs progress every (100*10^-logLevel)% of leaves.
+func newCloneProgressFn(leaves, leafCount, logLevel uint64) func(height int8) bool {
+	debugPeriod := leaves / uint64(math.Pow(10, float64(logLevel)))
+	if debugPeriod == 0 {
+		debugPeriod = 10
+	}
+	startCount := leafCount
+	startTime := time.Now()
+	lastVisted := time.Now()
+	return func(height int8) bool {
+		if height != 0 {
+			return false
+		}
+		leafCount++
+		if leafCount%debugPeriod != 0 {
+			return false
+		}
+		now := time.Now()
+		elapsed := now.Sub(startTime).Seconds()
+		fractionDone := float64(leafCount) / float64(leaves)
+		expected := elapsed / (float64(leafCount-startCount) / float64(leaves-startCount))
+
+		var memStats runtime.MemStats
+		runtime.ReadMemStats(&memStats)
+		log.Printf(
+			"%v leaf nodes loaded %v%% of total. Time taken so far %v seconds %v seconds since last log. Expected to complete in %v seconds. Memroy used %vMb.",
+			leafCount,
+			uint(fractionDone*100),
+			elapsed,
+			now.Sub(lastVisted).Seconds(),
+			expected-elapsed,
+			memStats.Alloc/1000000,
+		)
+		lastVisted = now
+		return false
+	}
+}
@@ -0,0 +1,117 @@
+package appstore
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+	"github.com/tendermint/tendermint/libs/db"
+)
+
+// The checkpoint key doesn't start with any of the IAVL key prefixes, so it can't collide with
+// the nodes & roots being copied.
+var cloneCheckpointKey = []byte("clusterkit/clone-checkpoint")
+
+var errCloneInterrupted = errors.New("clone interrupted")
+
+// cloneCheckpoint records the progress of a clone in the destination DB, it's written in the same
+// batch as the nodes copied since the previous checkpoint so the two never get out of sync.
+type cloneCheckpoint struct {
+	Version  int64  `json:"version"`
+	RootHash []byte `json:"rootHash"`
+	// Hashes of the nodes that still need to be copied, the next node to copy is the last one.
+	Pending      [][]byte `json:"pending"`
+	LastNodeHash []byte   `json:"lastNodeHash"`
+	LastKey      []byte   `json:"lastKey"`
+	NumNodes     uint64   `json:"numNodes"`
+	NumLeaves    uint64   `json:"numLeaves"`
+	NumBytes     uint64   `json:"numBytes"`
+}
+
+func newCloneCheckpoint(version int64, rootHash []byte) *cloneCheckpoint {
+	cp := &cloneCheckpoint{
+		Version:  version,
+		RootHash: rootHash,
+	}
+	if len(rootHash) > 0 {
+		cp.Pending = [][]byte{rootHash}
+	}
+	return cp
+}
+
+// loadCloneCheckpoint returns the checkpoint stored in the given DB, or nil if there isn't one.
+func loadCloneCheckpoint(destDB db.DB) (*cloneCheckpoint, error) {
+	buf := destDB.Get(cloneCheckpointKey)
+	if buf == nil {
+		return nil, nil
+	}
+	cp := &cloneCheckpoint{}
+	if err := json.Unmarshal(buf, cp); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal clone checkpoint")
+	}
+	return cp, nil
+}
+
+func (cp *cloneCheckpoint) save(batch db.Batch) error {
+	buf, err := json.Marshal(cp)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal clone checkpoint")
+	}
+	batch.Set(cloneCheckpointKey, buf)
+	return nil
+}
+
+// copyIAVLVersion copies the raw nodes of a single IAVL tree version from srcDB to destDB, starting
+// from the position recorded in the checkpoint. Nodes are copied depth first, left to right, so
+// leaves are copied in key order. A checkpoint is committed along with every savesPerCommit nodes,
+// and the root is only written once all the nodes have been copied, so an interrupted clone can't
+// be mistaken for a complete one. Since the nodes are copied verbatim the resulting tree has
+// exactly the same root hash as the source tree.
+// If debugFn returns true the copy is aborted without committing the nodes copied since the last
+// checkpoint.
+func copyIAVLVersion(
+	srcDB, destDB db.DB, cp *cloneCheckpoint, savesPerCommit uint64, debugFn func(height int8) bool,
+) error {
+	batch := destDB.NewBatch()
+	saves := uint64(0)
+	for len(cp.Pending) > 0 {
+		hash := cp.Pending[len(cp.Pending)-1]
+		cp.Pending = cp.Pending[:len(cp.Pending)-1]
+
+		buf := srcDB.Get(iavlNodeKey(hash))
+		if buf == nil {
+			return errors.Errorf("node %X not found in source DB", hash)
+		}
+		node, err := decodeIAVLNode(buf)
+		if err != nil {
+			return errors.Wrapf(err, "failed to decode node %X", hash)
+		}
+		batch.Set(iavlNodeKey(hash), buf)
+
+		cp.NumNodes++
+		cp.NumBytes += uint64(len(buf))
+		cp.LastNodeHash = hash
+		if node.isLeaf() {
+			cp.NumLeaves++
+			cp.LastKey = node.key
+		} else {
+			cp.Pending = append(cp.Pending, node.rightHash, node.leftHash)
+		}
+
+		saves++
+		if savesPerCommit > 0 && saves%savesPerCommit == 0 {
+			if err := cp.save(batch); err != nil {
+				return err
+			}
+			batch.Write()
+			batch = destDB.NewBatch()
+		}
+
+		if debugFn != nil && debugFn(node.height) {
+			return errCloneInterrupted
+		}
+	}
+	batch.Set(iavlRootKey(cp.Version), cp.RootHash)
+	batch.Delete(cloneCheckpointKey)
+	batch.WriteSync()
+	return nil
+}
@@ -0,0 +1,87 @@
+package appstore
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tendermint/iavl"
+	"github.com/tendermint/tendermint/libs/db"
+)
+
+func TestCloneIAVLTreeFromDBResume(t *testing.T) {
+	for _, dir := range []string{"./tempCloneSrc.db", "./tempCloneFull.db", "./tempCloneResumed.db"} {
+		_ = os.RemoveAll(dir)
+		defer os.RemoveAll(dir)
+	}
+
+	srcDB, err := db.NewGoLevelDB("tempCloneSrc", ".")
+	require.NoError(t, err)
+	tree := iavl.NewMutableTree(srcDB, 0)
+	_, err = tree.Load()
+	require.NoError(t, err)
+	for version := 0; version < 3; version++ {
+		for i := 0; i < 200; i++ {
+			tree.Set([]byte(fmt.Sprintf("key%d", i*(version+1))), []byte(fmt.Sprintf("value%d-%d", i, version)))
+		}
+		_, _, err = tree.SaveVersion()
+		require.NoError(t, err)
+	}
+	tree.Set([]byte("key1"), []byte("latest"))
+	_, _, err = tree.SaveVersion()
+	require.NoError(t, err)
+	srcDB.Close()
+
+	// clone an older version without interruptions
+	require.NoError(t, CloneIAVLTreeFromDB("./tempCloneSrc.db", "", "./tempCloneFull.db", 3, 0, 7, false, true))
+
+	// start another clone and abort it half way through
+	srcDB, err = db.NewGoLevelDB("tempCloneSrc", ".")
+	require.NoError(t, err)
+	tree = iavl.NewMutableTree(srcDB, 0)
+	_, err = tree.LoadVersion(3)
+	require.NoError(t, err)
+	destDB, err := db.NewGoLevelDB("tempCloneResumed", ".")
+	require.NoError(t, err)
+	leaves := int64(0)
+	cp := newCloneCheckpoint(3, srcDB.Get(iavlRootKey(3)))
+	err = copyIAVLVersion(srcDB, destDB, cp, 7, func(height int8) bool {
+		if height == 0 {
+			leaves++
+		}
+		return leaves == tree.Size()/2
+	})
+	require.Equal(t, errCloneInterrupted, err)
+	require.False(t, destDB.Has(iavlRootKey(3)))
+	srcDB.Close()
+	destDB.Close()
+
+	require.Error(t, CloneIAVLTreeFromDB("./tempCloneSrc.db", "", "./tempCloneResumed.db", 4, 0, 7, true, false))
+	require.NoError(t, CloneIAVLTreeFromDB("./tempCloneSrc.db", "", "./tempCloneResumed.db", 3, 1, 7, true, true))
+
+	srcDB, err = db.NewGoLevelDB("tempCloneSrc", ".")
+	require.NoError(t, err)
+	defer srcDB.Close()
+	srcTree := iavl.NewMutableTree(srcDB, 0)
+	_, err = srcTree.LoadVersion(3)
+	require.NoError(t, err)
+
+	for _, name := range []string{"tempCloneFull", "tempCloneResumed"} {
+		cloneDB, err := db.NewGoLevelDB(name, ".")
+		require.NoError(t, err)
+		require.Nil(t, cloneDB.Get(cloneCheckpointKey))
+		cloneTree := iavl.NewMutableTree(cloneDB, 0)
+		version, err := cloneTree.Load()
+		require.NoError(t, err)
+		require.Equal(t, int64(3), version)
+		require.Equal(t, srcTree.Hash(), cloneTree.Hash())
+		require.Equal(t, srcTree.Size(), cloneTree.Size())
+		srcTree.Iterate(func(key, value []byte) bool {
+			_, cloneValue := cloneTree.Get(key)
+			require.Equal(t, value, cloneValue)
+			return false
+		})
+		cloneDB.Close()
+	}
+}
@@ -8,7 +8,6 @@ import (
 	"time"
 
 	"github.com/pkg/errors"
-	"github.com/syndtr/goleveldb/leveldb"
 	"github.com/syndtr/goleveldb/leveldb/opt"
 	"github.com/tendermint/iavl"
 	"github.com/tendermint/tendermint/libs/db"
@@ -24,7 +23,14 @@ const (
 	newThPrefix = "th"
 )
 
-func CopyEvmAuxiliary(srcDBPath, destDBPath string, batchSize, logLevel uint64, bloomFilter, txHash bool) error {
+// CopyEvmAuxiliary copies the EVM bloom filters and/or tx hashes from the IAVL tree at the given
+// height (zero for the latest) to a separate LevelDB. The entries are keyed by block height, if
+// fromBlock or toBlock is non-zero only the entries for blocks fromBlock to toBlock (inclusive) are
+// copied, fromBlock defaults to 1 and toBlock defaults to the height of the tree.
+func CopyEvmAuxiliary(
+	srcDBPath, destDBPath string, batchSize, logLevel uint64, bloomFilter, txHash bool,
+	height, fromBlock, toBlock int64,
+) error {
 	dbName := strings.TrimSuffix(path.Base(srcDBPath), ".db")
 	dbDir := path.Dir(srcDBPath)
 	appDb, err := db.NewGoLevelDBWithOpts(dbName, dbDir, &opt.Options{
@@ -35,113 +41,124 @@ func CopyEvmAuxiliary(srcDBPath, destDBPath string, batchSize, logLevel uint64,
 	}
 	defer appDb.Close()
 	tree := iavl.NewMutableTree(appDb, 0)
-	if _, err := tree.Load(); err != nil {
+	if _, err := tree.LoadVersion(height); err != nil {
 		return errors.Wrap(err, "cannot load appdb tree")
 	}
+	appVersion := tree.Version()
+	blockRange := fromBlock != 0 || toBlock != 0
+	if blockRange {
+		if fromBlock == 0 {
+			fromBlock = 1
+		}
+		if toBlock == 0 {
+			toBlock = appVersion
+		}
+		if fromBlock < 1 || fromBlock > toBlock {
+			return errors.Errorf("invalid block range %d to %d", fromBlock, toBlock)
+		}
+		if toBlock > appVersion {
+			return errors.Errorf("block %d is above the app.db height %d", toBlock, appVersion)
+		}
+		log.Printf("extract EVM data for blocks %d to %d at height %d", fromBlock, toBlock, appVersion)
+	} else {
+		log.Printf("extract EVM data at height %d", appVersion)
+	}
 
-	destDB, err := leveldb.OpenFile(destDBPath, nil)
+	destDB, err := openDestDB(destDBPath, int(batchSize))
 	if err != nil {
-		return errors.Wrap(err, "opening target database")
+		return err
 	}
-	defer destDB.Close()
 
 	leaves := uint(tree.Size())
 	log.Printf("Source app.db size %v data values", leaves)
 
 	startTime := time.Now()
-	batch := new(leveldb.Batch)
 	numKeys := uint64(0)
 	progressInterval := uint64(0)
 	if logLevel > 0 {
+		if blockRange {
+			leaves = uint(toBlock - fromBlock + 1)
+		}
 		progressInterval = uint64(leaves / uint(math.Pow(10, float64(logLevel))))
 	}
-	var itError *error
-
-	if bloomFilter {
-		tree.IterateRange(
-			[]byte(bfPrefixStart),
-			[]byte(bfPrefixEnd),
-			true,
-			func(key, value []byte) bool {
-				if !hasPrefix(key, []byte(bfPrefixStart)) {
-					log.Printf("key does not have prefix, skipped %s\n", string(key))
-					return false
-				}
-
-				numKeys++
-				if progressInterval > 0 && numKeys%progressInterval == 0 {
-					log.Println(numKeys, "keys processed: current key", string(key))
-				}
-
-				key, err := formatPrefixes(key, []byte(bfPrefixStart), []byte(newBfPrefix))
-				if err != nil {
-					log.Printf("failed to format prefixes of %s\n", string(key))
-					return false
-				}
-
-				batch.Put(key, value)
-				if batch.Len() > int(batchSize) {
-					if err := destDB.Write(batch, &opt.WriteOptions{Sync: false}); err != nil {
-						*itError = errors.Wrapf(err, "write batch after %v keys", numKeys)
-						return true
-					}
-					batch.Reset()
-				}
-				return false
-			},
-		)
-		if itError != nil {
-			return *itError
-		}
-		if err := destDB.Write(batch, &opt.WriteOptions{Sync: true}); err != nil {
-			return errors.Wrapf(err, "write batch after %v keys", numKeys)
+	// The keys end with the block height in little-endian, so they're not sorted by height, and the
+	// entries in a block range have to be looked up one by one.
+	copyBlockRange := func(prefixStart, newPrefix string) error {
+		for blockHeight := fromBlock; blockHeight <= toBlock; blockHeight++ {
+			heightBytes := uint64ToByteLittleEndian(uint64(blockHeight))
+			_, value := tree.Get(prefixKey([]byte(prefixStart), heightBytes))
+			if value == nil {
+				continue
+			}
+
+			numKeys++
+			if progressInterval > 0 && numKeys%progressInterval == 0 {
+				log.Println(numKeys, "keys processed: current block", blockHeight)
+			}
+
+			key := prefixKey([]byte(newPrefix), uint64ToByteBigEndian(uint64(blockHeight)))
+			if err := destDB.Put(key, value); err != nil {
+				return err
+			}
 		}
-		log.Println("finished extracting", string(bfPrefixStart))
+		return nil
 	}
-	if txHash {
-		tree.IterateRange(
-			[]byte(txHashPrefixStart),
-			[]byte(txHashPrefixEnd),
+	copyPrefix := func(prefixStart, prefixEnd, newPrefix string) error {
+		if blockRange {
+			return copyBlockRange(prefixStart, newPrefix)
+		}
+		return iterateTree(
+			tree.ImmutableTree,
+			[]byte(prefixStart),
+			[]byte(prefixEnd),
+			1,
 			true,
-			func(key, value []byte) bool {
-				if !hasPrefix(key, []byte(txHashPrefixStart)) {
-					log.Printf("key does not have prefix, skipped %s\n", string(key))
-					return false
-				}
-
-				numKeys++
-				if progressInterval > 0 && numKeys%progressInterval == 0 {
-					log.Println(numKeys, "keys processed: current key", string(key))
-				}
+			func(kvs []kvPair) error {
+				for _, kv := range kvs {
+					if !hasPrefix(kv.key, []byte(prefixStart)) {
+						log.Printf("key does not have prefix, skipped %s\n", string(kv.key))
+						continue
+					}
 
-				key, err := formatPrefixes(key, []byte(txHashPrefixStart), []byte(newThPrefix))
-				if err != nil {
-					log.Printf("failed to format prefixes of %s\n", string(key))
-					return false
-				}
+					numKeys++
+					if progressInterval > 0 && numKeys%progressInterval == 0 {
+						log.Println(numKeys, "keys processed: current key", string(kv.key))
+					}
 
-				batch.Put(key, value)
-				if batch.Len() > int(batchSize) {
-					if err := destDB.Write(batch, &opt.WriteOptions{Sync: false}); err != nil {
-						*itError = errors.Wrapf(err, "write batch after %v keys", numKeys)
-						return true
+					key, err := formatPrefixes(kv.key, []byte(prefixStart), []byte(newPrefix))
+					if err != nil {
+						log.Printf("failed to format prefixes of %s\n", string(kv.key))
+						continue
+					}
+					if err := destDB.Put(key, kv.value); err != nil {
+						return err
 					}
-					batch.Reset()
 				}
-				return false
+				return nil
 			},
 		)
-		if itError != nil {
-			return *itError
+	}
+
+	if bloomFilter {
+		err = copyPrefix(bfPrefixStart, bfPrefixEnd, newBfPrefix)
+		if err == nil {
+			log.Println("finished extracting", string(bfPrefixStart))
 		}
-		if err := destDB.Write(batch, &opt.WriteOptions{Sync: true}); err != nil {
-			return errors.Wrapf(err, "write batch after %v keys", numKeys)
+	}
+	if txHash && err == nil {
+		err = copyPrefix(txHashPrefixStart, txHashPrefixEnd, newThPrefix)
+		if err == nil {
+			log.Println("finished extracting", string(txHashPrefixStart))
 		}
-		log.Println("finished extracting", string(txHashPrefixStart))
 	}
-
 	if err != nil {
-		log.Println("failed to close destination db", "err", err)
+		if abortErr := destDB.Abort(); abortErr != nil {
+			log.Println("failed to abort copy", "err", abortErr)
+		}
+		return err
+	}
+	if err := destDB.Commit(); err != nil {
+		return err
 	}
 
 	now := time.Now()
@@ -0,0 +1,56 @@
+package appstore
+
+import (
+	"encoding/binary"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/tendermint/iavl"
+	"github.com/tendermint/tendermint/libs/db"
+)
+
+func TestCopyEvmAuxiliaryBlockRange(t *testing.T) {
+	_ = os.RemoveAll("./tempEvmAuxApp.db")
+	defer os.RemoveAll("./tempEvmAuxApp.db")
+	_ = os.RemoveAll("./tempEvmAuxDest.db")
+	defer os.RemoveAll("./tempEvmAuxDest.db")
+
+	// each version of the tree contains the EVM data of the block at the same height
+	srcDB, err := db.NewGoLevelDB("tempEvmAuxApp", ".")
+	require.NoError(t, err)
+	tree := iavl.NewMutableTree(srcDB, 0)
+	heightLE := make([]byte, 8)
+	for i := uint64(1); i <= 150; i++ {
+		binary.LittleEndian.PutUint64(heightLE, i)
+		tree.Set(prefixKey([]byte(bfPrefixStart), heightLE), []byte("bloom"))
+		tree.Set(prefixKey([]byte(txHashPrefixStart), heightLE), []byte("hash"))
+		_, _, err = tree.SaveVersion()
+		require.NoError(t, err)
+	}
+	srcDB.Close()
+
+	require.NoError(t, CopyEvmAuxiliary("./tempEvmAuxApp.db", "./tempEvmAuxDest.db", 10, 0, true, true, 100, 0, 0))
+	require.Equal(t, uint64(200), countKeys(t, "./tempEvmAuxDest.db"))
+
+	// the range can't extend past the height of the tree
+	require.Error(t, CopyEvmAuxiliary("./tempEvmAuxApp.db", "./tempEvmAuxDest.db", 10, 0, true, true, 100, 90, 120))
+	require.Error(t, CopyEvmAuxiliary("./tempEvmAuxApp.db", "./tempEvmAuxDest.db", 10, 0, true, true, 0, 120, 110))
+
+	// top up the bloom filters of the blocks that were added in version 2
+	require.NoError(t, CopyEvmAuxiliary("./tempEvmAuxApp.db", "./tempEvmAuxDest.db", 10, 0, true, false, 0, 101, 0))
+	require.Equal(t, uint64(250), countKeys(t, "./tempEvmAuxDest.db"))
+
+	destDB, err := leveldb.OpenFile("./tempEvmAuxDest.db", nil)
+	require.NoError(t, err)
+	defer destDB.Close()
+	for i := uint64(1); i <= 150; i++ {
+		has, err := destDB.Has(prefixKey([]byte(newBfPrefix), uint64ToByteBigEndian(i)), nil)
+		require.NoError(t, err)
+		require.True(t, has)
+		has, err = destDB.Has(prefixKey([]byte(newThPrefix), uint64ToByteBigEndian(i)), nil)
+		require.NoError(t, err)
+		require.Equal(t, i <= 100, has)
+	}
+}
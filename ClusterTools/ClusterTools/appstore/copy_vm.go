@@ -9,8 +9,6 @@ import (
 	"time"
 
 	"github.com/pkg/errors"
-	"github.com/syndtr/goleveldb/leveldb"
-	"github.com/syndtr/goleveldb/leveldb/opt"
 	"github.com/tendermint/iavl"
 	"github.com/tendermint/tendermint/libs/db"
 )
@@ -26,13 +24,17 @@ var (
 	defaultRoot = []byte{1}
 )
 
-func CopyEvmToLevelDb(srcDBPath, destDBPath string, batchSize, logLevel uint64, height int64) error {
+// CopyEvmToLevelDb copies the EVM state at the given height from app.db to a separate LevelDB. The
+// tree is walked by the given number of workers in parallel, the DB produced doesn't depend on the
+// number of workers.
+func CopyEvmToLevelDb(srcDBPath, destDBPath string, batchSize, logLevel uint64, height int64, workers int) error {
 	dbName := strings.TrimSuffix(path.Base(srcDBPath), ".db")
 	dbDir := path.Dir(srcDBPath)
 	appDb, err := db.NewGoLevelDB(dbName, dbDir)
 	if err != nil {
 		return errors.Wrapf(err, "failed to open %v", srcDBPath)
 	}
+	defer appDb.Close()
 	tree := iavl.NewMutableTree(appDb, 0)
 	if _, err := tree.LoadVersion(height); err != nil {
 		return errors.Wrap(err, "cannot load appdb tree")
@@ -40,73 +42,69 @@ func CopyEvmToLevelDb(srcDBPath, destDBPath string, batchSize, logLevel uint64,
 	appVersion := tree.Version()
 	log.Printf("extract EVM state at height %d", appVersion)
 
-	destDB, err := leveldb.OpenFile(destDBPath, nil)
+	destDB, err := openDestDB(destDBPath, int(batchSize))
 	if err != nil {
-		return errors.Wrap(err, "opening target database")
+		return err
 	}
 
 	leaves := uint(tree.Size())
 	log.Printf("Source app.db size %v data values", leaves)
 
 	startTime := time.Now()
-	batch := new(leveldb.Batch)
 	numKeys := uint64(0)
 	progressInterval := uint64(0)
 	if logLevel > 0 {
 		progressInterval = uint64(leaves / uint(math.Pow(10, float64(logLevel))))
 	}
-	var itError *error
-	tree.IterateRange(
+	err = iterateTree(
+		tree.ImmutableTree,
 		[]byte(prefixStart),
 		[]byte(prefixEnd),
-		true,
-		func(key, value []byte) bool {
-			if !hasPrefix(key, []byte(prefixStart)) {
-				log.Printf("key does not have prefix, skipped %s\n", string(key))
-				return false
-			}
+		workers,
+		false,
+		func(kvs []kvPair) error {
+			for _, kv := range kvs {
+				key, value := kv.key, kv.value
+				if !hasPrefix(key, []byte(prefixStart)) {
+					log.Printf("key does not have prefix, skipped %s\n", string(key))
+					continue
+				}
 
-			numKeys++
-			if progressInterval > 0 && numKeys%progressInterval == 0 {
-				log.Println(numKeys, "keys processed: current key", string(key))
-			}
+				numKeys++
+				if progressInterval > 0 && numKeys%progressInterval == 0 {
+					log.Println(numKeys, "keys processed: current key", string(key))
+				}
 
-			if bytes.Equal(prefixKey([]byte(prefixStart), []byte(rootKey)), key) {
-				log.Printf("Copy vmvmroot from app.db to vmevmroot of evm.db at height %d\n", appVersion)
-				// if Patricia root is nil, set it to defaultRoot for EvmStore
-				if value == nil {
-					value = defaultRoot
+				if bytes.Equal(prefixKey([]byte(prefixStart), []byte(rootKey)), key) {
+					log.Printf("Copy vmvmroot from app.db to vmevmroot of evm.db at height %d\n", appVersion)
+					// if Patricia root is nil, set it to defaultRoot for EvmStore
+					if value == nil {
+						value = defaultRoot
+					}
+					if err := destDB.Put(evmRootKey(appVersion), value); err != nil {
+						return err
+					}
 				}
-				batch.Put(evmRootKey(appVersion), value)
-			}
-			batch.Put(key, value)
-			if batch.Len() > int(batchSize) {
-				if err := destDB.Write(batch, &opt.WriteOptions{Sync: false}); err != nil {
-					*itError = errors.Wrapf(err, "write batch after %v keys", numKeys)
-					return true
+				if err := destDB.Put(key, value); err != nil {
+					return err
 				}
-				batch.Reset()
 			}
-			return false
+			return nil
 		},
 	)
 
-	if numKeys == 0 {
+	if err == nil && numKeys == 0 {
 		log.Printf("EVM state is empty, put default evmroot key at height %d\n", appVersion)
-		batch.Put(evmRootKey(appVersion), defaultRoot)
+		err = destDB.Put(evmRootKey(appVersion), defaultRoot)
 	}
-
-	if itError != nil {
-		return *itError
-	}
-
-	appDb.Close()
-	if err := destDB.Write(batch, &opt.WriteOptions{Sync: true}); err != nil {
-		return errors.Wrapf(err, "write batch after %v keys", numKeys)
-	}
-	err = destDB.Close()
 	if err != nil {
-		log.Println("failed to close destination db", "err", err)
+		if abortErr := destDB.Abort(); abortErr != nil {
+			log.Println("failed to abort copy", "err", abortErr)
+		}
+		return err
+	}
+	if err := destDB.Commit(); err != nil {
+		return err
 	}
 
 	now := time.Now()
@@ -53,7 +53,7 @@ func TestCopyEvmToLevelDb(t *testing.T) {
 	require.NoError(t, err)
 	tempSourceDB.Close()
 
-	require.NoError(t, CopyEvmToLevelDb("./tempApp.db", "./tempEvm.db", 2, 0, 0))
+	require.NoError(t, CopyEvmToLevelDb("./tempApp.db", "./tempEvm.db", 2, 0, 0, 3))
 
 	destDB, err := leveldb.OpenFile("./tempEvm.db", nil)
 	require.NoError(t, err)
@@ -0,0 +1,130 @@
+package appstore
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+)
+
+// WriteError is returned by the extraction commands when writing to the destination DB fails.
+type WriteError struct {
+	// Number of keys that were written to the destination DB before the failure.
+	NumKeysWritten uint64
+	Err            error
+}
+
+func (e *WriteError) Error() string {
+	return fmt.Sprintf("write failed after %v keys were written: %v", e.NumKeysWritten, e.Err)
+}
+
+// Cause returns the underlying error, for errors.Cause.
+func (e *WriteError) Cause() error {
+	return e.Err
+}
+
+// writeBatch writes a batch to a destination DB, tests replace it to simulate write failures.
+var writeBatch = func(ldb *leveldb.DB, batch *leveldb.Batch, sync bool) error {
+	return ldb.Write(batch, &opt.WriteOptions{Sync: sync})
+}
+
+// Key deleted to force a synced write, since goleveldb doesn't write empty batches. It's never
+// written to the destination DB, so deleting it has no effect.
+var syncKey = []byte("\x00clusterkit-sync")
+
+// destDB is a LevelDB the extraction commands write keys to in batches. Either Commit or Abort must
+// be called once the keys have been written.
+type destDB struct {
+	db         *leveldb.DB
+	path       string
+	created    bool
+	batch      *leveldb.Batch
+	batchSize  int
+	numWritten uint64
+}
+
+// openDestDB opens the LevelDB at the given path, creating it if it doesn't exist. Keys are written
+// to the DB once more than batchSize keys have been queued.
+func openDestDB(dbPath string, batchSize int) (*destDB, error) {
+	_, err := os.Stat(dbPath)
+	created := os.IsNotExist(err)
+	ldb, err := leveldb.OpenFile(dbPath, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "opening target database")
+	}
+	return &destDB{
+		db:        ldb,
+		path:      dbPath,
+		created:   created,
+		batch:     new(leveldb.Batch),
+		batchSize: batchSize,
+	}, nil
+}
+
+// Put queues a key to be written to the DB, and writes the queued keys if the batch is full.
+func (d *destDB) Put(key, value []byte) error {
+	d.batch.Put(key, value)
+	if d.batch.Len() > d.batchSize {
+		return d.write(false)
+	}
+	return nil
+}
+
+// NumKeysWritten returns the number of keys written to the DB so far.
+func (d *destDB) NumKeysWritten() uint64 {
+	return d.numWritten
+}
+
+func (d *destDB) write(sync bool) error {
+	if err := writeBatch(d.db, d.batch, sync); err != nil {
+		return &WriteError{NumKeysWritten: d.numWritten, Err: err}
+	}
+	d.numWritten += uint64(d.batch.Len())
+	d.batch.Reset()
+	return nil
+}
+
+// sync makes sure all the keys written so far are on disk.
+func (d *destDB) sync() error {
+	batch := new(leveldb.Batch)
+	batch.Delete(syncKey)
+	return writeBatch(d.db, batch, true)
+}
+
+// Commit writes any queued keys, syncs them to disk, and closes the DB. If the write fails the DB
+// is aborted.
+func (d *destDB) Commit() error {
+	err := d.write(false)
+	if err == nil {
+		if syncErr := d.sync(); syncErr != nil {
+			err = &WriteError{NumKeysWritten: d.numWritten, Err: syncErr}
+		}
+	}
+	if err != nil {
+		if abortErr := d.Abort(); abortErr != nil {
+			return errors.Wrapf(abortErr, "failed to abort after %v", err)
+		}
+		return err
+	}
+	return d.db.Close()
+}
+
+// Abort discards any queued keys and closes the DB. If the DB was created by openDestDB it's
+// deleted, since it only contains part of the keys, otherwise the keys that were already written
+// are synced to disk so the DB is left in a consistent state.
+func (d *destDB) Abort() error {
+	d.batch.Reset()
+	if d.created {
+		if err := d.db.Close(); err != nil {
+			return errors.Wrap(err, "failed to close target database")
+		}
+		return os.RemoveAll(d.path)
+	}
+	if err := d.sync(); err != nil {
+		d.db.Close()
+		return errors.Wrap(err, "failed to sync target database")
+	}
+	return d.db.Close()
+}
@@ -0,0 +1,151 @@
+package appstore
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/tendermint/iavl"
+	"github.com/tendermint/tendermint/libs/db"
+)
+
+// failWritesAfter makes all the batch writes after the first numWrites fail, the returned function
+// restores the original writeBatch.
+func failWritesAfter(numWrites int) func() {
+	origWriteBatch := writeBatch
+	writeBatch = func(ldb *leveldb.DB, batch *leveldb.Batch, sync bool) error {
+		if numWrites == 0 {
+			return errors.New("disk full")
+		}
+		numWrites--
+		return origWriteBatch(ldb, batch, sync)
+	}
+	return func() {
+		writeBatch = origWriteBatch
+	}
+}
+
+func makeExtractTestAppDB(t *testing.T, dbName string) {
+	_ = os.RemoveAll("./" + dbName + ".db")
+	srcDB, err := db.NewGoLevelDB(dbName, ".")
+	require.NoError(t, err)
+	defer srcDB.Close()
+	tree := iavl.NewMutableTree(srcDB, 0)
+	heightLE := make([]byte, 8)
+	for i := uint64(1); i <= 100; i++ {
+		tree.Set(prefixKey([]byte("vm"), []byte(fmt.Sprintf("key%03d", i))), []byte("value"))
+		binary.LittleEndian.PutUint64(heightLE, i)
+		tree.Set(prefixKey([]byte(bfPrefixStart), heightLE), []byte("bloom"))
+		tree.Set(prefixKey([]byte(txHashPrefixStart), heightLE), []byte("hash"))
+	}
+	_, _, err = tree.SaveVersion()
+	require.NoError(t, err)
+}
+
+func countKeys(t *testing.T, dbPath string) uint64 {
+	ldb, err := leveldb.OpenFile(dbPath, nil)
+	require.NoError(t, err)
+	defer ldb.Close()
+	numKeys := uint64(0)
+	it := ldb.NewIterator(nil, nil)
+	defer it.Release()
+	for it.Next() {
+		numKeys++
+	}
+	return numKeys
+}
+
+func TestExtractionWriteFailures(t *testing.T) {
+	makeExtractTestAppDB(t, "tempWriteFailApp")
+	defer os.RemoveAll("./tempWriteFailApp.db")
+	defer os.RemoveAll("./tempWriteFailDest.db")
+
+	// the partial destination DB is deleted if it was created by the command
+	restore := failWritesAfter(2)
+	err := CopyEvmToLevelDb("./tempWriteFailApp.db", "./tempWriteFailDest.db", 10, 0, 0, 2)
+	restore()
+	writeErr, ok := err.(*WriteError)
+	require.True(t, ok, "unexpected error %v", err)
+	require.Equal(t, uint64(22), writeErr.NumKeysWritten)
+	require.EqualError(t, errors.Cause(err), "disk full")
+	_, err = os.Stat("./tempWriteFailDest.db")
+	require.True(t, os.IsNotExist(err))
+
+	restore = failWritesAfter(0)
+	err = ExtractIAVLTreeValuesFromDB("./tempWriteFailApp.db", "./tempWriteFailDest.db", 0, 0, 10, 1)
+	restore()
+	writeErr, ok = err.(*WriteError)
+	require.True(t, ok, "unexpected error %v", err)
+	require.Equal(t, uint64(0), writeErr.NumKeysWritten)
+	_, err = os.Stat("./tempWriteFailDest.db")
+	require.True(t, os.IsNotExist(err))
+
+	// the final sync can fail too
+	restore = failWritesAfter(0)
+	_, err = ExtractPrefixes("./tempWriteFailApp.db", "./tempWriteFailDest.db", []string{"vm"}, nil, 0, 1000, 0, 1)
+	restore()
+	writeErr, ok = err.(*WriteError)
+	require.True(t, ok, "unexpected error %v", err)
+	require.Equal(t, uint64(0), writeErr.NumKeysWritten)
+	_, err = os.Stat("./tempWriteFailDest.db")
+	require.True(t, os.IsNotExist(err))
+
+	// keys written to an existing destination DB before the failure are kept
+	ldb, err := leveldb.OpenFile("./tempWriteFailDest.db", nil)
+	require.NoError(t, err)
+	require.NoError(t, ldb.Put([]byte("existing"), []byte("value"), &opt.WriteOptions{Sync: true}))
+	require.NoError(t, ldb.Close())
+	restore = failWritesAfter(5)
+	err = CopyEvmAuxiliary("./tempWriteFailApp.db", "./tempWriteFailDest.db", 10, 0, true, true, 0, 0, 0)
+	restore()
+	writeErr, ok = err.(*WriteError)
+	require.True(t, ok, "unexpected error %v", err)
+	require.Equal(t, uint64(55), writeErr.NumKeysWritten)
+	require.Equal(t, writeErr.NumKeysWritten+1, countKeys(t, "./tempWriteFailDest.db"))
+
+	require.NoError(t, CopyEvmAuxiliary("./tempWriteFailApp.db", "./tempWriteFailDest.db", 10, 0, true, true, 0, 0, 0))
+	require.Equal(t, uint64(201), countKeys(t, "./tempWriteFailDest.db"))
+}
+
+func TestDestDBSync(t *testing.T) {
+	dbPath := "./tempDestDBSync.db"
+	_ = os.RemoveAll(dbPath)
+	defer os.RemoveAll(dbPath)
+
+	// record the size of each synced write
+	var syncedWrites []int
+	origWriteBatch := writeBatch
+	writeBatch = func(ldb *leveldb.DB, batch *leveldb.Batch, sync bool) error {
+		if sync {
+			syncedWrites = append(syncedWrites, batch.Len())
+		}
+		return origWriteBatch(ldb, batch, sync)
+	}
+	defer func() {
+		writeBatch = origWriteBatch
+	}()
+
+	// goleveldb skips empty batches, so every sync has to write something
+	destDB, err := openDestDB(dbPath, 1)
+	require.NoError(t, err)
+	for i := 0; i < 4; i++ {
+		require.NoError(t, destDB.Put([]byte(fmt.Sprintf("key%d", i)), []byte("value")))
+	}
+	require.NoError(t, destDB.Commit())
+	require.Equal(t, 1, len(syncedWrites))
+	require.True(t, syncedWrites[0] > 0)
+
+	destDB, err = openDestDB(dbPath, 1)
+	require.NoError(t, err)
+	require.NoError(t, destDB.Put([]byte("key4"), []byte("value")))
+	require.NoError(t, destDB.Put([]byte("key5"), []byte("value")))
+	require.NoError(t, destDB.Abort())
+	require.Equal(t, 2, len(syncedWrites))
+	require.True(t, syncedWrites[1] > 0)
+	require.Equal(t, uint64(6), countKeys(t, dbPath))
+}
@@ -0,0 +1,247 @@
+package appstore
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tendermint/iavl"
+)
+
+type KeyDiffType string
+
+const (
+	KeyAdded   KeyDiffType = "added"
+	KeyRemoved KeyDiffType = "removed"
+	KeyChanged KeyDiffType = "changed"
+)
+
+// KeyDiff describes a key that differs between tree A and tree B. Added keys only exist in tree B,
+// removed keys only exist in tree A.
+type KeyDiff struct {
+	Type   KeyDiffType
+	Key    []byte
+	ValueA []byte
+	ValueB []byte
+}
+
+type IAVLTreeDiffStats struct {
+	VersionA     int64
+	VersionB     int64
+	NumAdded     uint64
+	NumRemoved   uint64
+	NumChanged   uint64
+	NumUnchanged uint64
+	TimeTaken    time.Duration
+}
+
+// DiffIAVLTrees walks the IAVL trees in dbPathA & dbPathB in key order and calls fn for every key
+// that differs between the two trees. Both paths may refer to the same DB, in which case two
+// versions of the same tree are compared. A zero height means the latest version, and if prefix
+// isn't empty only keys starting with it are compared. If fn returns an error the walk is aborted.
+func DiffIAVLTrees(
+	dbPathA, dbPathB string, heightA, heightB int64, prefix string, fn func(diff KeyDiff) error,
+) (IAVLTreeDiffStats, error) {
+	dbA, err := openReadOnlyDB(dbPathA)
+	if err != nil {
+		return IAVLTreeDiffStats{}, err
+	}
+	defer dbA.Close()
+
+	dbB := dbA
+	if path.Clean(dbPathA) != path.Clean(dbPathB) {
+		dbB, err = openReadOnlyDB(dbPathB)
+		if err != nil {
+			return IAVLTreeDiffStats{}, err
+		}
+		defer dbB.Close()
+	}
+
+	treeA := iavl.NewMutableTree(dbA, 0)
+	versionA, err := treeA.LoadVersion(heightA)
+	if err != nil {
+		return IAVLTreeDiffStats{}, errors.Wrapf(err, "failed to load IAVL tree version %v from %v", heightA, dbPathA)
+	}
+	treeB := iavl.NewMutableTree(dbB, 0)
+	versionB, err := treeB.LoadVersion(heightB)
+	if err != nil {
+		return IAVLTreeDiffStats{}, errors.Wrapf(err, "failed to load IAVL tree version %v from %v", heightB, dbPathB)
+	}
+	immutableA, err := treeA.GetImmutable(versionA)
+	if err != nil {
+		return IAVLTreeDiffStats{}, errors.Wrapf(err, "failed to load immutable tree for version %v", versionA)
+	}
+	immutableB, err := treeB.GetImmutable(versionB)
+	if err != nil {
+		return IAVLTreeDiffStats{}, errors.Wrapf(err, "failed to load immutable tree for version %v", versionB)
+	}
+
+	stats, err := diffIAVLTrees(immutableA, immutableB, prefix, fn)
+	stats.VersionA = versionA
+	stats.VersionB = versionB
+	return stats, err
+}
+
+func diffIAVLTrees(
+	treeA, treeB *iavl.ImmutableTree, prefix string, fn func(diff KeyDiff) error,
+) (IAVLTreeDiffStats, error) {
+	start := []byte(nil)
+	if len(prefix) > 0 {
+		start = []byte(prefix)
+	}
+	end := prefixRangeEnd(start)
+
+	stats := IAVLTreeDiffStats{}
+	startTime := time.Now()
+	itA := newTreeIterator(treeA, start, end)
+	defer itA.Close()
+	itB := newTreeIterator(treeB, start, end)
+	defer itB.Close()
+	for itA.Valid() || itB.Valid() {
+		var diff KeyDiff
+		cmp := 0
+		if !itA.Valid() {
+			cmp = 1
+		} else if !itB.Valid() {
+			cmp = -1
+		} else {
+			cmp = bytes.Compare(itA.Key(), itB.Key())
+		}
+
+		switch {
+		case cmp < 0:
+			diff = KeyDiff{Type: KeyRemoved, Key: itA.Key(), ValueA: itA.Value()}
+			stats.NumRemoved++
+			itA.Next()
+		case cmp > 0:
+			diff = KeyDiff{Type: KeyAdded, Key: itB.Key(), ValueB: itB.Value()}
+			stats.NumAdded++
+			itB.Next()
+		default:
+			if bytes.Equal(itA.Value(), itB.Value()) {
+				stats.NumUnchanged++
+				itA.Next()
+				itB.Next()
+				continue
+			}
+			diff = KeyDiff{Type: KeyChanged, Key: itA.Key(), ValueA: itA.Value(), ValueB: itB.Value()}
+			stats.NumChanged++
+			itA.Next()
+			itB.Next()
+		}
+
+		if err := fn(diff); err != nil {
+			stats.TimeTaken = time.Since(startTime)
+			return stats, err
+		}
+	}
+	stats.TimeTaken = time.Since(startTime)
+	return stats, nil
+}
+
+// Output formats supported by KeyDiffWriter.
+const (
+	DiffFormatText = "text"
+	DiffFormatJSON = "json"
+	DiffFormatCSV  = "csv"
+)
+
+// KeyDiffWriter writes key diffs out in one of the supported formats, keys & values are hex
+// encoded in the JSON lines & CSV formats. Unless fullValues is set only the SHA256 hashes of the
+// values are written out.
+type KeyDiffWriter struct {
+	w          io.Writer
+	csv        *csv.Writer
+	format     string
+	fullValues bool
+}
+
+func NewKeyDiffWriter(w io.Writer, format string, fullValues bool) (*KeyDiffWriter, error) {
+	dw := &KeyDiffWriter{
+		w:          w,
+		format:     format,
+		fullValues: fullValues,
+	}
+	switch format {
+	case DiffFormatText, DiffFormatJSON:
+	case DiffFormatCSV:
+		dw.csv = csv.NewWriter(w)
+		if err := dw.csv.Write([]string{"type", "key", "value_a", "value_b"}); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported diff format '%s'", format)
+	}
+	return dw, nil
+}
+
+// KeyDiffEntry is a key diff with the key & values hex encoded, as written out in the JSON lines
+// format. Unless fullValues was set the values are SHA256 hashes.
+type KeyDiffEntry struct {
+	Type   KeyDiffType `json:"type"`
+	Key    string      `json:"key"`
+	ValueA string      `json:"valueA,omitempty"`
+	ValueB string      `json:"valueB,omitempty"`
+}
+
+func NewKeyDiffEntry(diff KeyDiff, fullValues bool) KeyDiffEntry {
+	return KeyDiffEntry{
+		Type:   diff.Type,
+		Key:    hex.EncodeToString(diff.Key),
+		ValueA: formatDiffValue(diff.ValueA, fullValues),
+		ValueB: formatDiffValue(diff.ValueB, fullValues),
+	}
+}
+
+func formatDiffValue(value []byte, fullValues bool) string {
+	if value == nil {
+		return ""
+	}
+	if fullValues {
+		return hex.EncodeToString(value)
+	}
+	hash := sha256.Sum256(value)
+	return hex.EncodeToString(hash[:])
+}
+
+func (dw *KeyDiffWriter) Write(diff KeyDiff) error {
+	entry := NewKeyDiffEntry(diff, dw.fullValues)
+	switch dw.format {
+	case DiffFormatJSON:
+		buf, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(dw.w, "%s\n", buf)
+		return err
+	case DiffFormatCSV:
+		return dw.csv.Write([]string{string(entry.Type), entry.Key, entry.ValueA, entry.ValueB})
+	default:
+		var err error
+		switch diff.Type {
+		case KeyAdded:
+			_, err = fmt.Fprintf(dw.w, "+ %q %s\n", diff.Key, entry.ValueB)
+		case KeyRemoved:
+			_, err = fmt.Fprintf(dw.w, "- %q %s\n", diff.Key, entry.ValueA)
+		default:
+			_, err = fmt.Fprintf(dw.w, "~ %q %s -> %s\n", diff.Key, entry.ValueA, entry.ValueB)
+		}
+		return err
+	}
+}
+
+// Flush must be called once all the diffs have been written.
+func (dw *KeyDiffWriter) Flush() error {
+	if dw.csv != nil {
+		dw.csv.Flush()
+		return dw.csv.Error()
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package appstore
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tendermint/iavl"
+	"github.com/tendermint/tendermint/libs/db"
+)
+
+func TestDiffIAVLTrees(t *testing.T) {
+	_ = os.RemoveAll("./tempDiff.db")
+	defer os.RemoveAll("./tempDiff.db")
+
+	tempDB, err := db.NewGoLevelDB("tempDiff", ".")
+	require.NoError(t, err)
+	tree := iavl.NewMutableTree(tempDB, 0)
+	_, err = tree.Load()
+	require.NoError(t, err)
+	for _, k := range []string{"a\x00removed", "a\x00same", "a\x00changed", "b\x00other"} {
+		tree.Set([]byte(k), []byte(k))
+	}
+	_, _, err = tree.SaveVersion()
+	require.NoError(t, err)
+	tree.Remove([]byte("a\x00removed"))
+	tree.Set([]byte("a\x00changed"), []byte("new value"))
+	tree.Set([]byte("a\x00added"), []byte("added"))
+	tree.Set([]byte("b\x00added"), []byte("added"))
+	_, _, err = tree.SaveVersion()
+	require.NoError(t, err)
+	tempDB.Close()
+
+	var diffs []KeyDiff
+	stats, err := DiffIAVLTrees("./tempDiff.db", "./tempDiff.db", 1, 2, "a", func(diff KeyDiff) error {
+		diffs = append(diffs, diff)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, int64(1), stats.VersionA)
+	require.Equal(t, int64(2), stats.VersionB)
+	require.Equal(t, uint64(1), stats.NumAdded)
+	require.Equal(t, uint64(1), stats.NumRemoved)
+	require.Equal(t, uint64(1), stats.NumChanged)
+	require.Equal(t, uint64(1), stats.NumUnchanged)
+	require.Equal(t, []KeyDiff{
+		{Type: KeyAdded, Key: []byte("a\x00added"), ValueB: []byte("added")},
+		{Type: KeyChanged, Key: []byte("a\x00changed"), ValueA: []byte("a\x00changed"), ValueB: []byte("new value")},
+		{Type: KeyRemoved, Key: []byte("a\x00removed"), ValueA: []byte("a\x00removed")},
+	}, diffs)
+
+	var buf bytes.Buffer
+	w, err := NewKeyDiffWriter(&buf, DiffFormatCSV, true)
+	require.NoError(t, err)
+	for _, diff := range diffs {
+		require.NoError(t, w.Write(diff))
+	}
+	require.NoError(t, w.Flush())
+	require.Equal(t, []string{
+		"type,key,value_a,value_b",
+		"added,61006164646564,,6164646564",
+		"changed,61006368616e676564,61006368616e676564,6e65772076616c7565",
+		"removed,610072656d6f766564,610072656d6f766564,",
+		"",
+	}, strings.Split(buf.String(), "\n"))
+
+	_, err = NewKeyDiffWriter(&buf, "xml", false)
+	require.Error(t, err)
+}
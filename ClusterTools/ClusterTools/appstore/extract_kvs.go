@@ -5,12 +5,11 @@ import (
 	"fmt"
 	"math"
 	"path"
+	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/pkg/errors"
-	"github.com/syndtr/goleveldb/leveldb"
-	"github.com/syndtr/goleveldb/leveldb/opt"
 	"github.com/tendermint/iavl"
 	"github.com/tendermint/tendermint/libs/db"
 )
@@ -37,7 +36,10 @@ func PrefixKey(keys ...[]byte) []byte {
 	return buf
 }
 
-func ExtractIAVLTreeValuesFromDB(srcDBPath, destDBPath string, treeVersion, logLevel, batchSize int64) error {
+// ExtractIAVLTreeValuesFromDB copies the keys & values stored in the leaf nodes of the IAVL tree in
+// the source DB to the destination DB. The tree is walked by the given number of workers in
+// parallel, the DB produced doesn't depend on the number of workers.
+func ExtractIAVLTreeValuesFromDB(srcDBPath, destDBPath string, treeVersion, logLevel, batchSize int64, workers int) error {
 	dbName := strings.TrimSuffix(path.Base(srcDBPath), ".db")
 	dbDir := path.Dir(srcDBPath)
 	appDB, err := db.NewGoLevelDB(dbName, dbDir)
@@ -61,11 +63,10 @@ func ExtractIAVLTreeValuesFromDB(srcDBPath, destDBPath string, treeVersion, logL
 	// TM LevelDB wrapper adds .db suffix, so gotta remove it to prevent duplication
 	dbName = strings.TrimSuffix(path.Base(destDBPath), ".db")
 	dbDir = path.Dir(destDBPath)
-	destDB, err := db.NewGoLevelDB(dbName, dbDir)
+	destDB, err := openDestDB(filepath.Join(dbDir, dbName+".db"), int(batchSize))
 	if err != nil {
 		return errors.Wrapf(err, "failed to open %v", destDBPath)
 	}
-	defer destDB.Close()
 
 	keyCount := uint64(0)
 	leaves := uint(immutableTree.Size())
@@ -77,33 +78,36 @@ func ExtractIAVLTreeValuesFromDB(srcDBPath, destDBPath string, treeVersion, logL
 	fmt.Printf("IAVL tree height %v with %v keys\n", immutableTree.Height(), immutableTree.Size())
 
 	startTime := time.Now()
-	batch := new(leveldb.Batch)
-	immutableTree.Iterate(func(key, value []byte) bool {
-		batch.Put(key, value)
-		if batch.Len() > int(batchSize) {
-			if err := destDB.DB().Write(batch, &opt.WriteOptions{Sync: false}); err != nil {
-				panic(err)
+	err = iterateTree(immutableTree, nil, nil, workers, false, func(kvs []kvPair) error {
+		for _, kv := range kvs {
+			if err := destDB.Put(kv.key, kv.value); err != nil {
+				return err
 			}
-			batch.Reset()
-		}
 
-		keyCount++
-		if progressInterval > 0 && (keyCount%progressInterval) == 0 {
-			elapsed := time.Since(startTime).Minutes()
-			fractionDone := float64(keyCount) / float64(leaves)
-			expected := elapsed / fractionDone
+			keyCount++
+			if progressInterval > 0 && (keyCount%progressInterval) == 0 {
+				elapsed := time.Since(startTime).Minutes()
+				fractionDone := float64(keyCount) / float64(leaves)
+				expected := elapsed / fractionDone
 
-			fmt.Printf(
-				"%v%% done in %v mins. ETA %v mins.\n",
-				int(fractionDone*100), int(elapsed), int(expected-elapsed),
-			)
+				fmt.Printf(
+					"%v%% done in %v mins. ETA %v mins.\n",
+					int(fractionDone*100), int(elapsed), int(expected-elapsed),
+				)
+			}
 		}
-		return false
+		return nil
 	})
-
-	buf := make([]byte, 8)
-	binary.BigEndian.PutUint64(buf, uint64(treeVersion))
-	batch.Put(valueDBVersionKey, buf)
-
-	return destDB.DB().Write(batch, &opt.WriteOptions{Sync: true})
+	if err == nil {
+		buf := make([]byte, 8)
+		binary.BigEndian.PutUint64(buf, uint64(treeVersion))
+		err = destDB.Put(valueDBVersionKey, buf)
+	}
+	if err != nil {
+		if abortErr := destDB.Abort(); abortErr != nil {
+			fmt.Printf("Failed to abort extraction: %v\n", abortErr)
+		}
+		return err
+	}
+	return destDB.Commit()
 }
@@ -0,0 +1,227 @@
+package appstore
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"math"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tendermint/iavl"
+)
+
+// Operations that can be used in a KeyRewriteStep.
+const (
+	// Removes a prefix (and the zero byte that follows it) from the key, the prefix defaults to the
+	// prefix of the rule.
+	RewriteStripPrefix = "strip-prefix"
+	// Prepends a prefix (and a zero byte) to the key.
+	RewriteAddPrefix = "add-prefix"
+	// Converts the 8 byte little-endian integer (e.g. a block height) at the start of the key to
+	// big-endian, so the keys are sorted numerically.
+	RewriteLittleToBigEndian = "le-to-be"
+	// Converts the 8 byte big-endian integer at the start of the key to little-endian.
+	RewriteBigToLittleEndian = "be-to-le"
+)
+
+// KeyRewriteStep is a single operation applied to a key by a KeyRewriteRule.
+type KeyRewriteStep struct {
+	Op    string `json:"op"`
+	Value string `json:"value,omitempty"`
+}
+
+// KeyRewriteRule specifies how the keys with the given prefix should be rewritten when they're
+// extracted from the app store, the steps are applied in order.
+type KeyRewriteRule struct {
+	Prefix string           `json:"prefix"`
+	Steps  []KeyRewriteStep `json:"steps"`
+}
+
+// KeyRewriteRules is the format of the rule file used by ExtractPrefixes, e.g. the rule below
+// rewrites the keys of the EVM bloom filters in the same way as CopyEvmAuxiliary.
+//
+//	{
+//	  "rules": [
+//	    {
+//	      "prefix": "bloomFilter",
+//	      "steps": [{"op": "strip-prefix"}, {"op": "le-to-be"}, {"op": "add-prefix", "value": "bf"}]
+//	    }
+//	  ]
+//	}
+type KeyRewriteRules struct {
+	Rules []KeyRewriteRule `json:"rules"`
+}
+
+// LoadKeyRewriteRules loads and validates the rules in the given JSON file.
+func LoadKeyRewriteRules(rulesPath string) (*KeyRewriteRules, error) {
+	data, err := ioutil.ReadFile(rulesPath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read %s", rulesPath)
+	}
+	rules := &KeyRewriteRules{}
+	if err := json.Unmarshal(data, rules); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse %s", rulesPath)
+	}
+	if err := rules.validate(); err != nil {
+		return nil, errors.Wrapf(err, "invalid rules in %s", rulesPath)
+	}
+	return rules, nil
+}
+
+func (r *KeyRewriteRules) validate() error {
+	prefixes := map[string]bool{}
+	for _, rule := range r.Rules {
+		if rule.Prefix == "" {
+			return errors.New("rule prefix must not be empty")
+		}
+		if prefixes[rule.Prefix] {
+			return errors.Errorf("more than one rule for prefix %s", rule.Prefix)
+		}
+		prefixes[rule.Prefix] = true
+		for _, step := range rule.Steps {
+			switch step.Op {
+			case RewriteStripPrefix, RewriteLittleToBigEndian, RewriteBigToLittleEndian:
+			case RewriteAddPrefix:
+				if step.Value == "" {
+					return errors.Errorf("%s step of rule for prefix %s has no value", step.Op, rule.Prefix)
+				}
+			default:
+				return errors.Errorf("unsupported op '%s' in rule for prefix %s", step.Op, rule.Prefix)
+			}
+		}
+	}
+	return nil
+}
+
+// Prefixes returns the prefixes the rules apply to.
+func (r *KeyRewriteRules) Prefixes() []string {
+	prefixes := []string{}
+	for _, rule := range r.Rules {
+		prefixes = append(prefixes, rule.Prefix)
+	}
+	return prefixes
+}
+
+func (r *KeyRewriteRules) ruleFor(prefix string) *KeyRewriteRule {
+	if r == nil {
+		return nil
+	}
+	for i := range r.Rules {
+		if r.Rules[i].Prefix == prefix {
+			return &r.Rules[i]
+		}
+	}
+	return nil
+}
+
+// Rewrite applies the steps of the rule to the given key.
+func (rule *KeyRewriteRule) Rewrite(key []byte) ([]byte, error) {
+	for _, step := range rule.Steps {
+		switch step.Op {
+		case RewriteStripPrefix:
+			prefix := step.Value
+			if prefix == "" {
+				prefix = rule.Prefix
+			}
+			if !hasPrefix(key, []byte(prefix)) {
+				return nil, errors.Errorf("key %q doesn't have prefix %s", key, prefix)
+			}
+			key = key[len(prefix)+1:]
+		case RewriteAddPrefix:
+			key = prefixKey([]byte(step.Value), key)
+		case RewriteLittleToBigEndian, RewriteBigToLittleEndian:
+			if len(key) < 8 {
+				return nil, errors.Errorf("key %q is too short to contain an 8 byte integer", key)
+			}
+			converted := make([]byte, len(key))
+			if step.Op == RewriteLittleToBigEndian {
+				binary.BigEndian.PutUint64(converted, binary.LittleEndian.Uint64(key))
+			} else {
+				binary.LittleEndian.PutUint64(converted, binary.BigEndian.Uint64(key))
+			}
+			copy(converted[8:], key[8:])
+			key = converted
+		default:
+			return nil, errors.Errorf("unsupported op '%s'", step.Op)
+		}
+	}
+	return key, nil
+}
+
+// ExtractPrefixes copies the keys with the given prefixes from the IAVL tree in app.db at the given
+// height (zero for the latest) to a separate LevelDB, keys with a prefix that has a rule are
+// rewritten using that rule, other keys are copied as is. Values are always copied as is.
+// Returns the number of keys copied, or if the copy fails the number of keys written before the
+// failure.
+func ExtractPrefixes(
+	srcDBPath, destDBPath string, prefixes []string, rules *KeyRewriteRules,
+	height int64, batchSize, logLevel uint64, workers int,
+) (uint64, error) {
+	if len(prefixes) == 0 {
+		return 0, errors.New("no prefixes specified")
+	}
+	appDb, err := openReadOnlyDB(srcDBPath)
+	if err != nil {
+		return 0, err
+	}
+	defer appDb.Close()
+	tree := iavl.NewMutableTree(appDb, 0)
+	if _, err := tree.LoadVersion(height); err != nil {
+		return 0, errors.Wrap(err, "cannot load appdb tree")
+	}
+	log.Printf("extract prefixes %v at height %d", prefixes, tree.Version())
+
+	destDB, err := openDestDB(destDBPath, int(batchSize))
+	if err != nil {
+		return 0, err
+	}
+
+	leaves := uint(tree.Size())
+	log.Printf("Source app.db size %v data values", leaves)
+
+	startTime := time.Now()
+	numKeys := uint64(0)
+	progressInterval := uint64(0)
+	if logLevel > 0 {
+		progressInterval = uint64(leaves / uint(math.Pow(10, float64(logLevel))))
+	}
+	for _, prefix := range prefixes {
+		rule := rules.ruleFor(prefix)
+		start := prefixKey([]byte(prefix), nil)
+		err := iterateTree(tree.ImmutableTree, start, prefixRangeEnd(start), workers, false, func(kvs []kvPair) error {
+			for _, kv := range kvs {
+				key := kv.key
+				if rule != nil {
+					var err error
+					if key, err = rule.Rewrite(key); err != nil {
+						return err
+					}
+				}
+				if err := destDB.Put(key, kv.value); err != nil {
+					return err
+				}
+				numKeys++
+				if progressInterval > 0 && numKeys%progressInterval == 0 {
+					log.Println(numKeys, "keys processed: current key", string(kv.key))
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			if abortErr := destDB.Abort(); abortErr != nil {
+				log.Println("failed to abort extraction", "err", abortErr)
+			}
+			return destDB.NumKeysWritten(), err
+		}
+		log.Println("finished extracting", prefix)
+	}
+	if err := destDB.Commit(); err != nil {
+		return destDB.NumKeysWritten(), err
+	}
+
+	elapsed := time.Since(startTime).Seconds()
+	log.Printf("copy succesful, time taken %v seconds, %v keys copied\n", elapsed, numKeys)
+	return numKeys, nil
+}
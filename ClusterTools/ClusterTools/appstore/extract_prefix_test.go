@@ -0,0 +1,89 @@
+package appstore
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/tendermint/iavl"
+	"github.com/tendermint/tendermint/libs/db"
+)
+
+func TestExtractPrefixes(t *testing.T) {
+	_ = os.RemoveAll("./tempExtractPrefixApp.db")
+	_ = os.RemoveAll("./tempExtractPrefixDest.db")
+	defer os.RemoveAll("./tempExtractPrefixApp.db")
+	defer os.RemoveAll("./tempExtractPrefixDest.db")
+
+	srcDB, err := db.NewGoLevelDB("tempExtractPrefixApp", ".")
+	require.NoError(t, err)
+	tree := iavl.NewMutableTree(srcDB, 0)
+	heightLE := make([]byte, 8)
+	for height := uint64(1); height <= 300; height++ {
+		binary.LittleEndian.PutUint64(heightLE, height)
+		tree.Set(prefixKey([]byte("bloomFilter"), heightLE), []byte{byte(height)})
+	}
+	tree.Set([]byte("bloomFilterz"), []byte("not a bloom filter"))
+	tree.Set(prefixKey([]byte("contract"), []byte("owner")), []byte("alice"))
+	tree.Set(prefixKey([]byte("contract"), []byte("supply")), []byte("100"))
+	tree.Set(prefixKey([]byte("other"), []byte("key")), []byte("value"))
+	_, _, err = tree.SaveVersion()
+	require.NoError(t, err)
+	srcDB.Close()
+
+	rulesJSON := `{
+		"rules": [
+			{
+				"prefix": "bloomFilter",
+				"steps": [{"op": "strip-prefix"}, {"op": "le-to-be"}, {"op": "add-prefix", "value": "bf"}]
+			},
+			{"prefix": "contract", "steps": [{"op": "strip-prefix"}, {"op": "add-prefix", "value": "c"}]},
+			{"prefix": "vm", "steps": []}
+		]
+	}`
+	require.NoError(t, ioutil.WriteFile("./tempRules.json", []byte(rulesJSON), 0644))
+	defer os.Remove("./tempRules.json")
+	rules, err := LoadKeyRewriteRules("./tempRules.json")
+	require.NoError(t, err)
+	require.Equal(t, []string{"bloomFilter", "contract", "vm"}, rules.Prefixes())
+
+	numKeys, err := ExtractPrefixes(
+		"./tempExtractPrefixApp.db", "./tempExtractPrefixDest.db", rules.Prefixes(), rules, 0, 50, 0, 2,
+	)
+	require.NoError(t, err)
+	require.Equal(t, uint64(302), numKeys)
+
+	destDB, err := leveldb.OpenFile("./tempExtractPrefixDest.db", nil)
+	require.NoError(t, err)
+	defer destDB.Close()
+	numDestKeys := 0
+	it := destDB.NewIterator(nil, nil)
+	defer it.Release()
+	for it.Next() {
+		numDestKeys++
+	}
+	require.Equal(t, 302, numDestKeys)
+	for height := uint64(1); height <= 300; height++ {
+		binary.LittleEndian.PutUint64(heightLE, height)
+		// the keys must be rewritten in the same way as the ones extracted by CopyEvmAuxiliary
+		key, err := formatPrefixes(prefixKey([]byte("bloomFilter"), heightLE), []byte("bloomFilter"), []byte("bf"))
+		require.NoError(t, err)
+		value, err := destDB.Get(key, nil)
+		require.NoError(t, err)
+		require.Equal(t, []byte{byte(height)}, value)
+	}
+	value, err := destDB.Get(prefixKey([]byte("c"), []byte("owner")), nil)
+	require.NoError(t, err)
+	require.Equal(t, []byte("alice"), value)
+
+	// le-to-be can't be applied to keys that are too short
+	rule := &KeyRewriteRule{Prefix: "contract", Steps: []KeyRewriteStep{{Op: RewriteStripPrefix}, {Op: RewriteLittleToBigEndian}}}
+	_, err = rule.Rewrite(prefixKey([]byte("contract"), []byte("owner")))
+	require.Error(t, err)
+
+	invalidRules := &KeyRewriteRules{Rules: []KeyRewriteRule{{Prefix: "vm", Steps: []KeyRewriteStep{{Op: "reverse"}}}}}
+	require.Error(t, invalidRules.validate())
+}
@@ -0,0 +1,99 @@
+package appstore
+
+import (
+	"encoding/binary"
+
+	"github.com/pkg/errors"
+	amino "github.com/tendermint/go-amino"
+)
+
+// Prefixes of the raw keys the IAVL node DB writes to app.db.
+const (
+	iavlNodePrefix   = byte('n') // n<hash>
+	iavlOrphanPrefix = byte('o') // o<last-version><first-version><hash>
+	iavlRootPrefix   = byte('r') // r<version>
+
+	// size of the node hashes used by IAVL (tmhash)
+	hashSize = 32
+)
+
+func iavlNodeKey(hash []byte) []byte {
+	return append([]byte{iavlNodePrefix}, hash...)
+}
+
+func iavlRootKey(version int64) []byte {
+	key := make([]byte, 9)
+	key[0] = iavlRootPrefix
+	binary.BigEndian.PutUint64(key[1:], uint64(version))
+	return key
+}
+
+// iavlNode is the subset of a persisted IAVL node needed to walk the tree without loading it
+// through the iavl package.
+type iavlNode struct {
+	height    int8
+	size      int64
+	version   int64
+	key       []byte
+	value     []byte
+	leftHash  []byte
+	rightHash []byte
+}
+
+func (n *iavlNode) isLeaf() bool {
+	return n.height == 0
+}
+
+// decodeIAVLNode decodes a node stored under an n<hash> key, the layout matches iavl.MakeNode.
+func decodeIAVLNode(buf []byte) (*iavlNode, error) {
+	height, n, err := amino.DecodeInt8(buf)
+	if err != nil {
+		return nil, errors.Wrap(err, "decoding node.height")
+	}
+	buf = buf[n:]
+
+	size, n, err := amino.DecodeVarint(buf)
+	if err != nil {
+		return nil, errors.Wrap(err, "decoding node.size")
+	}
+	buf = buf[n:]
+
+	version, n, err := amino.DecodeVarint(buf)
+	if err != nil {
+		return nil, errors.Wrap(err, "decoding node.version")
+	}
+	buf = buf[n:]
+
+	key, n, err := amino.DecodeByteSlice(buf)
+	if err != nil {
+		return nil, errors.Wrap(err, "decoding node.key")
+	}
+	buf = buf[n:]
+
+	node := &iavlNode{
+		height:  height,
+		size:    size,
+		version: version,
+		key:     key,
+	}
+	if node.isLeaf() {
+		value, _, err := amino.DecodeByteSlice(buf)
+		if err != nil {
+			return nil, errors.Wrap(err, "decoding node.value")
+		}
+		node.value = value
+		return node, nil
+	}
+
+	node.leftHash, n, err = amino.DecodeByteSlice(buf)
+	if err != nil {
+		return nil, errors.Wrap(err, "decoding node.leftHash")
+	}
+	buf = buf[n:]
+
+	node.rightHash, _, err = amino.DecodeByteSlice(buf)
+	if err != nil {
+		return nil, errors.Wrap(err, "decoding node.rightHash")
+	}
+	return node, nil
+}
@@ -0,0 +1,12 @@
+package appstore
+
+import (
+	"github.com/dappchain/clusterkit/nodeguard"
+)
+
+// CheckDBNotInUse returns a nodeguard.NodeRunningError if the IAVL store DB at dbPath is locked by
+// another process, the process in pidFile (if any) is alive, or the RPC listen address in
+// config/config.toml in chainDataDir (if any) accepts connections.
+func CheckDBNotInUse(dbPath, pidFile, chainDataDir string) error {
+	return nodeguard.CheckDBs([]string{dbPath}, pidFile, chainDataDir)
+}
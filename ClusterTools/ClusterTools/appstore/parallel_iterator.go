@@ -0,0 +1,112 @@
+package appstore
+
+import (
+	"sync"
+
+	"github.com/tendermint/iavl"
+)
+
+// Number of key/value pairs each worker sends to the consumer at a time.
+const parallelIteratorChunkSize = 1000
+
+type keyRange struct {
+	start []byte
+	end   []byte
+}
+
+// splitTreeRange splits the [start, end) range of the given tree into at most n disjoint ranges
+// that contain roughly the same number of keys, nil start or end means the range is unbounded on
+// that side.
+func splitTreeRange(tree *iavl.ImmutableTree, start, end []byte, n int) []keyRange {
+	// Get returns the index the key has, or would have, in the tree
+	first := int64(0)
+	if start != nil {
+		first, _ = tree.Get(start)
+	}
+	last := tree.Size()
+	if end != nil {
+		last, _ = tree.Get(end)
+	}
+	count := last - first
+
+	ranges := []keyRange{}
+	rangeStart := start
+	if n > 1 && count > int64(n) {
+		for i := 1; i < n; i++ {
+			splitKey, _ := tree.GetByIndex(first + (count*int64(i))/int64(n))
+			ranges = append(ranges, keyRange{start: rangeStart, end: splitKey})
+			rangeStart = splitKey
+		}
+	}
+	return append(ranges, keyRange{start: rangeStart, end: end})
+}
+
+// iterateTree walks the keys in the [start, end) range of the given tree using the given number of
+// workers, each worker walks a separate part of the range. The keys & values are passed to fn in
+// chunks, fn is only ever called from one goroutine at a time so it doesn't need to be thread-safe.
+// If ordered is true the chunks are passed to fn in ascending key order, otherwise they're passed to
+// fn in whatever order the workers produce them, which keeps all the workers busy.
+// If fn returns an error the iteration is stopped and the error is returned.
+func iterateTree(
+	tree *iavl.ImmutableTree, start, end []byte, workers int, ordered bool, fn func(kvs []kvPair) error,
+) error {
+	ranges := splitTreeRange(tree, start, end, workers)
+	done := make(chan struct{})
+	unordered := make(chan []kvPair, len(ranges))
+	chunks := make([]chan []kvPair, len(ranges))
+	var wg sync.WaitGroup
+	for i, r := range ranges {
+		chunks[i] = unordered
+		if ordered {
+			chunks[i] = make(chan []kvPair, 4)
+		}
+		wg.Add(1)
+		go func(r keyRange, out chan []kvPair) {
+			defer wg.Done()
+			if ordered {
+				defer close(out)
+			}
+			chunk := make([]kvPair, 0, parallelIteratorChunkSize)
+			send := func() bool {
+				select {
+				case out <- chunk:
+					chunk = make([]kvPair, 0, parallelIteratorChunkSize)
+					return true
+				case <-done:
+					return false
+				}
+			}
+			stopped := tree.IterateRange(r.start, r.end, true, func(key, value []byte) bool {
+				chunk = append(chunk, kvPair{key: key, value: value})
+				if len(chunk) >= parallelIteratorChunkSize {
+					return !send()
+				}
+				return false
+			})
+			if !stopped && len(chunk) > 0 {
+				send()
+			}
+		}(r, chunks[i])
+	}
+	if !ordered {
+		go func() {
+			wg.Wait()
+			close(unordered)
+		}()
+		chunks = chunks[:1]
+	}
+
+	var err error
+	for _, ch := range chunks {
+		// keep draining the channels after an error so the workers can exit
+		for kvs := range ch {
+			if err == nil {
+				if err = fn(kvs); err != nil {
+					close(done)
+				}
+			}
+		}
+	}
+	wg.Wait()
+	return err
+}
@@ -0,0 +1,107 @@
+package appstore
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/tendermint/iavl"
+	"github.com/tendermint/tendermint/libs/db"
+)
+
+func makeParallelTestTree(t *testing.T, numKeys int) *iavl.ImmutableTree {
+	tree := iavl.NewMutableTree(db.NewMemDB(), 0)
+	for i := 0; i < numKeys; i++ {
+		tree.Set([]byte(fmt.Sprintf("key%05d", i)), []byte(fmt.Sprintf("value%d", i)))
+	}
+	_, _, err := tree.SaveVersion()
+	require.NoError(t, err)
+	return tree.ImmutableTree
+}
+
+func TestIterateTree(t *testing.T) {
+	tree := makeParallelTestTree(t, 5000)
+
+	ranges := splitTreeRange(tree, []byte("key01000"), []byte("key04000"), 4)
+	require.Equal(t, 4, len(ranges))
+	require.Equal(t, []byte("key01000"), ranges[0].start)
+	require.Equal(t, []byte("key01750"), ranges[1].start)
+	require.Equal(t, []byte("key04000"), ranges[3].end)
+	for i := 1; i < len(ranges); i++ {
+		require.Equal(t, ranges[i-1].end, ranges[i].start)
+	}
+	// there's no point splitting a range with fewer keys than workers
+	require.Equal(t, 1, len(splitTreeRange(tree, []byte("key00001"), []byte("key00003"), 4)))
+
+	var serial []kvPair
+	tree.IterateRange([]byte("key00100"), []byte("key04900"), true, func(key, value []byte) bool {
+		serial = append(serial, kvPair{key: key, value: value})
+		return false
+	})
+	for _, workers := range []int{1, 3, 8} {
+		var ordered []kvPair
+		require.NoError(t, iterateTree(tree, []byte("key00100"), []byte("key04900"), workers, true, func(kvs []kvPair) error {
+			ordered = append(ordered, kvs...)
+			return nil
+		}))
+		require.Equal(t, serial, ordered)
+
+		unordered := map[string]string{}
+		require.NoError(t, iterateTree(tree, []byte("key00100"), []byte("key04900"), workers, false, func(kvs []kvPair) error {
+			for _, kv := range kvs {
+				unordered[string(kv.key)] = string(kv.value)
+			}
+			return nil
+		}))
+		require.Equal(t, len(serial), len(unordered))
+		for _, kv := range serial {
+			require.Equal(t, string(kv.value), unordered[string(kv.key)])
+		}
+	}
+
+	// an error returned by the callback stops all the workers
+	numCalls := 0
+	err := iterateTree(tree, nil, nil, 4, false, func(kvs []kvPair) error {
+		numCalls++
+		return errors.New("write failed")
+	})
+	require.EqualError(t, err, "write failed")
+	require.Equal(t, 1, numCalls)
+}
+
+func TestExtractIAVLTreeValuesWithWorkers(t *testing.T) {
+	_ = os.RemoveAll("./tempExtractSrc.db")
+	defer os.RemoveAll("./tempExtractSrc.db")
+	srcDB, err := db.NewGoLevelDB("tempExtractSrc", ".")
+	require.NoError(t, err)
+	tree := iavl.NewMutableTree(srcDB, 0)
+	for i := 0; i < 3000; i++ {
+		tree.Set([]byte(fmt.Sprintf("key%05d", i)), []byte(fmt.Sprintf("value%d", i)))
+	}
+	_, _, err = tree.SaveVersion()
+	require.NoError(t, err)
+	srcDB.Close()
+
+	extract := func(destDBPath string, workers int) map[string]string {
+		_ = os.RemoveAll(destDBPath)
+		require.NoError(t, ExtractIAVLTreeValuesFromDB("./tempExtractSrc.db", destDBPath, 0, 0, 100, workers))
+		destDB, err := leveldb.OpenFile(destDBPath, nil)
+		require.NoError(t, err)
+		defer destDB.Close()
+		kvs := map[string]string{}
+		it := destDB.NewIterator(nil, nil)
+		defer it.Release()
+		for it.Next() {
+			kvs[string(it.Key())] = string(it.Value())
+		}
+		return kvs
+	}
+	defer os.RemoveAll("./tempExtractSerial.db")
+	defer os.RemoveAll("./tempExtractParallel.db")
+	serial := extract("./tempExtractSerial.db", 1)
+	require.Equal(t, 3001, len(serial))
+	require.Equal(t, serial, extract("./tempExtractParallel.db", 4))
+}
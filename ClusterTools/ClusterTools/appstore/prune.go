@@ -0,0 +1,176 @@
+package appstore
+
+import (
+	"encoding/binary"
+	"fmt"
+	"log"
+	"math"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/syndtr/goleveldb/leveldb/util"
+	"github.com/tendermint/iavl"
+	"github.com/tendermint/tendermint/libs/db"
+)
+
+// IAVLPruneStats describes the versions, nodes & bytes removed (or that would be removed in a dry
+// run) by PruneIAVLVersions.
+type IAVLPruneStats struct {
+	NumVersions   uint64
+	LatestVersion int64
+	// Versions that will be deleted
+	PrunedVersions []VersionRange
+	// Versions that will remain in the DB
+	KeptVersions []VersionRange
+	// Number of orphaned nodes that will be deleted
+	NumNodes uint64
+	// Bytes used by the deleted nodes, orphan & root entries
+	NumBytes  uint64
+	TimeTaken time.Duration
+}
+
+// PruneIAVLVersions deletes old IAVL tree versions and the nodes that are only referenced by those
+// versions from app.db. The keepRecent most recent versions are kept, as well as every version
+// that's a multiple of keepEvery (if keepEvery is non-zero). If dryRun is true nothing is deleted,
+// but the returned stats still describe what would be deleted.
+func PruneIAVLVersions(
+	dbPath string, keepRecent, keepEvery int64, dryRun, skipCompaction bool, logLevel uint64,
+) (*IAVLPruneStats, error) {
+	if keepRecent < 1 {
+		return nil, errors.New("at least one recent version must be kept")
+	}
+
+	var appDb *db.GoLevelDB
+	var err error
+	if dryRun {
+		appDb, err = openReadOnlyDB(dbPath)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		dbName := strings.TrimSuffix(path.Base(dbPath), ".db")
+		dbDir := path.Dir(dbPath)
+		appDb, err = db.NewGoLevelDB(dbName, dbDir)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to open %v", dbPath)
+		}
+	}
+	defer appDb.Close()
+
+	startTime := time.Now()
+	stats, pruned, err := planIAVLPrune(appDb, keepRecent, keepEvery)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf(
+		"%d of %d versions, %d nodes and %d bytes to prune",
+		len(pruned), stats.NumVersions, stats.NumNodes, stats.NumBytes,
+	)
+	if dryRun || len(pruned) == 0 {
+		stats.TimeTaken = time.Since(startTime)
+		return stats, nil
+	}
+
+	tree := iavl.NewMutableTree(appDb, 0)
+	if _, err := tree.Load(); err != nil {
+		return nil, errors.Wrap(err, "failed to load IAVL tree")
+	}
+
+	var progressInterval int
+	if logLevel > 0 {
+		progressInterval = int(float64(len(pruned)) / math.Pow(10, float64(logLevel)))
+	}
+	// Each deleted version is committed to the DB in a separate batch.
+	for i, version := range pruned {
+		if err := tree.DeleteVersion(version); err != nil {
+			return nil, errors.Wrapf(err, "failed to delete version %d after deleting %d versions", version, i)
+		}
+		if progressInterval > 0 && (i+1)%progressInterval == 0 {
+			log.Printf("%d versions deleted: %v%% done, current version %d", i+1, (100*(i+1))/len(pruned), version)
+		}
+	}
+	log.Printf("deleted %d versions in %v", len(pruned), time.Since(startTime))
+
+	if !skipCompaction {
+		if err := appDb.DB().CompactRange(util.Range{}); err != nil {
+			return nil, fmt.Errorf("failed to compact db, %s", err.Error())
+		}
+		log.Println("finished DB compaction")
+	}
+	stats.TimeTaken = time.Since(startTime)
+	return stats, nil
+}
+
+// planIAVLPrune works out which versions should be pruned and how many orphaned nodes would be
+// deleted along with them. An orphan lives from the version it was first saved at until the last
+// version it belonged to, so it can be deleted once none of the kept versions fall in that range.
+func planIAVLPrune(appDb db.DB, keepRecent, keepEvery int64) (*IAVLPruneStats, []int64, error) {
+	stats := &IAVLPruneStats{}
+	var versions []int64
+	it := appDb.Iterator([]byte{iavlRootPrefix}, []byte{iavlRootPrefix + 1})
+	for ; it.Valid(); it.Next() {
+		if len(it.Key()) != 9 {
+			continue
+		}
+		versions = append(versions, int64(binary.BigEndian.Uint64(it.Key()[1:])))
+	}
+	it.Close()
+	if len(versions) == 0 {
+		return nil, nil, errors.New("no IAVL tree versions found")
+	}
+	stats.NumVersions = uint64(len(versions))
+	stats.LatestVersion = versions[len(versions)-1]
+
+	// keep the most recent versions that exist, there may be gaps between them from earlier prunes
+	recentStart := len(versions) - int(keepRecent)
+	var pruned, kept []int64
+	for i, version := range versions {
+		if i >= recentStart || (keepEvery > 0 && version%keepEvery == 0) {
+			kept = append(kept, version)
+		} else {
+			pruned = append(pruned, version)
+			stats.NumBytes += uint64(len(iavlRootKey(version)) + len(appDb.Get(iavlRootKey(version))))
+		}
+	}
+	stats.PrunedVersions = toVersionRanges(pruned)
+	stats.KeptVersions = toVersionRanges(kept)
+	if len(pruned) == 0 {
+		return stats, nil, nil
+	}
+
+	it = appDb.Iterator([]byte{iavlOrphanPrefix}, []byte{iavlOrphanPrefix + 1})
+	defer it.Close()
+	for ; it.Valid(); it.Next() {
+		key := it.Key()
+		if len(key) != 1+8+8+hashSize {
+			continue
+		}
+		toVersion := int64(binary.BigEndian.Uint64(key[1:9]))
+		fromVersion := int64(binary.BigEndian.Uint64(key[9:17]))
+		// find the first kept version that's not older than the orphan
+		i := sort.Search(len(kept), func(i int) bool { return kept[i] >= fromVersion })
+		if i < len(kept) && kept[i] <= toVersion {
+			continue
+		}
+		nodeKey := iavlNodeKey(key[17:])
+		stats.NumNodes++
+		stats.NumBytes += uint64(len(key) + len(it.Value()) + len(nodeKey) + len(appDb.Get(nodeKey)))
+	}
+	return stats, pruned, nil
+}
+
+// toVersionRanges collapses a sorted list of versions into ranges of consecutive versions.
+func toVersionRanges(versions []int64) []VersionRange {
+	var ranges []VersionRange
+	for _, version := range versions {
+		if n := len(ranges); n > 0 && ranges[n-1].To+1 == version {
+			ranges[n-1].To = version
+			continue
+		}
+		ranges = append(ranges, VersionRange{From: version, To: version})
+	}
+	return ranges
+}
@@ -0,0 +1,89 @@
+package appstore
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tendermint/iavl"
+	"github.com/tendermint/tendermint/libs/db"
+)
+
+func TestPruneIAVLVersions(t *testing.T) {
+	_ = os.RemoveAll("./tempPrune.db")
+	defer os.RemoveAll("./tempPrune.db")
+
+	tempDB, err := db.NewGoLevelDB("tempPrune", ".")
+	require.NoError(t, err)
+	tree := iavl.NewMutableTree(tempDB, 0)
+	_, err = tree.Load()
+	require.NoError(t, err)
+	for version := 1; version <= 10; version++ {
+		for i := 0; i < 20; i++ {
+			tree.Set([]byte(fmt.Sprintf("key%d", i*version)), []byte(fmt.Sprintf("value%d", version)))
+		}
+		_, _, err = tree.SaveVersion()
+		require.NoError(t, err)
+	}
+	hashes := map[int64][]byte{}
+	for _, version := range []int64{4, 8, 9, 10} {
+		immutableTree, err := tree.GetImmutable(version)
+		require.NoError(t, err)
+		hashes[version] = immutableTree.Hash()
+	}
+	tempDB.Close()
+
+	before, err := AnalyzeIAVLStorage("./tempPrune.db", false, 0)
+	require.NoError(t, err)
+
+	_, err = PruneIAVLVersions("./tempPrune.db", 0, 0, true, true, 0)
+	require.Error(t, err)
+
+	plan, err := PruneIAVLVersions("./tempPrune.db", 2, 4, true, true, 0)
+	require.NoError(t, err)
+	require.Equal(t, uint64(10), plan.NumVersions)
+	require.Equal(t, []VersionRange{{1, 3}, {5, 7}}, plan.PrunedVersions)
+	require.Equal(t, []VersionRange{{4, 4}, {8, 10}}, plan.KeptVersions)
+	require.True(t, plan.NumNodes > 0)
+
+	// dry run shouldn't change anything
+	after, err := AnalyzeIAVLStorage("./tempPrune.db", false, 0)
+	require.NoError(t, err)
+	require.Equal(t, before.Nodes, after.Nodes)
+
+	stats, err := PruneIAVLVersions("./tempPrune.db", 2, 4, false, false, 1)
+	require.NoError(t, err)
+	require.Equal(t, plan.NumNodes, stats.NumNodes)
+	require.Equal(t, plan.NumBytes, stats.NumBytes)
+
+	after, err = AnalyzeIAVLStorage("./tempPrune.db", false, 0)
+	require.NoError(t, err)
+	require.Equal(t, uint64(4), after.NumVersions)
+	require.Equal(t, before.Nodes.NumKeys-plan.NumNodes, after.Nodes.NumKeys)
+	require.Equal(t, before.TotalBytes()-plan.NumBytes, after.TotalBytes())
+
+	// the 4 most recent versions are kept even though there are gaps between them
+	plan, err = PruneIAVLVersions("./tempPrune.db", 4, 0, true, true, 0)
+	require.NoError(t, err)
+	require.Empty(t, plan.PrunedVersions)
+	require.Equal(t, []VersionRange{{4, 4}, {8, 10}}, plan.KeptVersions)
+	plan, err = PruneIAVLVersions("./tempPrune.db", 3, 0, true, true, 0)
+	require.NoError(t, err)
+	require.Equal(t, []VersionRange{{4, 4}}, plan.PrunedVersions)
+	require.Equal(t, []VersionRange{{8, 10}}, plan.KeptVersions)
+
+	tempDB, err = db.NewGoLevelDB("tempPrune", ".")
+	require.NoError(t, err)
+	defer tempDB.Close()
+	tree = iavl.NewMutableTree(tempDB, 0)
+	_, err = tree.Load()
+	require.NoError(t, err)
+	for version, hash := range hashes {
+		immutableTree, err := tree.GetImmutable(version)
+		require.NoError(t, err)
+		require.Equal(t, hash, immutableTree.Hash())
+		// make sure none of the nodes needed by the kept versions were deleted
+		immutableTree.Iterate(func(key, value []byte) bool { return false })
+	}
+}
@@ -0,0 +1,144 @@
+package appstore
+
+import (
+	"encoding/binary"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/tendermint/tendermint/libs/db"
+)
+
+// IAVLRollbackStats describes the versions, nodes & orphans removed by RollbackIAVLTree.
+type IAVLRollbackStats struct {
+	LatestVersion int64  `json:"latestVersion"`
+	TargetVersion int64  `json:"targetVersion"`
+	NumVersions   uint64 `json:"numVersions"`
+	NumNodes      uint64 `json:"numNodes"`
+	NumOrphans    uint64 `json:"numOrphans"`
+}
+
+// LatestIAVLVersion returns the latest IAVL tree version saved to app.db, or zero if there are no
+// versions in the DB.
+func LatestIAVLVersion(dbPath string) (int64, error) {
+	appDb, err := openReadOnlyDB(dbPath)
+	if err != nil {
+		return 0, err
+	}
+	defer appDb.Close()
+	return latestIAVLVersion(appDb), nil
+}
+
+func latestIAVLVersion(appDb db.DB) int64 {
+	it := appDb.ReverseIterator([]byte{iavlRootPrefix}, []byte{iavlRootPrefix + 1})
+	defer it.Close()
+	for ; it.Valid(); it.Next() {
+		if len(it.Key()) == 9 {
+			return int64(binary.BigEndian.Uint64(it.Key()[1:]))
+		}
+	}
+	return 0
+}
+
+// RollbackIAVLTree deletes all the IAVL tree versions newer than the target version from app.db,
+// along with the nodes created by those versions, so that the target version becomes the latest
+// version. Nodes from older versions that were orphaned by the deleted versions become part of the
+// latest tree again, so their orphan entries are deleted too. All the changes are written to the DB
+// in a single batch.
+func RollbackIAVLTree(dbPath string, targetVersion int64) (*IAVLRollbackStats, error) {
+	dbName := strings.TrimSuffix(path.Base(dbPath), ".db")
+	dbDir := path.Dir(dbPath)
+	appDb, err := db.NewGoLevelDB(dbName, dbDir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open %v", dbPath)
+	}
+	defer appDb.Close()
+
+	stats := &IAVLRollbackStats{
+		LatestVersion: latestIAVLVersion(appDb),
+		TargetVersion: targetVersion,
+	}
+	if stats.LatestVersion < targetVersion {
+		return nil, errors.Errorf(
+			"can't roll back app.db to version %d, latest version is %d", targetVersion, stats.LatestVersion,
+		)
+	}
+	if stats.LatestVersion == targetVersion {
+		return stats, nil
+	}
+	if !appDb.Has(iavlRootKey(targetVersion)) {
+		return nil, errors.Errorf("version %d doesn't exist in app.db", targetVersion)
+	}
+
+	batch := appDb.NewBatch()
+	deleted := map[string]bool{}
+	deleteNode := func(hash []byte) {
+		if !deleted[string(hash)] {
+			deleted[string(hash)] = true
+			batch.Delete(iavlNodeKey(hash))
+			stats.NumNodes++
+		}
+	}
+
+	// Walk each newer version down to the nodes that already existed in the target version, any
+	// node with a newer version can only be referenced by the versions being deleted.
+	it := appDb.Iterator(iavlRootKey(targetVersion+1), []byte{iavlRootPrefix + 1})
+	for ; it.Valid(); it.Next() {
+		if len(it.Key()) != 9 {
+			continue
+		}
+		batch.Delete(it.Key())
+		stats.NumVersions++
+		pending := [][]byte{}
+		if len(it.Value()) > 0 {
+			pending = append(pending, it.Value())
+		}
+		for len(pending) > 0 {
+			hash := pending[len(pending)-1]
+			pending = pending[:len(pending)-1]
+			if deleted[string(hash)] {
+				continue
+			}
+			buf := appDb.Get(iavlNodeKey(hash))
+			if buf == nil {
+				it.Close()
+				return nil, errors.Errorf("node %X not found", hash)
+			}
+			node, err := decodeIAVLNode(buf)
+			if err != nil {
+				it.Close()
+				return nil, errors.Wrapf(err, "failed to decode node %X", hash)
+			}
+			if node.version <= targetVersion {
+				continue
+			}
+			deleteNode(hash)
+			if !node.isLeaf() {
+				pending = append(pending, node.rightHash, node.leftHash)
+			}
+		}
+	}
+	it.Close()
+
+	// Orphans are keyed by the last version they were part of, so any orphan that was still part of
+	// the target version (or a later one) has to be either deleted or brought back into the tree.
+	orphanStart := make([]byte, 9)
+	orphanStart[0] = iavlOrphanPrefix
+	binary.BigEndian.PutUint64(orphanStart[1:], uint64(targetVersion))
+	it = appDb.Iterator(orphanStart, []byte{iavlOrphanPrefix + 1})
+	defer it.Close()
+	for ; it.Valid(); it.Next() {
+		key := it.Key()
+		if len(key) != 1+8+8+hashSize {
+			continue
+		}
+		batch.Delete(key)
+		stats.NumOrphans++
+		fromVersion := int64(binary.BigEndian.Uint64(key[9:17]))
+		if fromVersion > targetVersion {
+			deleteNode(key[17:])
+		}
+	}
+	batch.WriteSync()
+	return stats, nil
+}
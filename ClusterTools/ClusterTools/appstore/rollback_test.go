@@ -0,0 +1,73 @@
+package appstore
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tendermint/iavl"
+	"github.com/tendermint/tendermint/libs/db"
+)
+
+func TestRollbackIAVLTree(t *testing.T) {
+	for _, dir := range []string{"./tempRollback.db", "./tempRollbackExpected.db"} {
+		_ = os.RemoveAll(dir)
+		defer os.RemoveAll(dir)
+	}
+
+	// write the same versions to both DBs, but only write the newer versions to one of them
+	saveVersions := func(dbName string, numVersions int) {
+		tempDB, err := db.NewGoLevelDB(dbName, ".")
+		require.NoError(t, err)
+		defer tempDB.Close()
+		tree := iavl.NewMutableTree(tempDB, 0)
+		_, err = tree.Load()
+		require.NoError(t, err)
+		for version := 1; version <= numVersions; version++ {
+			for i := 0; i < 20; i++ {
+				tree.Set([]byte(fmt.Sprintf("key%d", i*version)), []byte(fmt.Sprintf("value%d", version)))
+			}
+			tree.Remove([]byte(fmt.Sprintf("key%d", version*3)))
+			_, _, err = tree.SaveVersion()
+			require.NoError(t, err)
+		}
+	}
+	saveVersions("tempRollback", 8)
+	saveVersions("tempRollbackExpected", 5)
+
+	latestVersion, err := LatestIAVLVersion("./tempRollback.db")
+	require.NoError(t, err)
+	require.Equal(t, int64(8), latestVersion)
+
+	_, err = RollbackIAVLTree("./tempRollback.db", 9)
+	require.Error(t, err)
+
+	stats, err := RollbackIAVLTree("./tempRollback.db", 5)
+	require.NoError(t, err)
+	require.Equal(t, int64(8), stats.LatestVersion)
+	require.Equal(t, uint64(3), stats.NumVersions)
+	require.True(t, stats.NumNodes > 0)
+	require.True(t, stats.NumOrphans > 0)
+
+	// the rolled back DB should be identical to one that never had the newer versions
+	actualDB, err := openReadOnlyDB("./tempRollback.db")
+	require.NoError(t, err)
+	defer actualDB.Close()
+	expectedDB, err := openReadOnlyDB("./tempRollbackExpected.db")
+	require.NoError(t, err)
+	defer expectedDB.Close()
+	actual := map[string]string{}
+	it := actualDB.Iterator(nil, nil)
+	for ; it.Valid(); it.Next() {
+		actual[string(it.Key())] = string(it.Value())
+	}
+	it.Close()
+	expected := map[string]string{}
+	it = expectedDB.Iterator(nil, nil)
+	for ; it.Valid(); it.Next() {
+		expected[string(it.Key())] = string(it.Value())
+	}
+	it.Close()
+	require.Equal(t, expected, actual)
+}
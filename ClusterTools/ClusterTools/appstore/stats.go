@@ -1,10 +1,13 @@
 package appstore
 
 import (
+	"bytes"
+	"fmt"
 	"log"
 	"math"
 	"path"
 	"runtime"
+	"sort"
 	"strings"
 	"time"
 
@@ -20,13 +23,22 @@ type IAVLStoreStats struct {
 	TimeTaken       time.Duration
 }
 
-func TotalData(dbPath, prefix string, blockNumber int64, logLevel uint64) (IAVLStoreStats, error) {
+func TotalData(dbPath, prefix string, blockNumber int64, logLevel uint64, workers int) (IAVLStoreStats, error) {
+	return totalData(dbPath, prefix, blockNumber, logLevel, workers, nil)
+}
+
+// totalData walks all the keys with the given prefix in the IAVL tree using the given number of
+// workers, and calls fn for each key if it's not nil.
+func totalData(
+	dbPath, prefix string, blockNumber int64, logLevel uint64, workers int, fn func(key, value []byte),
+) (IAVLStoreStats, error) {
 	dbName := strings.TrimSuffix(path.Base(dbPath), ".db")
 	dbDir := path.Dir(dbPath)
 	appDb, err := db.NewGoLevelDB(dbName, dbDir)
 	if err != nil {
 		return IAVLStoreStats{}, errors.Wrapf(err, "failed to open %v", dbPath)
 	}
+	defer appDb.Close()
 
 	tree := iavl.NewMutableTree(appDb, 0)
 	_, err = tree.LoadVersion(blockNumber)
@@ -51,14 +63,14 @@ func TotalData(dbPath, prefix string, blockNumber int64, logLevel uint64) (IAVLS
 	log.Printf("Database of height %v with %v keys", tree.Height(), tree.Size())
 
 	startTime := time.Now()
-	tree.IterateRangeInclusive(
-		start,
-		end,
-		true,
-		func(key, value []byte, version int64) bool {
+	err = iterateTree(tree.ImmutableTree, start, end, workers, false, func(kvs []kvPair) error {
+		for _, kv := range kvs {
 			numKeys++
-			keyTotal += uint64(len(key))
-			valueTotal += uint64(len(value))
+			keyTotal += uint64(len(kv.key))
+			valueTotal += uint64(len(kv.value))
+			if fn != nil {
+				fn(kv.key, kv.value)
+			}
 			if logLevel > 0 && numKeys%debugPeriod == 0 {
 				now := time.Now()
 				elapsed := now.Sub(startTime).Seconds()
@@ -78,10 +90,12 @@ func TotalData(dbPath, prefix string, blockNumber int64, logLevel uint64) (IAVLS
 					memStats.HeapIdle/1000000,
 				)
 			}
-
-			return false
-		},
-	)
+		}
+		return nil
+	})
+	if err != nil {
+		return IAVLStoreStats{}, err
+	}
 
 	return IAVLStoreStats{
 		NumKeys:         numKeys,
@@ -91,6 +105,141 @@ func TotalData(dbPath, prefix string, blockNumber int64, logLevel uint64) (IAVLS
 	}, nil
 }
 
+// PrefixGrouping specifies how TotalDataByPrefix groups keys. If Segments is non-zero keys are
+// grouped by their first Segments segments (as delimited by the zero byte prefixKey inserts between
+// segments), otherwise they're grouped by their first Bytes bytes.
+type PrefixGrouping struct {
+	Bytes    int
+	Segments int
+}
+
+func (g PrefixGrouping) groupPrefix(key []byte) []byte {
+	if g.Segments > 0 {
+		end := 0
+		for i := 0; i < g.Segments; i++ {
+			n := bytes.IndexByte(key[end:], 0)
+			if n < 0 {
+				return key
+			}
+			end += n
+			if i < g.Segments-1 {
+				end++
+			}
+		}
+		return key[:end]
+	}
+	if g.Bytes > 0 && g.Bytes < len(key) {
+		return key[:g.Bytes]
+	}
+	return key
+}
+
+// IAVLStoreGroupStats contains the stats for all the keys that share a prefix.
+type IAVLStoreGroupStats struct {
+	Prefix          []byte
+	NumKeys         uint64
+	TotalKeyBytes   uint64
+	TotalValueBytes uint64
+	MaxValueSize    uint64
+	P50ValueSize    uint64
+	P99ValueSize    uint64
+
+	// number of values of each size, used to compute the percentiles
+	valueSizes map[uint64]uint64
+}
+
+func (s *IAVLStoreGroupStats) TotalBytes() uint64 {
+	return s.TotalKeyBytes + s.TotalValueBytes
+}
+
+// valueSizePercentile returns the smallest value size that's greater or equal to p percent of all
+// the value sizes in the group.
+func (s *IAVLStoreGroupStats) valueSizePercentile(p float64) uint64 {
+	sizes := make([]uint64, 0, len(s.valueSizes))
+	for size := range s.valueSizes {
+		sizes = append(sizes, size)
+	}
+	sort.Slice(sizes, func(i, j int) bool { return sizes[i] < sizes[j] })
+
+	threshold := uint64(math.Ceil(float64(s.NumKeys) * p / 100))
+	count := uint64(0)
+	for _, size := range sizes {
+		count += s.valueSizes[size]
+		if count >= threshold {
+			return size
+		}
+	}
+	return s.MaxValueSize
+}
+
+// Orders in which TotalDataByPrefix can sort groups.
+const (
+	SortGroupsByBytes  = "bytes"
+	SortGroupsByKeys   = "keys"
+	SortGroupsByPrefix = "prefix"
+)
+
+// TotalDataByPrefix walks the IAVL tree once and breaks down the stats returned by TotalData by key
+// prefix. Groups are sorted by the given order, largest first when sorting by bytes or keys.
+func TotalDataByPrefix(
+	dbPath, prefix string, blockNumber int64, logLevel uint64, workers int, grouping PrefixGrouping, sortBy string,
+) ([]*IAVLStoreGroupStats, IAVLStoreStats, error) {
+	if grouping.Bytes <= 0 && grouping.Segments <= 0 {
+		return nil, IAVLStoreStats{}, errors.New("keys must be grouped by a number of bytes or segments")
+	}
+	switch sortBy {
+	case SortGroupsByBytes, SortGroupsByKeys, SortGroupsByPrefix:
+	default:
+		return nil, IAVLStoreStats{}, fmt.Errorf("unsupported sort order '%s'", sortBy)
+	}
+
+	groups := map[string]*IAVLStoreGroupStats{}
+	stats, err := totalData(dbPath, prefix, blockNumber, logLevel, workers, func(key, value []byte) {
+		groupPrefix := grouping.groupPrefix(key)
+		group, ok := groups[string(groupPrefix)]
+		if !ok {
+			group = &IAVLStoreGroupStats{
+				Prefix:     append([]byte(nil), groupPrefix...),
+				valueSizes: map[uint64]uint64{},
+			}
+			groups[string(groupPrefix)] = group
+		}
+		valueSize := uint64(len(value))
+		group.NumKeys++
+		group.TotalKeyBytes += uint64(len(key))
+		group.TotalValueBytes += valueSize
+		if valueSize > group.MaxValueSize {
+			group.MaxValueSize = valueSize
+		}
+		group.valueSizes[valueSize]++
+	})
+	if err != nil {
+		return nil, stats, err
+	}
+
+	result := make([]*IAVLStoreGroupStats, 0, len(groups))
+	for _, group := range groups {
+		group.P50ValueSize = group.valueSizePercentile(50)
+		group.P99ValueSize = group.valueSizePercentile(99)
+		group.valueSizes = nil
+		result = append(result, group)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		switch sortBy {
+		case SortGroupsByBytes:
+			if result[i].TotalBytes() != result[j].TotalBytes() {
+				return result[i].TotalBytes() > result[j].TotalBytes()
+			}
+		case SortGroupsByKeys:
+			if result[i].NumKeys != result[j].NumKeys {
+				return result[i].NumKeys > result[j].NumKeys
+			}
+		}
+		return bytes.Compare(result[i].Prefix, result[j].Prefix) < 0
+	})
+	return result, stats, nil
+}
+
 // todo export form loomchian/store
 // Returns the bytes that mark the end of the key range for the given prefix.
 func prefixRangeEnd(prefix []byte) []byte {
@@ -0,0 +1,62 @@
+package appstore
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tendermint/iavl"
+	"github.com/tendermint/tendermint/libs/db"
+)
+
+func TestTotalDataByPrefix(t *testing.T) {
+	_ = os.RemoveAll("./tempStats.db")
+	defer os.RemoveAll("./tempStats.db")
+
+	tempDB, err := db.NewGoLevelDB("tempStats", ".")
+	require.NoError(t, err)
+	tree := iavl.NewMutableTree(tempDB, 0)
+	_, err = tree.Load()
+	require.NoError(t, err)
+	for i := 1; i <= 100; i++ {
+		tree.Set(prefixKey([]byte("vm"), []byte(fmt.Sprintf("%03d", i))), make([]byte, i))
+	}
+	tree.Set(prefixKey([]byte("contract"), []byte("a"), []byte("1")), []byte("value"))
+	tree.Set(prefixKey([]byte("contract"), []byte("b"), []byte("1")), []byte("value"))
+	tree.Set([]byte("nodelimiter"), []byte("value"))
+	_, _, err = tree.SaveVersion()
+	require.NoError(t, err)
+	tempDB.Close()
+
+	groups, stats, err := TotalDataByPrefix("./tempStats.db", "", 0, 0, 1, PrefixGrouping{Segments: 1}, SortGroupsByBytes)
+	require.NoError(t, err)
+	require.Equal(t, uint64(103), stats.NumKeys)
+	require.Len(t, groups, 3)
+	require.Equal(t, []byte("vm"), groups[0].Prefix)
+	require.Equal(t, uint64(100), groups[0].NumKeys)
+	require.Equal(t, uint64(100*6), groups[0].TotalKeyBytes)
+	require.Equal(t, uint64(5050), groups[0].TotalValueBytes)
+	require.Equal(t, uint64(100), groups[0].MaxValueSize)
+	require.Equal(t, uint64(50), groups[0].P50ValueSize)
+	require.Equal(t, uint64(99), groups[0].P99ValueSize)
+	require.Equal(t, []byte("contract"), groups[1].Prefix)
+	require.Equal(t, uint64(2), groups[1].NumKeys)
+	require.Equal(t, []byte("nodelimiter"), groups[2].Prefix)
+
+	groups, _, err = TotalDataByPrefix("./tempStats.db", "contract", 0, 0, 1, PrefixGrouping{Segments: 2}, SortGroupsByPrefix)
+	require.NoError(t, err)
+	require.Len(t, groups, 2)
+	require.Equal(t, []byte("contract\x00a"), groups[0].Prefix)
+	require.Equal(t, []byte("contract\x00b"), groups[1].Prefix)
+
+	groups, _, err = TotalDataByPrefix("./tempStats.db", "", 0, 0, 1, PrefixGrouping{Bytes: 1}, SortGroupsByKeys)
+	require.NoError(t, err)
+	require.Len(t, groups, 3)
+	require.Equal(t, []byte("v"), groups[0].Prefix)
+	require.Equal(t, []byte("c"), groups[1].Prefix)
+	require.Equal(t, []byte("n"), groups[2].Prefix)
+
+	_, _, err = TotalDataByPrefix("./tempStats.db", "", 0, 0, 1, PrefixGrouping{}, SortGroupsByKeys)
+	require.Error(t, err)
+}
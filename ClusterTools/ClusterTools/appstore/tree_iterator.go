@@ -0,0 +1,66 @@
+package appstore
+
+import (
+	"github.com/tendermint/iavl"
+)
+
+type kvPair struct {
+	key   []byte
+	value []byte
+}
+
+// treeIterator turns the callback based iteration of an IAVL tree into a pull based iterator, which
+// makes it possible to walk multiple trees in lockstep. The tree is walked in a separate goroutine
+// so Close must be called if the iterator isn't drained.
+type treeIterator struct {
+	kvs     chan kvPair
+	done    chan struct{}
+	current kvPair
+	valid   bool
+}
+
+// newTreeIterator returns an iterator over the keys in the [start, end) range of the given tree in
+// ascending order, nil start or end means the range is unbounded on that side.
+func newTreeIterator(tree *iavl.ImmutableTree, start, end []byte) *treeIterator {
+	it := &treeIterator{
+		kvs:  make(chan kvPair, 1000),
+		done: make(chan struct{}),
+	}
+	go func() {
+		defer close(it.kvs)
+		tree.IterateRange(start, end, true, func(key, value []byte) bool {
+			select {
+			case it.kvs <- kvPair{key: key, value: value}:
+				return false
+			case <-it.done:
+				return true
+			}
+		})
+	}()
+	it.Next()
+	return it
+}
+
+func (it *treeIterator) Valid() bool {
+	return it.valid
+}
+
+func (it *treeIterator) Key() []byte {
+	return it.current.key
+}
+
+func (it *treeIterator) Value() []byte {
+	return it.current.value
+}
+
+func (it *treeIterator) Next() {
+	it.current, it.valid = <-it.kvs
+}
+
+func (it *treeIterator) Close() {
+	close(it.done)
+	// drain the channel so the goroutine walking the tree can exit
+	for range it.kvs {
+	}
+	it.valid = false
+}
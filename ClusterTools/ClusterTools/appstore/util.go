@@ -4,6 +4,12 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/tendermint/tendermint/libs/db"
 )
 
 func hasPrefix(key, prefix []byte) bool {
@@ -49,6 +55,12 @@ func uint64ToByteBigEndian(height uint64) []byte {
 	return heightB
 }
 
+func uint64ToByteLittleEndian(height uint64) []byte {
+	heightB := make([]byte, 8)
+	binary.LittleEndian.PutUint64(heightB, height)
+	return heightB
+}
+
 func byteToUint64LittleEndian(b []byte) uint64 {
 	return uint64(binary.LittleEndian.Uint64(b))
 }
@@ -62,3 +74,16 @@ func formatPrefixes(key, oldPrefix, newPrefix []byte) ([]byte, error) {
 	heightByteB := uint64ToByteBigEndian(height)
 	return prefixKey([]byte(newPrefix), heightByteB), nil
 }
+
+func openReadOnlyDB(dbPath string) (*db.GoLevelDB, error) {
+	// TM LevelDB wrapper adds .db suffix, so gotta remove it to prevent duplication
+	dbName := strings.TrimSuffix(path.Base(dbPath), ".db")
+	dbDir := path.Dir(dbPath)
+	ldb, err := db.NewGoLevelDBWithOpts(dbName, dbDir, &opt.Options{
+		ReadOnly: true,
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open %v", dbPath)
+	}
+	return ldb, nil
+}
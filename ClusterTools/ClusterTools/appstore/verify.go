@@ -0,0 +1,138 @@
+package appstore
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/tendermint/iavl"
+)
+
+// IAVLCloneVerification is the result of comparing a cloned IAVL tree to the source tree.
+type IAVLCloneVerification struct {
+	Version      int64
+	SrcRootHash  []byte
+	DestRootHash []byte
+	// Set if the keys & values in both trees were compared.
+	KeysVerified bool
+	NumKeys      uint64
+	// First key at which the trees diverge, nil if the keys weren't compared or are identical.
+	DivergingKey []byte
+}
+
+// Err returns an error describing how the cloned tree differs from the source tree, or nil if the
+// trees match.
+func (v *IAVLCloneVerification) Err() error {
+	if !bytes.Equal(v.SrcRootHash, v.DestRootHash) {
+		return fmt.Errorf(
+			"root hash mismatch at version %d, source %X, clone %X",
+			v.Version, v.SrcRootHash, v.DestRootHash,
+		)
+	}
+	if v.DivergingKey != nil {
+		return fmt.Errorf(
+			"trees diverge at version %d after %d keys, first diverging key %X",
+			v.Version, v.NumKeys, v.DivergingKey,
+		)
+	}
+	return nil
+}
+
+// VerifyIAVLTreeClone compares the IAVL tree cloned to destDBPath with the tree of the same version
+// in srcDBPath. If height is zero the latest version in destDBPath is verified. If verifyKeys is
+// true both trees are walked in lockstep to find the first diverging key, otherwise only the root
+// hashes are compared.
+// The srcValueDBPath parameter may be empty, otherwise it should be the path to app_state.db.
+func VerifyIAVLTreeClone(
+	srcDBPath, srcValueDBPath, destDBPath string, height int64, verifyKeys bool,
+) (*IAVLCloneVerification, error) {
+	destDB, err := openReadOnlyDB(destDBPath)
+	if err != nil {
+		return nil, err
+	}
+	defer destDB.Close()
+
+	destTree := iavl.NewMutableTree(destDB, 0)
+	version, err := destTree.LoadVersion(height)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to load cloned IAVL tree version %v", height)
+	}
+
+	srcDB, err := openReadOnlyDB(srcDBPath)
+	if err != nil {
+		return nil, err
+	}
+	defer srcDB.Close()
+
+	var srcTree *iavl.MutableTree
+	if len(srcValueDBPath) == 0 {
+		srcTree = iavl.NewMutableTree(srcDB, 0)
+		if _, err := srcTree.LoadVersion(version); err != nil {
+			return nil, errors.Wrapf(err, "failed to load source IAVL tree version %v", version)
+		}
+	} else {
+		valueDB, err := openReadOnlyDB(srcValueDBPath)
+		if err != nil {
+			return nil, err
+		}
+		defer valueDB.Close()
+
+		srcTree = iavl.NewMutableTreeWithNodeDB(iavl.NewNodeDB(srcDB, 10000, valueDB.Get))
+		lastVer, err := srcTree.LoadVersion(version)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to load source IAVL tree version %v", version)
+		}
+		// app_state.db only has data for the latest height
+		if lastVer != version {
+			return nil, fmt.Errorf("height %d doesn't match latest IAVL tree version %d", version, lastVer)
+		}
+	}
+
+	return verifyIAVLTrees(srcTree.ImmutableTree, destTree.ImmutableTree, verifyKeys), nil
+}
+
+// verifyIAVLTrees compares the root hashes of the two trees, and if verifyKeys is true walks both
+// trees in lockstep until the first diverging key is found.
+func verifyIAVLTrees(srcTree, destTree *iavl.ImmutableTree, verifyKeys bool) *IAVLCloneVerification {
+	result := &IAVLCloneVerification{
+		Version:      srcTree.Version(),
+		SrcRootHash:  srcTree.Hash(),
+		DestRootHash: destTree.Hash(),
+		KeysVerified: verifyKeys,
+	}
+	if !verifyKeys {
+		return result
+	}
+
+	srcIt := newTreeIterator(srcTree, nil, nil)
+	defer srcIt.Close()
+	destIt := newTreeIterator(destTree, nil, nil)
+	defer destIt.Close()
+	for srcIt.Valid() || destIt.Valid() {
+		if !destIt.Valid() {
+			result.DivergingKey = srcIt.Key()
+			break
+		}
+		if !srcIt.Valid() {
+			result.DivergingKey = destIt.Key()
+			break
+		}
+		cmp := bytes.Compare(srcIt.Key(), destIt.Key())
+		if cmp < 0 {
+			result.DivergingKey = srcIt.Key()
+			break
+		}
+		if cmp > 0 {
+			result.DivergingKey = destIt.Key()
+			break
+		}
+		if !bytes.Equal(srcIt.Value(), destIt.Value()) {
+			result.DivergingKey = srcIt.Key()
+			break
+		}
+		result.NumKeys++
+		srcIt.Next()
+		destIt.Next()
+	}
+	return result
+}
@@ -0,0 +1,160 @@
+package appstore
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+	"github.com/tendermint/iavl"
+)
+
+// Max number of missing, extra, or different keys listed in an EvmVerification.
+const maxReportedEvmKeys = 100
+
+// EvmVerification is the result of comparing an evm.db created by CopyEvmToLevelDb to the EVM
+// state in app.db.
+type EvmVerification struct {
+	Version int64
+	// Number of keys that match.
+	NumKeys uint64
+	// Number of keys in app.db that are missing from evm.db.
+	NumMissing uint64
+	// Number of keys in evm.db that aren't in app.db.
+	NumExtra uint64
+	// Number of keys with different values.
+	NumDifferent uint64
+	// The first few missing, extra, and different keys.
+	MissingKeys   [][]byte
+	ExtraKeys     [][]byte
+	DifferentKeys [][]byte
+	// The vmevmroot value expected in evm.db, and the actual value (nil if it's missing, or not
+	// expected).
+	ExpectedRoot []byte
+	EvmRoot      []byte
+}
+
+// Err returns an error describing how evm.db differs from app.db, or nil if they match.
+func (v *EvmVerification) Err() error {
+	if v.NumMissing > 0 || v.NumExtra > 0 || v.NumDifferent > 0 {
+		return fmt.Errorf(
+			"EVM state mismatch at height %d, %d keys missing, %d extra keys, %d different keys",
+			v.Version, v.NumMissing, v.NumExtra, v.NumDifferent,
+		)
+	}
+	if !bytes.Equal(v.ExpectedRoot, v.EvmRoot) {
+		return fmt.Errorf(
+			"vmevmroot mismatch at height %d, expected %X, evm.db has %X",
+			v.Version, v.ExpectedRoot, v.EvmRoot,
+		)
+	}
+	return nil
+}
+
+func (v *EvmVerification) addMissing(key []byte) {
+	v.NumMissing++
+	if len(v.MissingKeys) < maxReportedEvmKeys {
+		v.MissingKeys = append(v.MissingKeys, append([]byte(nil), key...))
+	}
+}
+
+func (v *EvmVerification) addExtra(key []byte) {
+	v.NumExtra++
+	if len(v.ExtraKeys) < maxReportedEvmKeys {
+		v.ExtraKeys = append(v.ExtraKeys, append([]byte(nil), key...))
+	}
+}
+
+func (v *EvmVerification) addDifferent(key []byte) {
+	v.NumDifferent++
+	if len(v.DifferentKeys) < maxReportedEvmKeys {
+		v.DifferentKeys = append(v.DifferentKeys, append([]byte(nil), key...))
+	}
+}
+
+// VerifyEvmExtraction compares the EVM state extracted to evmDBPath by CopyEvmToLevelDb with the
+// vm-prefixed keys of the IAVL tree in appDBPath at the given height (zero for the latest). Both
+// DBs are walked in key order, and the vmevmroot entry for the height is checked against the
+// vmvmroot value in app.db.
+func VerifyEvmExtraction(appDBPath, evmDBPath string, height int64) (*EvmVerification, error) {
+	appDB, err := openReadOnlyDB(appDBPath)
+	if err != nil {
+		return nil, err
+	}
+	defer appDB.Close()
+	tree := iavl.NewMutableTree(appDB, 0)
+	version, err := tree.LoadVersion(height)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to load IAVL tree version %v", height)
+	}
+
+	evmDB, err := leveldb.OpenFile(evmDBPath, &opt.Options{ReadOnly: true})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open %v", evmDBPath)
+	}
+	defer evmDB.Close()
+
+	result := &EvmVerification{Version: version}
+	evmRoot := evmRootKey(version)
+	result.EvmRoot, err = evmDB.Get(evmRoot, nil)
+	if err != nil && err != leveldb.ErrNotFound {
+		return nil, errors.Wrap(err, "failed to load vmevmroot")
+	}
+	start := prefixKey([]byte(prefixStart), nil)
+	end := prefixRangeEnd(start)
+	appIt := newTreeIterator(tree.ImmutableTree, start, end)
+	defer appIt.Close()
+	evmIt := evmDB.NewIterator(&util.Range{Start: start, Limit: end}, nil)
+	defer evmIt.Release()
+	// the vmevmroot entry only exists in evm.db, and is checked separately
+	nextEvmKey := func() bool {
+		for evmIt.Next() {
+			if !bytes.Equal(evmIt.Key(), evmRoot) {
+				return true
+			}
+		}
+		return false
+	}
+	evmValid := nextEvmKey()
+	for appIt.Valid() || evmValid {
+		cmp := 0
+		if !evmValid {
+			cmp = -1
+		} else if !appIt.Valid() {
+			cmp = 1
+		} else {
+			cmp = bytes.Compare(appIt.Key(), evmIt.Key())
+		}
+		switch {
+		case cmp < 0:
+			result.addMissing(appIt.Key())
+			appIt.Next()
+		case cmp > 0:
+			result.addExtra(evmIt.Key())
+			evmValid = nextEvmKey()
+		default:
+			if bytes.Equal(appIt.Value(), evmIt.Value()) {
+				result.NumKeys++
+			} else {
+				result.addDifferent(appIt.Key())
+			}
+			appIt.Next()
+			evmValid = nextEvmKey()
+		}
+	}
+	if err := evmIt.Error(); err != nil {
+		return nil, errors.Wrap(err, "failed to iterate evm.db")
+	}
+
+	// CopyEvmToLevelDb copies vmvmroot to vmevmroot if it exists, and only sets vmevmroot to
+	// defaultRoot if there are no vm keys at all.
+	_, vmRoot := tree.Get(prefixKey([]byte(prefixStart), []byte(rootKey)))
+	if vmRoot != nil {
+		result.ExpectedRoot = vmRoot
+	} else if result.NumKeys+result.NumMissing+result.NumDifferent == 0 {
+		result.ExpectedRoot = defaultRoot
+	}
+	return result, nil
+}
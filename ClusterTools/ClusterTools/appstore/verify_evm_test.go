@@ -0,0 +1,104 @@
+package appstore
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/tendermint/iavl"
+	"github.com/tendermint/tendermint/libs/db"
+)
+
+func TestVerifyEvmExtraction(t *testing.T) {
+	_ = os.RemoveAll("./tempVerifyEvmApp.db")
+	defer os.RemoveAll("./tempVerifyEvmApp.db")
+	_ = os.RemoveAll("./tempVerifyEvm.db")
+	defer os.RemoveAll("./tempVerifyEvm.db")
+
+	srcDB, err := db.NewGoLevelDB("tempVerifyEvmApp", ".")
+	require.NoError(t, err)
+	tree := iavl.NewMutableTree(srcDB, 0)
+	tree.Set([]byte("before"), []byte("aa"))
+	for i := 0; i < 50; i++ {
+		tree.Set(prefixKey([]byte("vm"), []byte(fmt.Sprintf("key%02d", i))), []byte("value"))
+	}
+	tree.Set(prefixKey([]byte("vm"), []byte(rootKey)), []byte("root1"))
+	tree.Set([]byte("vn"), []byte("after"))
+	_, _, err = tree.SaveVersion()
+	require.NoError(t, err)
+	tree.Set(prefixKey([]byte("vm"), []byte(rootKey)), []byte("root2"))
+	_, _, err = tree.SaveVersion()
+	require.NoError(t, err)
+	srcDB.Close()
+
+	require.NoError(t, CopyEvmToLevelDb("./tempVerifyEvmApp.db", "./tempVerifyEvm.db", 10, 0, 1, 1))
+	result, err := VerifyEvmExtraction("./tempVerifyEvmApp.db", "./tempVerifyEvm.db", 1)
+	require.NoError(t, err)
+	require.NoError(t, result.Err())
+	require.Equal(t, uint64(51), result.NumKeys)
+	require.Equal(t, []byte("root1"), result.EvmRoot)
+
+	// the vmvmroot at height 2 is different
+	result, err = VerifyEvmExtraction("./tempVerifyEvmApp.db", "./tempVerifyEvm.db", 2)
+	require.NoError(t, err)
+	require.Error(t, result.Err())
+	require.Equal(t, uint64(1), result.NumDifferent)
+	require.Nil(t, result.EvmRoot)
+
+	evmDB, err := leveldb.OpenFile("./tempVerifyEvm.db", nil)
+	require.NoError(t, err)
+	require.NoError(t, evmDB.Delete(prefixKey([]byte("vm"), []byte("key10")), nil))
+	require.NoError(t, evmDB.Put(prefixKey([]byte("vm"), []byte("key10a")), []byte("value"), nil))
+	require.NoError(t, evmDB.Put(prefixKey([]byte("vm"), []byte("key20")), []byte("changed"), nil))
+	require.NoError(t, evmDB.Put(prefixKey([]byte("vm"), []byte("key99")), []byte("value"), nil))
+	require.NoError(t, evmDB.Close())
+
+	result, err = VerifyEvmExtraction("./tempVerifyEvmApp.db", "./tempVerifyEvm.db", 1)
+	require.NoError(t, err)
+	require.Error(t, result.Err())
+	require.Equal(t, uint64(49), result.NumKeys)
+	require.Equal(t, [][]byte{prefixKey([]byte("vm"), []byte("key10"))}, result.MissingKeys)
+	require.Equal(t, uint64(2), result.NumExtra)
+	require.Equal(t, [][]byte{prefixKey([]byte("vm"), []byte("key20"))}, result.DifferentKeys)
+	require.Equal(t, []byte("root1"), result.EvmRoot)
+}
+
+func TestVerifyEvmExtractionWithoutRoot(t *testing.T) {
+	_ = os.RemoveAll("./tempVerifyEvmNoRootApp.db")
+	defer os.RemoveAll("./tempVerifyEvmNoRootApp.db")
+	_ = os.RemoveAll("./tempVerifyEvmNoRoot.db")
+	defer os.RemoveAll("./tempVerifyEvmNoRoot.db")
+	_ = os.RemoveAll("./tempVerifyEvmEmpty.db")
+	defer os.RemoveAll("./tempVerifyEvmEmpty.db")
+
+	srcDB, err := db.NewGoLevelDB("tempVerifyEvmNoRootApp", ".")
+	require.NoError(t, err)
+	tree := iavl.NewMutableTree(srcDB, 0)
+	tree.Set([]byte("before"), []byte("aa"))
+	_, _, err = tree.SaveVersion()
+	require.NoError(t, err)
+	for i := 0; i < 10; i++ {
+		tree.Set(prefixKey([]byte("vm"), []byte(fmt.Sprintf("key%02d", i))), []byte("value"))
+	}
+	_, _, err = tree.SaveVersion()
+	require.NoError(t, err)
+	srcDB.Close()
+
+	// there are no vm keys at height 1, so vmevmroot is set to the default root
+	require.NoError(t, CopyEvmToLevelDb("./tempVerifyEvmNoRootApp.db", "./tempVerifyEvmEmpty.db", 10, 0, 1, 1))
+	result, err := VerifyEvmExtraction("./tempVerifyEvmNoRootApp.db", "./tempVerifyEvmEmpty.db", 1)
+	require.NoError(t, err)
+	require.NoError(t, result.Err())
+	require.Equal(t, defaultRoot, result.EvmRoot)
+
+	// there are vm keys but no vmvmroot at height 2, so there's no vmevmroot either
+	require.NoError(t, CopyEvmToLevelDb("./tempVerifyEvmNoRootApp.db", "./tempVerifyEvmNoRoot.db", 10, 0, 2, 1))
+	result, err = VerifyEvmExtraction("./tempVerifyEvmNoRootApp.db", "./tempVerifyEvmNoRoot.db", 2)
+	require.NoError(t, err)
+	require.NoError(t, result.Err())
+	require.Equal(t, uint64(10), result.NumKeys)
+	require.Nil(t, result.ExpectedRoot)
+	require.Nil(t, result.EvmRoot)
+}
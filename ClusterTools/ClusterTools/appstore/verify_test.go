@@ -0,0 +1,45 @@
+package appstore
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tendermint/iavl"
+	"github.com/tendermint/tendermint/libs/db"
+)
+
+func TestVerifyIAVLTrees(t *testing.T) {
+	newTree := func(overrides map[string]string) *iavl.MutableTree {
+		tree := iavl.NewMutableTree(db.NewMemDB(), 0)
+		for i := 0; i < 100; i++ {
+			tree.Set([]byte(fmt.Sprintf("key%03d", i)), []byte(fmt.Sprintf("value%d", i)))
+		}
+		for k, v := range overrides {
+			tree.Set([]byte(k), []byte(v))
+		}
+		_, _, err := tree.SaveVersion()
+		require.NoError(t, err)
+		return tree
+	}
+
+	src := newTree(nil)
+	result := verifyIAVLTrees(src.ImmutableTree, newTree(nil).ImmutableTree, true)
+	require.NoError(t, result.Err())
+	require.Equal(t, uint64(100), result.NumKeys)
+
+	result = verifyIAVLTrees(src.ImmutableTree, newTree(map[string]string{"key050": "changed"}).ImmutableTree, false)
+	require.Error(t, result.Err())
+	require.Nil(t, result.DivergingKey)
+
+	result = verifyIAVLTrees(src.ImmutableTree, newTree(map[string]string{"key050": "changed"}).ImmutableTree, true)
+	require.Error(t, result.Err())
+	require.Equal(t, []byte("key050"), result.DivergingKey)
+	require.Equal(t, uint64(50), result.NumKeys)
+
+	result = verifyIAVLTrees(src.ImmutableTree, newTree(map[string]string{"key0505": "extra"}).ImmutableTree, true)
+	require.Equal(t, []byte("key0505"), result.DivergingKey)
+
+	result = verifyIAVLTrees(newTree(map[string]string{"key100": "extra"}).ImmutableTree, src.ImmutableTree, true)
+	require.Equal(t, []byte("key100"), result.DivergingKey)
+}
@@ -0,0 +1,330 @@
+package blockstore
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+)
+
+// A block archive is laid out as follows:
+//
+//	magic (4 bytes) | format version (1 byte)
+//	header length (uint32) | header checksum (uint32) | header (JSON)
+//	chunk...
+//	trailer: 0 (uint32) | number of blocks (uint64)
+//
+// Each chunk is a length (uint32), a checksum (uint32) of the compressed data, and a gzip
+// compressed run of block records. A block record stores the raw block meta, parts, commit and
+// seen commit exactly as they're stored in blockstore.db, so an archive can be imported without
+// re-encoding anything. All integers are big endian, checksums are CRC-32 (Castagnoli).
+var archiveMagic = []byte("CKBA")
+
+const (
+	archiveFormatVersion = 1
+
+	// limit on the size of a single chunk or header, to avoid allocating huge buffers when reading
+	// a corrupted archive
+	maxArchiveChunkSize = 1 << 30
+)
+
+var archiveCRCTable = crc32.MakeTable(crc32.Castagnoli)
+
+// ArchiveHeader describes the blocks stored in a block archive.
+type ArchiveHeader struct {
+	ChainID        string
+	FromHeight     int64
+	ToHeight       int64
+	BlocksPerChunk int64
+}
+
+// ArchiveBlock contains the raw data stored in blockstore.db for a single block. Commit is nil if
+// the block store didn't contain the commit for the block (which is only stored with the next block).
+type ArchiveBlock struct {
+	Height     int64
+	Meta       []byte
+	Parts      [][]byte
+	Commit     []byte
+	SeenCommit []byte
+}
+
+// ArchiveWriter writes a block archive, blocks must be written in ascending height order.
+type ArchiveWriter struct {
+	w          io.Writer
+	header     ArchiveHeader
+	chunk      bytes.Buffer
+	numInChunk int64
+	numBlocks  uint64
+}
+
+func NewArchiveWriter(w io.Writer, header ArchiveHeader) (*ArchiveWriter, error) {
+	if header.BlocksPerChunk < 1 {
+		return nil, errors.New("blocks per chunk must be greater than zero")
+	}
+	headerBytes, err := json.Marshal(header)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode archive header")
+	}
+	buf := append([]byte{}, archiveMagic...)
+	buf = append(buf, archiveFormatVersion)
+	buf = appendUint32(buf, uint32(len(headerBytes)))
+	buf = appendUint32(buf, crc32.Checksum(headerBytes, archiveCRCTable))
+	buf = append(buf, headerBytes...)
+	if _, err := w.Write(buf); err != nil {
+		return nil, errors.Wrap(err, "failed to write archive header")
+	}
+	return &ArchiveWriter{w: w, header: header}, nil
+}
+
+func (aw *ArchiveWriter) WriteBlock(block *ArchiveBlock) error {
+	buf := appendUint64(nil, uint64(block.Height))
+	buf = appendBytes(buf, block.Meta)
+	buf = appendUint32(buf, uint32(len(block.Parts)))
+	for _, part := range block.Parts {
+		buf = appendBytes(buf, part)
+	}
+	buf = appendBytes(buf, block.Commit)
+	buf = appendBytes(buf, block.SeenCommit)
+	aw.chunk.Write(buf)
+	aw.numInChunk++
+	aw.numBlocks++
+	if aw.numInChunk >= aw.header.BlocksPerChunk {
+		return aw.flushChunk()
+	}
+	return nil
+}
+
+func (aw *ArchiveWriter) flushChunk() error {
+	if aw.numInChunk == 0 {
+		return nil
+	}
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	if _, err := zw.Write(aw.chunk.Bytes()); err != nil {
+		return errors.Wrap(err, "failed to compress chunk")
+	}
+	if err := zw.Close(); err != nil {
+		return errors.Wrap(err, "failed to compress chunk")
+	}
+	buf := appendUint32(nil, uint32(compressed.Len()))
+	buf = appendUint32(buf, crc32.Checksum(compressed.Bytes(), archiveCRCTable))
+	if _, err := aw.w.Write(buf); err != nil {
+		return errors.Wrap(err, "failed to write chunk")
+	}
+	if _, err := aw.w.Write(compressed.Bytes()); err != nil {
+		return errors.Wrap(err, "failed to write chunk")
+	}
+	aw.chunk.Reset()
+	aw.numInChunk = 0
+	return nil
+}
+
+// Close flushes any buffered blocks and writes the archive trailer, it doesn't close the
+// underlying writer.
+func (aw *ArchiveWriter) Close() error {
+	if err := aw.flushChunk(); err != nil {
+		return err
+	}
+	buf := appendUint32(nil, 0)
+	buf = appendUint64(buf, aw.numBlocks)
+	if _, err := aw.w.Write(buf); err != nil {
+		return errors.Wrap(err, "failed to write archive trailer")
+	}
+	return nil
+}
+
+// ArchiveReader reads the blocks from a block archive written by ArchiveWriter.
+type ArchiveReader struct {
+	r         *bufio.Reader
+	header    ArchiveHeader
+	chunk     *bytes.Reader
+	numBlocks uint64
+	done      bool
+}
+
+func NewArchiveReader(r io.Reader) (*ArchiveReader, error) {
+	ar := &ArchiveReader{r: bufio.NewReader(r)}
+	magic := make([]byte, len(archiveMagic)+1)
+	if _, err := io.ReadFull(ar.r, magic); err != nil {
+		return nil, errors.Wrap(err, "failed to read archive header")
+	}
+	if !bytes.Equal(magic[:len(archiveMagic)], archiveMagic) {
+		return nil, errors.New("not a block archive")
+	}
+	if magic[len(archiveMagic)] != archiveFormatVersion {
+		return nil, errors.Errorf("unsupported block archive format version %d", magic[len(archiveMagic)])
+	}
+	headerBytes, err := ar.readChecksummed()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read archive header")
+	}
+	if headerBytes == nil {
+		return nil, errors.New("archive header is missing")
+	}
+	if err := json.Unmarshal(headerBytes, &ar.header); err != nil {
+		return nil, errors.Wrap(err, "failed to decode archive header")
+	}
+	return ar, nil
+}
+
+func (ar *ArchiveReader) Header() ArchiveHeader {
+	return ar.header
+}
+
+// Next returns the next block in the archive, or io.EOF once all the blocks have been read.
+func (ar *ArchiveReader) Next() (*ArchiveBlock, error) {
+	if ar.done {
+		return nil, io.EOF
+	}
+	if ar.chunk == nil || ar.chunk.Len() == 0 {
+		if err := ar.nextChunk(); err != nil {
+			return nil, err
+		}
+		if ar.done {
+			return nil, io.EOF
+		}
+	}
+
+	block := &ArchiveBlock{}
+	height, err := readUint64(ar.chunk)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read block height")
+	}
+	block.Height = int64(height)
+	if block.Meta, err = readBytes(ar.chunk); err != nil {
+		return nil, errors.Wrapf(err, "failed to read meta of block %d", block.Height)
+	}
+	numParts, err := readUint32(ar.chunk)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read parts of block %d", block.Height)
+	}
+	for i := uint32(0); i < numParts; i++ {
+		part, err := readBytes(ar.chunk)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read part %d of block %d", i, block.Height)
+		}
+		block.Parts = append(block.Parts, part)
+	}
+	if block.Commit, err = readBytes(ar.chunk); err != nil {
+		return nil, errors.Wrapf(err, "failed to read commit of block %d", block.Height)
+	}
+	if block.SeenCommit, err = readBytes(ar.chunk); err != nil {
+		return nil, errors.Wrapf(err, "failed to read seen commit of block %d", block.Height)
+	}
+	ar.numBlocks++
+	return block, nil
+}
+
+func (ar *ArchiveReader) nextChunk() error {
+	compressed, err := ar.readChecksummed()
+	if err != nil {
+		return errors.Wrap(err, "failed to read chunk")
+	}
+	if compressed == nil {
+		numBlocks, err := readUint64(ar.r)
+		if err != nil {
+			return errors.Wrap(err, "failed to read archive trailer")
+		}
+		if numBlocks != ar.numBlocks {
+			return errors.Errorf("archive should contain %d blocks, but %d were read", numBlocks, ar.numBlocks)
+		}
+		ar.done = true
+		return nil
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return errors.Wrap(err, "failed to decompress chunk")
+	}
+	buf, err := ioutil.ReadAll(zr)
+	if err != nil {
+		return errors.Wrap(err, "failed to decompress chunk")
+	}
+	ar.chunk = bytes.NewReader(buf)
+	return nil
+}
+
+// readChecksummed reads a length & checksum prefixed byte slice, and returns nil if the length is zero.
+func (ar *ArchiveReader) readChecksummed() ([]byte, error) {
+	size, err := readUint32(ar.r)
+	if err != nil {
+		if err == io.EOF {
+			return nil, errors.New("archive is truncated")
+		}
+		return nil, err
+	}
+	if size == 0 {
+		return nil, nil
+	}
+	if size > maxArchiveChunkSize {
+		return nil, errors.Errorf("invalid size %d", size)
+	}
+	checksum, err := readUint32(ar.r)
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, size)
+	if _, err := io.ReadFull(ar.r, buf); err != nil {
+		return nil, err
+	}
+	if crc32.Checksum(buf, archiveCRCTable) != checksum {
+		return nil, errors.New("checksum mismatch")
+	}
+	return buf, nil
+}
+
+func appendUint32(buf []byte, v uint32) []byte {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], v)
+	return append(buf, b[:]...)
+}
+
+func appendUint64(buf []byte, v uint64) []byte {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], v)
+	return append(buf, b[:]...)
+}
+
+func appendBytes(buf []byte, v []byte) []byte {
+	buf = appendUint32(buf, uint32(len(v)))
+	return append(buf, v...)
+}
+
+func readUint32(r io.Reader) (uint32, error) {
+	var b [4]byte
+	if _, err := io.ReadFull(r, b[:]); err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint32(b[:]), nil
+}
+
+func readUint64(r io.Reader) (uint64, error) {
+	var b [8]byte
+	if _, err := io.ReadFull(r, b[:]); err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint64(b[:]), nil
+}
+
+func readBytes(r *bytes.Reader) ([]byte, error) {
+	size, err := readUint32(r)
+	if err != nil {
+		return nil, err
+	}
+	if int64(size) > int64(r.Len()) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	if size == 0 {
+		return nil, nil
+	}
+	buf := make([]byte, size)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
@@ -0,0 +1,253 @@
+package blockstore
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportBlockStore(t *testing.T) {
+	chainDataDir := "./tempExport"
+	archivePath := "./tempExport.ckba"
+	makeTestChain(t, chainDataDir, 10)
+	defer os.RemoveAll(chainDataDir)
+	defer os.Remove(archivePath)
+
+	bs := NewBlockStore(chainDataDir, true)
+	defer bs.Close()
+
+	_, err := bs.Export(archivePath, 5, 11, 3, 0)
+	require.Error(t, err)
+
+	header, err := bs.Export(archivePath, 3, 0, 3, 0)
+	require.NoError(t, err)
+	require.Equal(t, ArchiveHeader{ChainID: "test", FromHeight: 3, ToHeight: 10, BlocksPerChunk: 3}, *header)
+
+	archive, err := ioutil.ReadFile(archivePath)
+	require.NoError(t, err)
+	ar, err := NewArchiveReader(bytes.NewReader(archive))
+	require.NoError(t, err)
+	require.Equal(t, *header, ar.Header())
+	for height := int64(3); height <= 10; height++ {
+		block, err := ar.Next()
+		require.NoError(t, err)
+		expected, err := bs.loadArchiveBlock(height)
+		require.NoError(t, err)
+		require.Equal(t, expected, block)
+	}
+	_, err = ar.Next()
+	require.Equal(t, io.EOF, err)
+
+	readAll := func(archive []byte) error {
+		ar, err := NewArchiveReader(bytes.NewReader(archive))
+		if err != nil {
+			return err
+		}
+		for {
+			if _, err := ar.Next(); err != nil {
+				if err == io.EOF {
+					return nil
+				}
+				return err
+			}
+		}
+	}
+	require.NoError(t, readAll(archive))
+
+	truncated := archive[:len(archive)-20]
+	require.Error(t, readAll(truncated))
+
+	corrupted := append([]byte{}, archive...)
+	corrupted[len(corrupted)-30]++
+	require.Error(t, readAll(corrupted))
+}
+
+func TestImportBlockStore(t *testing.T) {
+	srcDir := "./tempImportSrc"
+	destDir := "./tempImportDest"
+	makeTestChain(t, srcDir, 10)
+	defer os.RemoveAll(srcDir)
+	_ = os.RemoveAll(destDir)
+	defer os.RemoveAll(destDir)
+
+	src := NewBlockStore(srcDir, true)
+	archives := map[string][2]int64{
+		"./tempImport1-5.ckba":  {1, 5},
+		"./tempImport6-10.ckba": {6, 10},
+		"./tempImport3-7.ckba":  {3, 7},
+		"./tempImport8-10.ckba": {8, 10},
+	}
+	for archivePath, heights := range archives {
+		_, err := src.Export(archivePath, heights[0], heights[1], 2, 0)
+		require.NoError(t, err)
+		defer os.Remove(archivePath)
+	}
+
+	dest := NewBlockStore(destDir, false)
+	defer dest.Close()
+	_, err := dest.Import("./tempImport6-10.ckba", false, 2, 0)
+	require.NoError(t, err)
+	require.Equal(t, int64(6), dest.OldestHeight())
+	require.Equal(t, int64(10), dest.Height())
+
+	_, err = dest.Import("./tempImport3-7.ckba", false, 2, 0)
+	require.Error(t, err)
+	_, err = dest.Import("./tempImport8-10.ckba", false, 2, 0)
+	require.Error(t, err)
+
+	// restore the blocks below the oldest block
+	header, err := dest.Import("./tempImport1-5.ckba", false, 2, 0)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), header.FromHeight)
+	require.Equal(t, int64(1), dest.OldestHeight())
+	require.Equal(t, int64(10), dest.Height())
+	report, err := dest.Verify(0)
+	require.NoError(t, err)
+	require.True(t, report.OK())
+	require.Equal(t, int64(10), report.NumValid)
+
+	for height := int64(1); height <= 10; height++ {
+		expected, err := src.loadArchiveBlock(height)
+		require.NoError(t, err)
+		actual, err := dest.loadArchiveBlock(height)
+		require.NoError(t, err)
+		require.Equal(t, expected, actual)
+	}
+	src.Close()
+
+	// overlapping blocks can be overwritten if forced
+	_, err = dest.Import("./tempImport3-7.ckba", true, 2, 0)
+	require.NoError(t, err)
+}
+
+func TestImportAfterLatestBlock(t *testing.T) {
+	srcDir := "./tempAppendSrc"
+	destDir := "./tempAppendDest"
+	archivePath := "./tempAppend6-10.ckba"
+	makeTestChain(t, srcDir, 10)
+	defer os.RemoveAll(srcDir)
+	// the test chains are deterministic, so this is the same as the first 5 blocks of the source
+	makeTestChain(t, destDir, 5)
+	defer os.RemoveAll(destDir)
+
+	src := NewBlockStore(srcDir, true)
+	_, err := src.Export(archivePath, 6, 10, 2, 0)
+	require.NoError(t, err)
+	defer os.Remove(archivePath)
+	src.Close()
+
+	dest := NewBlockStore(destDir, false)
+	defer dest.Close()
+	// the commit of the latest block is only stored with the next block
+	require.False(t, dest.Has(calcBlockCommitKey(5)))
+
+	_, err = dest.Import(archivePath, false, 2, 0)
+	require.NoError(t, err)
+	require.True(t, dest.Has(calcBlockCommitKey(5)))
+	require.Equal(t, int64(10), dest.Height())
+	report, err := dest.Verify(0)
+	require.NoError(t, err)
+	require.True(t, report.OK())
+	require.Equal(t, int64(10), report.NumValid)
+}
+
+func TestImportInvalidArchive(t *testing.T) {
+	srcDir := "./tempInvalidSrc"
+	destDir := "./tempInvalidDest"
+	archivePath := "./tempInvalid.ckba"
+	makeTestChain(t, srcDir, 3)
+	defer os.RemoveAll(srcDir)
+	_ = os.RemoveAll(destDir)
+	defer os.RemoveAll(destDir)
+	defer os.Remove(archivePath)
+
+	src := NewBlockStore(srcDir, true)
+	defer src.Close()
+	var blocks []*ArchiveBlock
+	for height := int64(1); height <= 3; height++ {
+		block, err := src.loadArchiveBlock(height)
+		require.NoError(t, err)
+		blocks = append(blocks, block)
+	}
+	// swap the parts of blocks 2 & 3 so they no longer match the hashes in the metas
+	blocks[1].Parts, blocks[2].Parts = blocks[2].Parts, blocks[1].Parts
+
+	f, err := os.Create(archivePath)
+	require.NoError(t, err)
+	aw, err := NewArchiveWriter(f, ArchiveHeader{ChainID: "test", FromHeight: 1, ToHeight: 3, BlocksPerChunk: 10})
+	require.NoError(t, err)
+	for _, block := range blocks {
+		require.NoError(t, aw.WriteBlock(block))
+	}
+	require.NoError(t, aw.Close())
+	require.NoError(t, f.Close())
+
+	dest := NewBlockStore(destDir, false)
+	defer dest.Close()
+	_, err = dest.Import(archivePath, false, 10, 0)
+	require.Error(t, err)
+	require.Equal(t, int64(0), dest.Height())
+}
+
+func TestImportInvalidArchiveBelowOldest(t *testing.T) {
+	srcDir := "./tempInvalidBelowSrc"
+	destDir := "./tempInvalidBelowDest"
+	validPath := "./tempInvalidBelow1-5.ckba"
+	invalidPath := "./tempInvalidBelowBad1-5.ckba"
+	tipPath := "./tempInvalidBelow6-10.ckba"
+	makeTestChain(t, srcDir, 10)
+	defer os.RemoveAll(srcDir)
+	_ = os.RemoveAll(destDir)
+	defer os.RemoveAll(destDir)
+	defer os.Remove(validPath)
+	defer os.Remove(invalidPath)
+	defer os.Remove(tipPath)
+
+	src := NewBlockStore(srcDir, true)
+	_, err := src.Export(validPath, 1, 5, 2, 0)
+	require.NoError(t, err)
+	_, err = src.Export(tipPath, 6, 10, 2, 0)
+	require.NoError(t, err)
+	var blocks []*ArchiveBlock
+	for height := int64(1); height <= 5; height++ {
+		block, err := src.loadArchiveBlock(height)
+		require.NoError(t, err)
+		blocks = append(blocks, block)
+	}
+	src.Close()
+	// block 4 no longer matches the hash in its meta
+	blocks[3].Parts = blocks[4].Parts
+
+	f, err := os.Create(invalidPath)
+	require.NoError(t, err)
+	aw, err := NewArchiveWriter(f, ArchiveHeader{ChainID: "test", FromHeight: 1, ToHeight: 5, BlocksPerChunk: 10})
+	require.NoError(t, err)
+	for _, block := range blocks {
+		require.NoError(t, aw.WriteBlock(block))
+	}
+	require.NoError(t, aw.Close())
+	require.NoError(t, f.Close())
+
+	dest := NewBlockStore(destDir, false)
+	defer dest.Close()
+	_, err = dest.Import(tipPath, false, 2, 0)
+	require.NoError(t, err)
+
+	// none of the blocks before the invalid block are written, even though they fill a batch
+	_, err = dest.Import(invalidPath, false, 1, 0)
+	require.Error(t, err)
+	require.Equal(t, int64(6), dest.OldestHeight())
+	require.False(t, dest.Has(calcBlockMetaKey(1)))
+
+	// so the fixed archive can be imported without --force
+	_, err = dest.Import(validPath, false, 1, 0)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), dest.OldestHeight())
+	report, err := dest.Verify(0)
+	require.NoError(t, err)
+	require.True(t, report.OK())
+}
@@ -8,18 +8,22 @@ import (
 	"strconv"
 	"strings"
 
-	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/pkg/errors"
 	"github.com/syndtr/goleveldb/leveldb/opt"
-	"github.com/syndtr/goleveldb/leveldb/util"
 	"github.com/tendermint/tendermint/blockchain"
 	dbm "github.com/tendermint/tendermint/libs/db"
 	"github.com/tendermint/tendermint/types"
+
+	"github.com/dappchain/clusterkit/compact"
 )
 
 var (
 	calcBlockMetaPrefix = []byte("H:")
 )
 
+// number of tx index keys to delete in each batch when blocks are removed from the block store
+const txIndexBatchSize = 10000
+
 type BlockStore struct {
 	blockStoreDB dbm.DB
 	*blockchain.BlockStore
@@ -82,55 +86,101 @@ func (bs *BlockStore) SaveSeenCommit(blockHeight int64, newSeenCommit *types.Com
 }
 
 // Rollback removes any blocks in the block store with a height higher than the target height.
-// If the optional tx index store is passed in then the tx results from the blocks that are removed
-// from the block store will be removed from the tx index store.
+// If the optional tx index store is passed in then the tx results, and the height & tag index
+// entries, of the txs in the blocks that are removed from the block store will be removed from the
+// tx index store.
 func (bs *BlockStore) Rollback(targetHeight int64, txIndexStore *TxIndexStore) error {
+	_, err := bs.rollback(targetHeight, txIndexStore, false)
+	return err
+}
+
+// PlanRollback walks the same blocks as Rollback, but only works out what would be deleted,
+// without modifying the block store.
+func (bs *BlockStore) PlanRollback(targetHeight int64) (*BlockDeletionPlan, error) {
+	return bs.rollback(targetHeight, nil, true)
+}
+
+func (bs *BlockStore) rollback(targetHeight int64, txIndexStore *TxIndexStore, dryRun bool) (*BlockDeletionPlan, error) {
 	latestHeight := bs.Height()
 
 	if targetHeight >= latestHeight {
-		return fmt.Errorf(
+		return nil, fmt.Errorf(
 			"can't rollback the block store to block %d, current height is %d",
 			targetHeight, latestHeight,
 		)
 	}
 
-	txs := []types.Tx{}
+	plan := &BlockDeletionPlan{}
+	var txIndexDeleter *TxIndexDeleter
+	if txIndexStore != nil {
+		txIndexDeleter = txIndexStore.NewDeleter(txIndexBatchSize)
+	}
 	batch := bs.blockStoreDB.NewBatch()
 	for height := latestHeight; height > targetHeight; height-- {
 		meta := bs.LoadBlockMeta(height)
+		if dryRun {
+			plan.addBlock(bs.blockStoreDB, height, meta)
+			continue
+		}
 
-		if txIndexStore != nil {
+		if txIndexDeleter != nil {
 			block := bs.LoadBlock(height)
-			txs = append(txs, block.Data.Txs...)
+			if err := txIndexDeleter.DeleteBlockTxs(height, block.Data.Txs); err != nil {
+				return nil, err
+			}
 		}
 
-		batch.Delete(calcBlockMetaKey(height))
-		for i := 0; i < meta.BlockID.PartsHeader.Total; i++ {
-			batch.Delete(calcBlockPartKey(height, i))
+		deleteBlock(batch, height, meta)
+	}
+	if dryRun {
+		plan.OldestHeight = bs.OldestHeight()
+		plan.LatestHeight = targetHeight
+		if plan.OldestHeight > targetHeight {
+			plan.OldestHeight, plan.LatestHeight = -1, -1
 		}
-		batch.Delete(calcBlockCommitKey(height - 1))
-		batch.Delete(calcSeenCommitKey(height))
+		return plan, nil
+	}
+	if err := bs.writeDeletions(batch, txIndexDeleter, true); err != nil {
+		return nil, err
 	}
-	batch.WriteSync()
 	blockchain.BlockStoreStateJSON{Height: targetHeight}.Save(bs.blockStoreDB)
 
-	// TODO: Needs testing, curently complete untested.
-	if txIndexStore != nil {
-		if err := txIndexStore.Delete(txs); err != nil {
-			return err
-		}
+	if txIndexDeleter != nil {
+		log.Printf("deleted %d txs from the tx index", txIndexDeleter.NumTxs)
 	}
-	return nil
+	return nil, nil
 }
 
 // Purge removes any blocks in the block store below the target height.
-// If the optional tx index store is passed in then the tx results from the blocks that are removed
-// from the block store will be removed from the tx index store.
+// If the optional tx index store is passed in then the tx results, and the height & tag index
+// entries, of the txs in the blocks that are removed from the block store will be removed from the
+// tx index store.
 func (bs *BlockStore) Purge(targetHeight int64, txIndexStore *TxIndexStore, batchSize, logLevel int64, skipMissing, skipCompaction bool) error {
+	if _, err := bs.purge(targetHeight, txIndexStore, batchSize, logLevel, skipMissing, false); err != nil {
+		return err
+	}
+
+	if !skipCompaction {
+		bs.blockStoreDB.Close()
+		if _, err := compact.CompactDB(DBPath(bs.chainDataDir, "blockstore"), nil, nil, 1, nil); err != nil {
+			return fmt.Errorf("failed to compact db, %s", err.Error())
+		}
+		log.Println("finished DB compaction")
+	}
+	return nil
+}
+
+// PlanPurge walks the same blocks as Purge, but only works out what would be deleted, without
+// modifying the block store.
+func (bs *BlockStore) PlanPurge(targetHeight, logLevel int64, skipMissing bool) (*BlockDeletionPlan, error) {
+	return bs.purge(targetHeight, nil, 0, logLevel, skipMissing, true)
+}
+
+func (bs *BlockStore) purge(targetHeight int64, txIndexStore *TxIndexStore, batchSize, logLevel int64, skipMissing, dryRun bool) (*BlockDeletionPlan, error) {
 	latestHeight := bs.Height()
 
 	if targetHeight > latestHeight {
-		return fmt.Errorf(
+		return nil, fmt.Errorf(
 			"can't purge the block store below block %d, current height is %d",
 			targetHeight, latestHeight,
 		)
@@ -141,21 +191,20 @@ func (bs *BlockStore) Purge(targetHeight int64, txIndexStore *TxIndexStore, batc
 		progressInterval = int64(targetHeight / int64(math.Pow(10, float64(logLevel))))
 	}
 
-	oldestHeight := int64(-1)
-	// find the oldest block
-	it := bs.blockStoreDB.Iterator(calcBlockMetaPrefix, prefixRangeEnd(calcBlockMetaPrefix))
-	for ; it.Valid(); it.Next() {
-		oldestBlockMetaKey := it.Key()
-		oldestHeight = getHeightFromKey(oldestBlockMetaKey)
-		break
-	}
-
+	oldestHeight := bs.OldestHeight()
 	if oldestHeight >= targetHeight {
-		return fmt.Errorf("no block below block %d", targetHeight)
+		return nil, fmt.Errorf("no block below block %d", targetHeight)
 	}
 	log.Println("oldest block height", oldestHeight)
 
-	txs := []types.Tx{}
+	plan := &BlockDeletionPlan{
+		OldestHeight: targetHeight,
+		LatestHeight: latestHeight,
+	}
+	var txIndexDeleter *TxIndexDeleter
+	if txIndexStore != nil {
+		txIndexDeleter = txIndexStore.NewDeleter(txIndexBatchSize)
+	}
 	batch := bs.blockStoreDB.NewBatch()
 	numHeight := int64(0)
 	for height := targetHeight - 1; height >= oldestHeight; height-- {
@@ -165,53 +214,60 @@ func (bs *BlockStore) Purge(targetHeight int64, txIndexStore *TxIndexStore, batc
 			if skipMissing {
 				continue
 			}
+			// the blocks below the missing one are left in the block store
+			plan.OldestHeight = oldestHeight
 			break
 		}
 
 		meta := bs.LoadBlockMeta(height)
-		if txIndexStore != nil {
-			block := bs.LoadBlock(height)
-			txs = append(txs, block.Data.Txs...)
-		}
-
-		batch.Delete(calcBlockMetaKey(height))
-		for i := 0; i < meta.BlockID.PartsHeader.Total; i++ {
-			batch.Delete(calcBlockPartKey(height, i))
+		if dryRun {
+			plan.addBlock(bs.blockStoreDB, height, meta)
+		} else {
+			if txIndexDeleter != nil {
+				block := bs.LoadBlock(height)
+				if err := txIndexDeleter.DeleteBlockTxs(height, block.Data.Txs); err != nil {
+					return nil, err
+				}
+			}
+			deleteBlock(batch, height, meta)
 		}
-		batch.Delete(calcBlockCommitKey(height - 1))
-		batch.Delete(calcSeenCommitKey(height))
 
 		if progressInterval > 0 && numHeight%progressInterval == 0 {
 			log.Println(numHeight, "blocks processed: current height", height)
 		}
 
-		if numHeight%batchSize == 0 {
-			batch.Write()
+		if !dryRun && numHeight%batchSize == 0 {
+			if err := bs.writeDeletions(batch, txIndexDeleter, false); err != nil {
+				return nil, err
+			}
 			batch = bs.blockStoreDB.NewBatch()
 		}
 		numHeight++
 	}
-	batch.WriteSync()
-
-	if !skipCompaction {
-		bs.blockStoreDB.Close()
-		db, err := leveldb.OpenFile(path.Join(bs.chainDataDir, "data", "blockstore.db"), nil)
-		if err != nil {
-			return fmt.Errorf("cannot open blockstore.db for compaction, %s", err.Error())
-		}
-		defer db.Close()
-		if err := db.CompactRange(util.Range{}); err != nil {
-			return fmt.Errorf("failed to compact db, %s", err.Error())
-		}
-		log.Println("finished DB compaction")
+	if dryRun {
+		return plan, nil
+	}
+	if err := bs.writeDeletions(batch, txIndexDeleter, true); err != nil {
+		return nil, err
+	}
+	if txIndexDeleter != nil {
+		log.Printf("deleted %d txs from the tx index", txIndexDeleter.NumTxs)
 	}
+	return nil, nil
+}
 
-	// TODO: Needs testing, curently complete untested.
-	if txIndexStore != nil {
-		if err := txIndexStore.Delete(txs); err != nil {
-			return err
+// writeDeletions writes a batch of block deletions. The tx index deletions for the same blocks are
+// flushed first, so if either write fails the blocks are still in the block store, and the purge or
+// rollback can be run again to finish removing them and their txs.
+func (bs *BlockStore) writeDeletions(batch dbm.Batch, txIndexDeleter *TxIndexDeleter, sync bool) error {
+	if txIndexDeleter != nil {
+		if err := txIndexDeleter.Flush(); err != nil {
+			return errors.Wrap(err, "failed to delete txs from the tx index")
 		}
 	}
+	if err := writeBatch(batch, sync); err != nil {
+		return errors.Wrap(err, "failed to delete blocks from the block store")
+	}
 	return nil
 }
 
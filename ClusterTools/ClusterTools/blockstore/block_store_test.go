@@ -0,0 +1,166 @@
+package blockstore
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tendermint/tendermint/crypto/tmhash"
+	"github.com/tendermint/tendermint/types"
+)
+
+// Time of the first block created by makeTestChain.
+var testChainStartTime = time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// makeTestChain creates a block store in chainDataDir containing numBlocks blocks, each block has
+// a single tx, links to the previous block, and is created an hour after the previous block.
+func makeTestChain(t *testing.T, chainDataDir string, numBlocks int64) {
+	_ = os.RemoveAll(chainDataDir)
+	bs := NewBlockStore(chainDataDir, false)
+	defer bs.Close()
+
+	lastCommit := &types.Commit{}
+	for height := int64(1); height <= numBlocks; height++ {
+		txs := []types.Tx{types.Tx([]byte{byte(height)})}
+		block := types.MakeBlock(height, txs, lastCommit, nil)
+		block.ChainID = "test"
+		block.Time = testChainStartTime.Add(time.Duration(height-1) * time.Hour)
+		// the block hash is empty unless the validators hash is set
+		block.ValidatorsHash = tmhash.Sum([]byte("validators"))
+		block.LastBlockID = lastCommit.BlockID
+		partSet := block.MakePartSet(types.BlockPartSizeBytes)
+		blockID := types.BlockID{Hash: block.Hash(), PartsHeader: partSet.Header()}
+		lastCommit = &types.Commit{BlockID: blockID}
+		bs.SaveBlock(block, partSet, lastCommit)
+	}
+	require.Equal(t, numBlocks, bs.Height())
+}
+
+func TestMakeTestChain(t *testing.T) {
+	chainDataDir := "./tempTestChain"
+	makeTestChain(t, chainDataDir, 5)
+	defer os.RemoveAll(chainDataDir)
+
+	bs := NewBlockStore(chainDataDir, true)
+	defer bs.Close()
+
+	// the hash & chaining checks are meaningless if the blocks don't have hashes
+	var prevBlockID types.BlockID
+	for height := int64(1); height <= 5; height++ {
+		meta := bs.LoadBlockMeta(height)
+		require.NotEmpty(t, meta.BlockID.Hash, "height %d", height)
+		require.Equal(t, meta.BlockID.Hash, bs.LoadBlock(height).Hash(), "height %d", height)
+		require.True(t, prevBlockID.Equals(meta.Header.LastBlockID), "height %d", height)
+		if height > 1 {
+			require.True(t, prevBlockID.Equals(bs.LoadBlockCommit(height-1).BlockID), "height %d", height)
+		}
+		prevBlockID = meta.BlockID
+	}
+}
+
+func TestVerifyBlockStore(t *testing.T) {
+	chainDataDir := "./tempVerify"
+	makeTestChain(t, chainDataDir, 10)
+	defer os.RemoveAll(chainDataDir)
+
+	bs := NewBlockStore(chainDataDir, false)
+	defer bs.Close()
+
+	report, err := bs.Verify(0)
+	require.NoError(t, err)
+	require.True(t, report.OK())
+	require.Equal(t, int64(1), report.OldestHeight)
+	require.Equal(t, int64(10), report.LatestHeight)
+	require.Equal(t, int64(10), report.NumValid)
+
+	bs.blockStoreDB.Set(calcSeenCommitKey(3), []byte("garbage"))
+	bs.blockStoreDB.Delete(calcBlockPartKey(5, 0))
+	bs.blockStoreDB.Delete(calcBlockMetaKey(7))
+	bs.blockStoreDB.Delete(calcBlockMetaKey(8))
+	// swap the commits of blocks 1 & 2
+	commit1 := bs.blockStoreDB.Get(calcBlockCommitKey(1))
+	bs.blockStoreDB.Set(calcBlockCommitKey(1), bs.blockStoreDB.Get(calcBlockCommitKey(2)))
+	bs.blockStoreDB.Set(calcBlockCommitKey(2), commit1)
+
+	report, err = bs.Verify(0)
+	require.NoError(t, err)
+	require.False(t, report.OK())
+	require.Equal(t, int64(4), report.NumValid)
+	require.Equal(t, []HeightRange{{From: 7, To: 8}}, report.Gaps)
+	var corruptHeights []int64
+	for _, block := range report.Corrupt {
+		corruptHeights = append(corruptHeights, block.Height)
+		require.NotEmpty(t, block.Problems)
+	}
+	require.Equal(t, []int64{1, 2, 3, 5}, corruptHeights)
+}
+
+func TestPurgeBlockStore(t *testing.T) {
+	chainDataDir := "./tempPurge"
+	makeTestChain(t, chainDataDir, 12)
+	defer os.RemoveAll(chainDataDir)
+
+	bs := NewBlockStore(chainDataDir, false)
+	require.NoError(t, bs.Purge(9, nil, 100, 0, false, true))
+	require.Equal(t, int64(9), bs.OldestHeight())
+	// H:10 sorts before H:9, so the oldest height must not be taken from the first key
+	require.NoError(t, bs.Purge(11, nil, 100, 0, false, false))
+	bs = NewBlockStore(chainDataDir, false)
+	defer bs.Close()
+	require.Equal(t, int64(11), bs.OldestHeight())
+
+	report, err := bs.Verify(0)
+	require.NoError(t, err)
+	require.True(t, report.OK())
+	require.Equal(t, int64(2), report.NumValid)
+}
+
+func TestPlanPurgeAndRollback(t *testing.T) {
+	chainDataDir := "./tempPlanPurge"
+	makeTestChain(t, chainDataDir, 12)
+	defer os.RemoveAll(chainDataDir)
+
+	bs := NewBlockStore(chainDataDir, false)
+	defer bs.Close()
+	countKeys := func() (numKeys int64) {
+		it := bs.blockStoreDB.Iterator(nil, nil)
+		defer it.Close()
+		for ; it.Valid(); it.Next() {
+			numKeys++
+		}
+		return numKeys
+	}
+
+	numKeys := countKeys()
+	plan, err := bs.PlanPurge(6, 0, false)
+	require.NoError(t, err)
+	require.Equal(t, numKeys, countKeys())
+	require.Equal(t, int64(5), plan.NumBlocks)
+	require.Equal(t, int64(1), plan.FromHeight)
+	require.Equal(t, int64(5), plan.ToHeight)
+	require.Equal(t, int64(5), plan.Meta.NumKeys)
+	require.Equal(t, int64(5), plan.SeenCommits.NumKeys)
+	require.Equal(t, int64(6), plan.OldestHeight)
+	require.Equal(t, int64(12), plan.LatestHeight)
+	require.True(t, plan.NumBytes() > 0)
+	// the plan should match what's actually deleted
+	require.NoError(t, bs.Purge(6, nil, 100, 0, false, true))
+	require.Equal(t, numKeys-plan.NumKeys(), countKeys())
+	require.Equal(t, int64(6), bs.OldestHeight())
+
+	numKeys = countKeys()
+	plan, err = bs.PlanRollback(9)
+	require.NoError(t, err)
+	require.Equal(t, numKeys, countKeys())
+	require.Equal(t, int64(3), plan.NumBlocks)
+	require.Equal(t, int64(10), plan.FromHeight)
+	require.Equal(t, int64(12), plan.ToHeight)
+	require.Equal(t, int64(6), plan.OldestHeight)
+	require.Equal(t, int64(9), plan.LatestHeight)
+	require.NoError(t, bs.Rollback(9, nil))
+	require.Equal(t, numKeys-plan.NumKeys(), countKeys())
+
+	_, err = bs.PlanRollback(9)
+	require.Error(t, err)
+}
@@ -0,0 +1,77 @@
+package blockstore
+
+import (
+	dbm "github.com/tendermint/tendermint/libs/db"
+	"github.com/tendermint/tendermint/types"
+)
+
+// BlockKeyStats is the number and total size (keys & values) of one kind of block store entry.
+type BlockKeyStats struct {
+	NumKeys  int64 `json:"numKeys"`
+	NumBytes int64 `json:"numBytes"`
+}
+
+func (s *BlockKeyStats) add(db dbm.DB, key []byte) {
+	if value := db.Get(key); value != nil {
+		s.NumKeys++
+		s.NumBytes += int64(len(key) + len(value))
+	}
+}
+
+// BlockDeletionPlan describes what a purge or rollback of the block store would delete.
+type BlockDeletionPlan struct {
+	// Number of blocks that would be deleted, and the range of heights they're in.
+	NumBlocks  int64 `json:"numBlocks"`
+	FromHeight int64 `json:"fromHeight"`
+	ToHeight   int64 `json:"toHeight"`
+	// The keys that would be deleted.
+	Meta        BlockKeyStats `json:"meta"`
+	Parts       BlockKeyStats `json:"parts"`
+	Commits     BlockKeyStats `json:"commits"`
+	SeenCommits BlockKeyStats `json:"seenCommits"`
+	// The oldest and latest heights left in the block store afterwards, -1 if no blocks are left.
+	OldestHeight int64 `json:"oldestHeight"`
+	LatestHeight int64 `json:"latestHeight"`
+}
+
+// NumKeys returns the total number of keys that would be deleted.
+func (p *BlockDeletionPlan) NumKeys() int64 {
+	return p.Meta.NumKeys + p.Parts.NumKeys + p.Commits.NumKeys + p.SeenCommits.NumKeys
+}
+
+// NumBytes returns the total size of the keys & values that would be deleted. This is an estimate
+// of the space that would be reclaimed once the DB is compacted, LevelDB compresses the data so
+// the actual amount is usually less.
+func (p *BlockDeletionPlan) NumBytes() int64 {
+	return p.Meta.NumBytes + p.Parts.NumBytes + p.Commits.NumBytes + p.SeenCommits.NumBytes
+}
+
+// addBlock records the keys deleteBlock would delete for the block at the given height.
+func (p *BlockDeletionPlan) addBlock(db dbm.DB, height int64, meta *types.BlockMeta) {
+	if p.NumBlocks == 0 || height < p.FromHeight {
+		p.FromHeight = height
+	}
+	if p.NumBlocks == 0 || height > p.ToHeight {
+		p.ToHeight = height
+	}
+	p.NumBlocks++
+	p.Meta.add(db, calcBlockMetaKey(height))
+	if meta != nil {
+		for i := 0; i < meta.BlockID.PartsHeader.Total; i++ {
+			p.Parts.add(db, calcBlockPartKey(height, i))
+		}
+	}
+	p.Commits.add(db, calcBlockCommitKey(height-1))
+	p.SeenCommits.add(db, calcSeenCommitKey(height))
+}
+
+// deleteBlock adds the meta, parts, commit and seen commit of the block at the given height to the
+// batch of deletions.
+func deleteBlock(batch dbm.Batch, height int64, meta *types.BlockMeta) {
+	batch.Delete(calcBlockMetaKey(height))
+	for i := 0; i < meta.BlockID.PartsHeader.Total; i++ {
+		batch.Delete(calcBlockPartKey(height, i))
+	}
+	batch.Delete(calcBlockCommitKey(height - 1))
+	batch.Delete(calcSeenCommitKey(height))
+}
@@ -0,0 +1,130 @@
+package blockstore
+
+import (
+	"bufio"
+	"log"
+	"math"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/tendermint/tendermint/types"
+)
+
+// Export writes the blocks from fromHeight to toHeight (inclusive) to a new block archive file.
+// If fromHeight is zero the export starts at the oldest block in the store, and if toHeight is zero
+// the export ends at the latest block. The archive is written to a temporary file first, and only
+// renamed to archivePath once it's complete.
+func (bs *BlockStore) Export(
+	archivePath string, fromHeight, toHeight, blocksPerChunk, logLevel int64,
+) (*ArchiveHeader, error) {
+	oldestHeight := bs.OldestHeight()
+	latestHeight := bs.Height()
+	if oldestHeight == -1 {
+		return nil, errors.New("no blocks found in the block store")
+	}
+	if fromHeight == 0 {
+		fromHeight = oldestHeight
+	}
+	if toHeight == 0 {
+		toHeight = latestHeight
+	}
+	if fromHeight < oldestHeight || toHeight > latestHeight || fromHeight > toHeight {
+		return nil, errors.Errorf(
+			"can't export blocks %d to %d, the block store contains blocks %d to %d",
+			fromHeight, toHeight, oldestHeight, latestHeight,
+		)
+	}
+
+	metaBytes := bs.blockStoreDB.Get(calcBlockMetaKey(fromHeight))
+	if metaBytes == nil {
+		return nil, errors.Errorf("block %d is missing", fromHeight)
+	}
+	meta := &types.BlockMeta{}
+	if err := cdc.UnmarshalBinaryBare(metaBytes, meta); err != nil {
+		return nil, errors.Wrapf(err, "failed to decode meta of block %d", fromHeight)
+	}
+	header := &ArchiveHeader{
+		ChainID:        meta.Header.ChainID,
+		FromHeight:     fromHeight,
+		ToHeight:       toHeight,
+		BlocksPerChunk: blocksPerChunk,
+	}
+
+	tmpPath := archivePath + ".tmp"
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create archive file")
+	}
+	defer os.Remove(tmpPath)
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	aw, err := NewArchiveWriter(w, *header)
+	if err != nil {
+		return nil, err
+	}
+
+	var progressInterval int64
+	numHeights := toHeight - fromHeight + 1
+	if logLevel > 0 {
+		progressInterval = int64(float64(numHeights) / math.Pow(10, float64(logLevel)))
+	}
+	for height := fromHeight; height <= toHeight; height++ {
+		block, err := bs.loadArchiveBlock(height)
+		if err != nil {
+			return nil, err
+		}
+		if err := aw.WriteBlock(block); err != nil {
+			return nil, errors.Wrapf(err, "failed to write block %d", height)
+		}
+		if progressInterval > 0 && (height-fromHeight+1)%progressInterval == 0 {
+			log.Printf(
+				"%v blocks exported: %v%% done",
+				height-fromHeight+1, (100*(height-fromHeight+1))/numHeights,
+			)
+		}
+	}
+	if err := aw.Close(); err != nil {
+		return nil, err
+	}
+	if err := w.Flush(); err != nil {
+		return nil, errors.Wrap(err, "failed to write archive file")
+	}
+	if err := f.Sync(); err != nil {
+		return nil, errors.Wrap(err, "failed to write archive file")
+	}
+	if err := f.Close(); err != nil {
+		return nil, errors.Wrap(err, "failed to write archive file")
+	}
+	if err := os.Rename(tmpPath, archivePath); err != nil {
+		return nil, errors.Wrap(err, "failed to rename archive file")
+	}
+	return header, nil
+}
+
+// loadArchiveBlock loads the raw data stored for a block, the meta, parts and seen commit must
+// exist, but the commit is optional since it's not stored until the next block is saved.
+func (bs *BlockStore) loadArchiveBlock(height int64) (*ArchiveBlock, error) {
+	block := &ArchiveBlock{Height: height}
+	block.Meta = bs.blockStoreDB.Get(calcBlockMetaKey(height))
+	if block.Meta == nil {
+		return nil, errors.Errorf("block %d is missing", height)
+	}
+	meta := &types.BlockMeta{}
+	if err := cdc.UnmarshalBinaryBare(block.Meta, meta); err != nil {
+		return nil, errors.Wrapf(err, "failed to decode meta of block %d", height)
+	}
+	for i := 0; i < meta.BlockID.PartsHeader.Total; i++ {
+		part := bs.blockStoreDB.Get(calcBlockPartKey(height, i))
+		if part == nil {
+			return nil, errors.Errorf("part %d of block %d is missing", i, height)
+		}
+		block.Parts = append(block.Parts, part)
+	}
+	block.Commit = bs.blockStoreDB.Get(calcBlockCommitKey(height))
+	block.SeenCommit = bs.blockStoreDB.Get(calcSeenCommitKey(height))
+	if block.SeenCommit == nil {
+		return nil, errors.Errorf("seen commit of block %d is missing", height)
+	}
+	return block, nil
+}
@@ -0,0 +1,248 @@
+package blockstore
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"log"
+	"math"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/tendermint/tendermint/blockchain"
+	"github.com/tendermint/tendermint/types"
+)
+
+// Import writes the blocks from a block archive into the block store. The blocks in the archive
+// must either directly precede the oldest block in the store (e.g. to restore blocks that were
+// purged), or directly follow the latest block, unless force is true, in which case existing blocks
+// are overwritten and gaps are allowed. Each block is checked against the hash in its meta, and
+// must link to the block before it. The whole archive is checked before any blocks are written, so
+// an invalid archive leaves the block store unchanged. The block store height is only updated once
+// all the blocks have been written.
+func (bs *BlockStore) Import(archivePath string, force bool, batchSize, logLevel int64) (*ArchiveHeader, error) {
+	header, err := readArchiveHeader(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	if header.FromHeight < 1 || header.FromHeight > header.ToHeight {
+		return nil, errors.Errorf("archive contains invalid range %d to %d", header.FromHeight, header.ToHeight)
+	}
+
+	oldestHeight := bs.OldestHeight()
+	latestHeight := bs.Height()
+	if oldestHeight != -1 && !force {
+		if err := bs.checkImportRange(header, oldestHeight, latestHeight); err != nil {
+			return nil, err
+		}
+	}
+
+	// the blocks before & after the archive are needed to check that the archive links up with them
+	prevMeta, err := bs.loadBlockMeta(header.FromHeight - 1)
+	if err != nil {
+		return nil, err
+	}
+	nextMeta, err := bs.loadBlockMeta(header.ToHeight + 1)
+	if err != nil {
+		return nil, err
+	}
+
+	lastMeta, err := walkArchive(archivePath, header, prevMeta, func(*ArchiveBlock, *types.Block) error {
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if nextMeta != nil && !nextMeta.Header.LastBlockID.Equals(lastMeta.BlockID) {
+		return nil, errors.Errorf(
+			"block %d in the block store doesn't link to block %d from the archive",
+			header.ToHeight+1, header.ToHeight,
+		)
+	}
+	log.Printf("checked blocks %d to %d in the archive", header.FromHeight, header.ToHeight)
+
+	var progressInterval int64
+	numHeights := header.ToHeight - header.FromHeight + 1
+	if logLevel > 0 {
+		progressInterval = int64(float64(numHeights) / math.Pow(10, float64(logLevel)))
+	}
+	batch := bs.blockStoreDB.NewBatch()
+	numInBatch := int64(0)
+	_, err = walkArchive(archivePath, header, prevMeta, func(block *ArchiveBlock, decoded *types.Block) error {
+		height := block.Height
+		// The commit of the block before the archive is only stored with the block after it, so it
+		// won't be in the block store if the archive follows the latest block.
+		if height == header.FromHeight && prevMeta != nil {
+			lastCommit, err := cdc.MarshalBinaryBare(decoded.LastCommit)
+			if err != nil {
+				return errors.Wrapf(err, "failed to encode last commit of block %d", height)
+			}
+			batch.Set(calcBlockCommitKey(height-1), lastCommit)
+		}
+
+		batch.Set(calcBlockMetaKey(height), block.Meta)
+		for i, part := range block.Parts {
+			batch.Set(calcBlockPartKey(height, i), part)
+		}
+		if block.Commit != nil {
+			batch.Set(calcBlockCommitKey(height), block.Commit)
+		}
+		batch.Set(calcSeenCommitKey(height), block.SeenCommit)
+		numInBatch++
+		if numInBatch >= batchSize {
+			if err := writeBatch(batch, false); err != nil {
+				return errors.Wrap(err, "failed to write blocks to the block store")
+			}
+			batch = bs.blockStoreDB.NewBatch()
+			numInBatch = 0
+		}
+
+		if progressInterval > 0 && (height-header.FromHeight+1)%progressInterval == 0 {
+			log.Printf(
+				"%v blocks imported: %v%% done",
+				height-header.FromHeight+1, (100*(height-header.FromHeight+1))/numHeights,
+			)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := writeBatch(batch, true); err != nil {
+		return nil, errors.Wrap(err, "failed to write blocks to the block store")
+	}
+
+	if header.ToHeight > latestHeight {
+		blockchain.BlockStoreStateJSON{Height: header.ToHeight}.Save(bs.blockStoreDB)
+	}
+	return &header, nil
+}
+
+func readArchiveHeader(archivePath string) (ArchiveHeader, error) {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return ArchiveHeader{}, errors.Wrap(err, "failed to open archive file")
+	}
+	defer f.Close()
+	ar, err := NewArchiveReader(bufio.NewReader(f))
+	if err != nil {
+		return ArchiveHeader{}, err
+	}
+	return ar.Header(), nil
+}
+
+// walkArchive reads the blocks in the archive in order, checks each block with checkArchiveBlock
+// (starting with prevMeta as the block before the archive), and calls fn with every valid block.
+// The meta of the last block in the archive is returned.
+func walkArchive(
+	archivePath string, header ArchiveHeader, prevMeta *types.BlockMeta,
+	fn func(block *ArchiveBlock, decoded *types.Block) error,
+) (*types.BlockMeta, error) {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open archive file")
+	}
+	defer f.Close()
+	ar, err := NewArchiveReader(bufio.NewReader(f))
+	if err != nil {
+		return nil, err
+	}
+
+	height := header.FromHeight
+	for ; ; height++ {
+		block, err := ar.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if block.Height != height {
+			return nil, errors.Errorf("expected block %d in archive, found block %d", height, block.Height)
+		}
+		meta, decoded, err := checkArchiveBlock(block, header.ChainID, prevMeta)
+		if err != nil {
+			return nil, err
+		}
+		if err := fn(block, decoded); err != nil {
+			return nil, err
+		}
+		prevMeta = meta
+	}
+	if height-1 != header.ToHeight {
+		return nil, errors.Errorf("archive should end at block %d, but ended at block %d", header.ToHeight, height-1)
+	}
+	return prevMeta, nil
+}
+
+func (bs *BlockStore) checkImportRange(header ArchiveHeader, oldestHeight, latestHeight int64) error {
+	if header.ToHeight+1 != oldestHeight && header.FromHeight != latestHeight+1 {
+		if header.FromHeight <= latestHeight && header.ToHeight >= oldestHeight {
+			return errors.Errorf(
+				"archive blocks %d to %d overlap blocks %d to %d in the block store",
+				header.FromHeight, header.ToHeight, oldestHeight, latestHeight,
+			)
+		}
+		return errors.Errorf(
+			"archive blocks %d to %d are not contiguous with blocks %d to %d in the block store",
+			header.FromHeight, header.ToHeight, oldestHeight, latestHeight,
+		)
+	}
+	meta, err := bs.loadBlockMeta(oldestHeight)
+	if err != nil {
+		return err
+	}
+	if meta != nil && meta.Header.ChainID != header.ChainID {
+		return errors.Errorf(
+			"archive is from chain %s, but the block store is from chain %s", header.ChainID, meta.Header.ChainID,
+		)
+	}
+	return nil
+}
+
+// loadBlockMeta returns nil if there's no block meta at the given height.
+func (bs *BlockStore) loadBlockMeta(height int64) (*types.BlockMeta, error) {
+	metaBytes := bs.blockStoreDB.Get(calcBlockMetaKey(height))
+	if metaBytes == nil {
+		return nil, nil
+	}
+	meta := &types.BlockMeta{}
+	if err := cdc.UnmarshalBinaryBare(metaBytes, meta); err != nil {
+		return nil, errors.Wrapf(err, "failed to decode meta of block %d", height)
+	}
+	return meta, nil
+}
+
+// checkArchiveBlock decodes the meta & parts of a block from an archive, and checks that the block
+// matches the hash in the meta and links to the previous block (if prevMeta isn't nil). The decoded
+// meta & block are returned.
+func checkArchiveBlock(block *ArchiveBlock, chainID string, prevMeta *types.BlockMeta) (*types.BlockMeta, *types.Block, error) {
+	meta := &types.BlockMeta{}
+	if err := cdc.UnmarshalBinaryBare(block.Meta, meta); err != nil {
+		return nil, nil, errors.Wrapf(err, "failed to decode meta of block %d", block.Height)
+	}
+	if meta.Header.Height != block.Height || meta.Header.ChainID != chainID {
+		return nil, nil, errors.Errorf(
+			"meta of block %d is for block %d of chain %s", block.Height, meta.Header.Height, meta.Header.ChainID,
+		)
+	}
+	if len(block.Parts) != meta.BlockID.PartsHeader.Total {
+		return nil, nil, errors.Errorf(
+			"block %d should have %d parts, but has %d", block.Height, meta.BlockID.PartsHeader.Total, len(block.Parts),
+		)
+	}
+	decoded, err := decodeBlockParts(block.Parts)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "invalid block %d", block.Height)
+	}
+	if !bytes.Equal(decoded.Hash(), meta.BlockID.Hash) {
+		return nil, nil, errors.Errorf("hash of block %d doesn't match the hash in the block meta", block.Height)
+	}
+	if prevMeta != nil && !decoded.LastBlockID.Equals(prevMeta.BlockID) {
+		return nil, nil, errors.Errorf("block %d doesn't link to block %d", block.Height, block.Height-1)
+	}
+	if len(block.SeenCommit) == 0 {
+		return nil, nil, errors.Errorf("seen commit of block %d is missing", block.Height)
+	}
+	return meta, decoded, nil
+}
@@ -17,19 +17,26 @@ import (
 	"github.com/tendermint/tendermint/node"
 )
 
+// key under which the height of the last block that was indexed is stored in the block index DB
+var lastIndexedHeightKey = []byte("lastIndexedHeight")
+
 func hashKey(hash []byte) []byte {
 	return append([]byte("BH:"), hash...)
 }
 
 // IndexBlockStore indexes the blocks in the source DB by hash and then writes the index out to the
-// destination DB.
-func IndexBlockStore(rootPath, destDBPath string, batchSize, logLevel int64) error {
+// destination DB. Indexing starts at fromHeight (or height 1 if it's zero), which allows stores
+// that have been purged to be indexed without wading through the missing blocks. The height of the
+// last block that was indexed is stored in the destination DB, and if incremental is true indexing
+// resumes from the block after that height (unless fromHeight is higher). An incremental run fails
+// if that height is above the block store height, since the block store must have been rolled back.
+func IndexBlockStore(rootPath, destDBPath string, fromHeight, batchSize, logLevel int64, incremental bool) error {
 	cfg, err := parseConfig(rootPath)
 	if err != nil {
 		return err
 	}
 	dbProvider := node.DefaultDBProvider
-	blockStoreDB, err := dbProvider(&node.DBContext{"blockstore", cfg})
+	blockStoreDB, err := dbProvider(&node.DBContext{ID: "blockstore", Config: cfg})
 	if err != nil {
 		return err
 	}
@@ -45,11 +52,43 @@ func IndexBlockStore(rootPath, destDBPath string, batchSize, logLevel int64) err
 	defer destDB.Close()
 	batch := new(leveldb.Batch)
 
+	startHeight := uint64(1)
+	if fromHeight > 0 {
+		startHeight = uint64(fromHeight)
+	}
+	endHeight := uint64(blockStore.Height())
+	if incremental {
+		lastHeight, err := destDB.Get(lastIndexedHeightKey, nil)
+		if err != nil && err != leveldb.ErrNotFound {
+			return errors.Wrap(err, "failed to load last indexed height")
+		}
+		if len(lastHeight) == 8 {
+			lastIndexedHeight := binary.BigEndian.Uint64(lastHeight)
+			// The index contains blocks that are no longer in the block store, and the blocks that
+			// replace them would never be indexed.
+			if lastIndexedHeight > endHeight {
+				return errors.Errorf(
+					"blocks were indexed up to height %d, but the block store height is %d, "+
+						"the block store has been rolled back so the index must be rebuilt in a new DB",
+					lastIndexedHeight, endHeight,
+				)
+			}
+			if lastIndexedHeight+1 > startHeight {
+				startHeight = lastIndexedHeight + 1
+			}
+		}
+	}
+	if startHeight > endHeight {
+		log.Printf("no new blocks to index, block store height is %d", endHeight)
+		return nil
+	}
+	log.Printf("indexing blocks %d to %d", startHeight, endHeight)
+
 	progressInterval := uint64(0)
 	if logLevel > 0 {
-		progressInterval = uint64(blockStore.Height()) / uint64(math.Pow(10, float64(logLevel)))
+		progressInterval = (endHeight - startHeight + 1) / uint64(math.Pow(10, float64(logLevel)))
 	}
-	for height := uint64(1); height < uint64(blockStore.Height()); height++ {
+	for height := startHeight; height <= endHeight; height++ {
 		blockmeta := blockStore.LoadBlockMeta(int64(height))
 		heightBuffer := make([]byte, 8)
 		binary.BigEndian.PutUint64(heightBuffer, height)
@@ -59,17 +98,22 @@ func IndexBlockStore(rootPath, destDBPath string, batchSize, logLevel int64) err
 		}
 		batch.Put(hashKey(blockmeta.BlockID.Hash), heightBuffer)
 
-		if (progressInterval > 0) && (height%progressInterval == 0) {
-			log.Printf("%v blocks processed: %v%% done", height, (100*height)/uint64(blockStore.Height()))
+		numIndexed := height - startHeight + 1
+		if (progressInterval > 0) && (numIndexed%progressInterval == 0) {
+			log.Printf("%v blocks processed: %v%% done", numIndexed, (100*numIndexed)/(endHeight-startHeight+1))
 		}
 
-		if height%uint64(batchSize) == 0 {
+		if numIndexed%uint64(batchSize) == 0 {
+			batch.Put(lastIndexedHeightKey, heightBuffer)
 			if err := destDB.Write(batch, &opt.WriteOptions{Sync: false}); err != nil {
 				return errors.Wrap(err, "failed to write batch to DB")
 			}
 			batch.Reset()
 		}
 	}
+	lastHeight := make([]byte, 8)
+	binary.BigEndian.PutUint64(lastHeight, endHeight)
+	batch.Put(lastIndexedHeightKey, lastHeight)
 	if err := destDB.Write(batch, &opt.WriteOptions{Sync: true}); err != nil {
 		return errors.Wrap(err, "failed to write batch to DB")
 	}
@@ -3,14 +3,13 @@ package blockstore
 import (
 	"bytes"
 	"encoding/binary"
-	"fmt"
+	"io/ioutil"
 	"os"
 	"path"
 	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
-	"github.com/tendermint/go-amino"
 	"github.com/tendermint/tendermint/blockchain"
 	"github.com/tendermint/tendermint/libs/db"
 	"github.com/tendermint/tendermint/node"
@@ -23,8 +22,6 @@ const (
 )
 
 var (
-	cdc = amino.NewCodec()
-
 	blockStoreKey = []byte("blockStore")
 	tests         = []struct {
 		height uint64
@@ -55,7 +52,7 @@ func TestIndexBlockStore(t *testing.T) {
 	cfg, err := parseConfig(rootPath)
 	require.NoError(t, err)
 	dbProvider := node.DefaultDBProvider
-	blockStoreDB, err := dbProvider(&node.DBContext{"blockstore", cfg})
+	blockStoreDB, err := dbProvider(&node.DBContext{ID: "blockstore", Config: cfg})
 	require.NoError(t, err)
 
 	for _, test := range tests {
@@ -64,13 +61,13 @@ func TestIndexBlockStore(t *testing.T) {
 		blockStoreDB.Set(calcBlockMetaKey(int64(test.height)), metaBytes)
 	}
 
-	bsj := blockchain.BlockStoreStateJSON{Height: int64(len(tests) + 1)}
+	bsj := blockchain.BlockStoreStateJSON{Height: int64(len(tests))}
 	bsjBytes, err := cdc.MarshalJSON(bsj)
 	require.NoError(t, err)
 	blockStoreDB.SetSync(blockStoreKey, bsjBytes)
 	blockStoreDB.Close()
 
-	require.NoError(t, IndexBlockStore(rootPath, blockIndexDb, 5, 0))
+	require.NoError(t, IndexBlockStore(rootPath, blockIndexDb, 0, 5, 0, false))
 
 	dbName := strings.TrimSuffix(path.Base(blockIndexDb), ".db")
 	dbDir := path.Dir(blockIndexDb)
@@ -79,16 +76,21 @@ func TestIndexBlockStore(t *testing.T) {
 	defer blockIndexDb.Close()
 
 	for _, test := range tests {
-		height := binary.BigEndian.Uint64(blockIndexDb.Get(test.hash))
+		height := binary.BigEndian.Uint64(blockIndexDb.Get(hashKey(test.hash)))
 		require.Equal(t, test.height, height)
 	}
 
+	require.Equal(t, uint64(len(tests)), binary.BigEndian.Uint64(blockIndexDb.Get(lastIndexedHeightKey)))
+
 	iter := blockIndexDb.Iterator(nil, nil)
 	defer iter.Close()
 	for ; iter.Valid(); iter.Next() {
+		if bytes.Equal(iter.Key(), lastIndexedHeightKey) {
+			continue
+		}
 		found := false
 		for _, test := range tests {
-			if binary.BigEndian.Uint64(iter.Value()) == test.height && 0 == bytes.Compare(iter.Key(), test.hash) {
+			if binary.BigEndian.Uint64(iter.Value()) == test.height && 0 == bytes.Compare(iter.Key(), hashKey(test.hash)) {
 				found = true
 				break
 			}
@@ -97,6 +99,64 @@ func TestIndexBlockStore(t *testing.T) {
 	}
 }
 
-func calcBlockMetaKey(height int64) []byte {
-	return []byte(fmt.Sprintf("H:%v", height))
+func TestIndexBlockStoreIncremental(t *testing.T) {
+	chainDataDir := "./tempIndexIncremental"
+	archivePath := "./tempIndexIncremental.ckba"
+	indexDBPath := "./tempIndexIncremental/block_index.db"
+	makeTestChain(t, chainDataDir, 10)
+	defer os.RemoveAll(chainDataDir)
+	defer os.Remove(archivePath)
+	require.NoError(t, os.MkdirAll(path.Join(chainDataDir, "config"), 0755))
+	require.NoError(t, ioutil.WriteFile(path.Join(chainDataDir, "config", "config.toml"), []byte{}, 0644))
+
+	// leave blocks 4 to 7 in the store, and keep the rest of the blocks to import later
+	bs := NewBlockStore(chainDataDir, false)
+	hashes := map[int64][]byte{}
+	for height := int64(1); height <= 10; height++ {
+		hashes[height] = bs.LoadBlockMeta(height).BlockID.Hash
+	}
+	_, err := bs.Export(archivePath, 8, 10, 10, 0)
+	require.NoError(t, err)
+	require.NoError(t, bs.Rollback(7, nil))
+	require.NoError(t, bs.Purge(4, nil, 10, 0, false, true))
+	bs.Close()
+
+	readIndex := func() (map[int64]bool, uint64) {
+		indexDB, err := db.NewGoLevelDB("block_index", chainDataDir)
+		require.NoError(t, err)
+		defer indexDB.Close()
+		indexed := map[int64]bool{}
+		for height, hash := range hashes {
+			indexed[height] = indexDB.Has(hashKey(hash))
+		}
+		return indexed, binary.BigEndian.Uint64(indexDB.Get(lastIndexedHeightKey))
+	}
+
+	require.NoError(t, IndexBlockStore(chainDataDir, indexDBPath, 4, 2, 0, true))
+	indexed, lastHeight := readIndex()
+	require.Equal(t, uint64(7), lastHeight)
+	for height := int64(1); height <= 10; height++ {
+		require.Equal(t, height >= 4 && height <= 7, indexed[height], "height %d", height)
+	}
+
+	bs = NewBlockStore(chainDataDir, false)
+	_, err = bs.Import(archivePath, false, 10, 0)
+	require.NoError(t, err)
+	bs.Close()
+
+	// the next run should only index the new blocks
+	require.NoError(t, IndexBlockStore(chainDataDir, indexDBPath, 0, 2, 0, true))
+	indexed, lastHeight = readIndex()
+	require.Equal(t, uint64(10), lastHeight)
+	for height := int64(1); height <= 10; height++ {
+		require.Equal(t, height >= 4 && height <= 10, indexed[height], "height %d", height)
+	}
+
+	// the index is ahead of the block store once it's rolled back
+	bs = NewBlockStore(chainDataDir, false)
+	require.NoError(t, bs.Rollback(8, nil))
+	bs.Close()
+	require.Error(t, IndexBlockStore(chainDataDir, indexDBPath, 0, 2, 0, true))
+	_, lastHeight = readIndex()
+	require.Equal(t, uint64(10), lastHeight)
 }
@@ -0,0 +1,17 @@
+package blockstore
+
+import (
+	"github.com/dappchain/clusterkit/nodeguard"
+)
+
+// CheckNodeStopped returns a nodeguard.NodeRunningError if there are signs the node that owns
+// chainDataDir is still running: blockstore.db, state.db or tx_index.db is locked, the process in
+// pidFile (if any) is alive, or the RPC listen address in config/config.toml accepts connections.
+func CheckNodeStopped(chainDataDir, pidFile string) error {
+	dbPaths := []string{
+		DBPath(chainDataDir, "blockstore"),
+		DBPath(chainDataDir, "state"),
+		DBPath(chainDataDir, "tx_index"),
+	}
+	return nodeguard.CheckDBs(dbPaths, pidFile, chainDataDir)
+}
@@ -0,0 +1,42 @@
+package blockstore
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/dappchain/clusterkit/nodeguard"
+)
+
+func TestCheckNodeStopped(t *testing.T) {
+	chainDataDir := "./tempNodeGuard"
+	makeTestChain(t, chainDataDir, 3)
+	defer os.RemoveAll(chainDataDir)
+
+	// no config.toml, so only the DB locks are checked
+	require.NoError(t, CheckNodeStopped(chainDataDir, ""))
+
+	blockStore := NewBlockStore(chainDataDir, false)
+	err := CheckNodeStopped(chainDataDir, "")
+	require.IsType(t, &nodeguard.NodeRunningError{}, err)
+	blockStore.Close()
+	require.NoError(t, CheckNodeStopped(chainDataDir, ""))
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	require.NoError(t, os.MkdirAll(path.Join(chainDataDir, "config"), 0755))
+	require.NoError(t, ioutil.WriteFile(
+		path.Join(chainDataDir, "config", "config.toml"),
+		[]byte(fmt.Sprintf("[rpc]\nladdr = \"tcp://0.0.0.0:%d\"\n", ln.Addr().(*net.TCPAddr).Port)),
+		0644,
+	))
+	err = CheckNodeStopped(chainDataDir, "")
+	require.IsType(t, &nodeguard.NodeRunningError{}, err)
+	require.Contains(t, err.Error(), "RPC server")
+}
@@ -0,0 +1,124 @@
+package blockstore
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	dbm "github.com/tendermint/tendermint/libs/db"
+	"github.com/tendermint/tendermint/types"
+)
+
+// BlockSummary contains the details of a block that are useful when inspecting a block store.
+type BlockSummary struct {
+	Height   int64         `json:"height"`
+	BlockID  types.BlockID `json:"block_id"`
+	Header   types.Header  `json:"header"`
+	NumTxs   int           `json:"num_txs"`
+	TxHashes []string      `json:"tx_hashes"`
+	// The commit for the block, or the seen commit if the block store doesn't contain the commit
+	// yet (the commit is saved along with the next block).
+	Commit     *types.Commit `json:"commit"`
+	SeenCommit bool          `json:"seen_commit"`
+}
+
+// LoadBlockSummary loads the block at the given height and its commit.
+func (bs *BlockStore) LoadBlockSummary(height int64) (*BlockSummary, error) {
+	meta, err := bs.loadBlockMeta(height)
+	if err != nil {
+		return nil, err
+	}
+	if meta == nil {
+		return nil, errors.Errorf("block %d not found", height)
+	}
+	block, err := bs.loadBlock(height)
+	if err != nil {
+		return nil, err
+	}
+	summary := &BlockSummary{
+		Height:   height,
+		BlockID:  meta.BlockID,
+		Header:   block.Header,
+		NumTxs:   len(block.Data.Txs),
+		TxHashes: []string{},
+	}
+	for _, tx := range block.Data.Txs {
+		summary.TxHashes = append(summary.TxHashes, fmt.Sprintf("%X", tx.Hash()))
+	}
+
+	commitBytes := bs.blockStoreDB.Get(calcBlockCommitKey(height))
+	if commitBytes == nil {
+		commitBytes = bs.blockStoreDB.Get(calcSeenCommitKey(height))
+		summary.SeenCommit = true
+	}
+	if commitBytes != nil {
+		summary.Commit = &types.Commit{}
+		if err := cdc.UnmarshalBinaryBare(commitBytes, summary.Commit); err != nil {
+			return nil, errors.Wrapf(err, "failed to decode commit of block %d", height)
+		}
+	}
+	return summary, nil
+}
+
+// FindHeightByHash returns the height of the block with the given hash. If the path to a block
+// index DB created by IndexBlockStore is specified the height is looked up in the index, otherwise
+// every block meta in the block store is checked.
+func (bs *BlockStore) FindHeightByHash(hash []byte, blockIndexDBPath string) (int64, error) {
+	if blockIndexDBPath != "" {
+		indexDB, err := dbm.NewGoLevelDBWithOpts(
+			strings.TrimSuffix(path.Base(blockIndexDBPath), ".db"), path.Dir(blockIndexDBPath),
+			&opt.Options{
+				ReadOnly: true,
+			},
+		)
+		if err != nil {
+			return 0, errors.Wrap(err, "failed to open block index DB")
+		}
+		defer indexDB.Close()
+		heightBytes := indexDB.Get(hashKey(hash))
+		if len(heightBytes) != 8 {
+			return 0, errors.Errorf("block %X not found in block index", hash)
+		}
+		return int64(binary.BigEndian.Uint64(heightBytes)), nil
+	}
+
+	it := bs.blockStoreDB.Iterator(calcBlockMetaPrefix, prefixRangeEnd(calcBlockMetaPrefix))
+	defer it.Close()
+	for ; it.Valid(); it.Next() {
+		meta := &types.BlockMeta{}
+		if err := cdc.UnmarshalBinaryBare(it.Value(), meta); err != nil {
+			return 0, errors.Wrapf(err, "failed to decode block meta %s", it.Key())
+		}
+		if bytes.Equal(meta.BlockID.Hash, hash) {
+			return meta.Header.Height, nil
+		}
+	}
+	return 0, errors.Errorf("block %X not found", hash)
+}
+
+// LoadTxResult returns the result of the tx with the given hash from the tx index.
+func (s *TxIndexStore) LoadTxResult(hash []byte) (*types.TxResult, error) {
+	rawTxResult := s.txIndexDB.Get(hash)
+	if len(rawTxResult) == 0 {
+		return nil, errors.Errorf("tx %X not found", hash)
+	}
+	txResult := &types.TxResult{}
+	if err := cdc.UnmarshalBinaryBare(rawTxResult, txResult); err != nil {
+		return nil, fmt.Errorf("error unmarshaling TxResult: %v", err)
+	}
+	return txResult, nil
+}
+
+// ParseHash decodes a hex encoded block or tx hash, with or without a 0x prefix.
+func ParseHash(hash string) ([]byte, error) {
+	decoded, err := hex.DecodeString(strings.TrimPrefix(strings.TrimPrefix(hash, "0x"), "0X"))
+	if err != nil || len(decoded) == 0 {
+		return nil, errors.Errorf("invalid hash '%s'", hash)
+	}
+	return decoded, nil
+}
@@ -0,0 +1,68 @@
+package blockstore
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadBlockSummary(t *testing.T) {
+	chainDataDir := "./tempQuery"
+	makeTestChain(t, chainDataDir, 5)
+	defer os.RemoveAll(chainDataDir)
+	require.NoError(t, os.MkdirAll(path.Join(chainDataDir, "config"), 0755))
+	require.NoError(t, ioutil.WriteFile(path.Join(chainDataDir, "config", "config.toml"), []byte{}, 0644))
+	makeTestTxIndex(t, chainDataDir)
+	require.NoError(t, IndexBlockStore(chainDataDir, path.Join(chainDataDir, "block_index.db"), 0, 10, 0, false))
+
+	bs := NewBlockStore(chainDataDir, true)
+	defer bs.Close()
+
+	summary, err := bs.LoadBlockSummary(3)
+	require.NoError(t, err)
+	block := bs.LoadBlock(3)
+	require.Equal(t, int64(3), summary.Height)
+	require.Equal(t, block.Hash(), summary.BlockID.Hash)
+	require.Equal(t, 1, summary.NumTxs)
+	require.Equal(t, []string{fmt.Sprintf("%X", block.Data.Txs[0].Hash())}, summary.TxHashes)
+	require.False(t, summary.SeenCommit)
+	require.Equal(t, summary.BlockID, summary.Commit.BlockID)
+	_, err = cdc.MarshalJSONIndent(summary, "", "  ")
+	require.NoError(t, err)
+
+	// the latest block only has a seen commit
+	summary, err = bs.LoadBlockSummary(5)
+	require.NoError(t, err)
+	require.True(t, summary.SeenCommit)
+	require.NotNil(t, summary.Commit)
+
+	_, err = bs.LoadBlockSummary(6)
+	require.Error(t, err)
+
+	for _, blockIndexDBPath := range []string{"", path.Join(chainDataDir, "block_index.db")} {
+		height, err := bs.FindHeightByHash(block.Hash(), blockIndexDBPath)
+		require.NoError(t, err)
+		require.Equal(t, int64(3), height)
+		_, err = bs.FindHeightByHash([]byte("missing"), blockIndexDBPath)
+		require.Error(t, err)
+	}
+
+	txIndexStore := NewTxIndexStore(chainDataDir, true)
+	defer txIndexStore.Close()
+	txResult, err := txIndexStore.LoadTxResult(block.Data.Txs[0].Hash())
+	require.NoError(t, err)
+	require.Equal(t, int64(3), txResult.Height)
+	require.Equal(t, block.Data.Txs[0], txResult.Tx)
+	_, err = txIndexStore.LoadTxResult([]byte("missing"))
+	require.Error(t, err)
+
+	hash, err := ParseHash(fmt.Sprintf("0x%X", block.Hash()))
+	require.NoError(t, err)
+	require.Equal(t, []byte(block.Hash()), hash)
+	_, err = ParseHash("xyz")
+	require.Error(t, err)
+}
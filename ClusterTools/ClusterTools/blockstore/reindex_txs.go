@@ -0,0 +1,146 @@
+package blockstore
+
+import (
+	"log"
+	"math"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	cmn "github.com/tendermint/tendermint/libs/common"
+	sm "github.com/tendermint/tendermint/state"
+	"github.com/tendermint/tendermint/types"
+)
+
+// ReindexTxs regenerates the entries the Tendermint kv indexer writes to tx_index.db for the txs in
+// blocks fromHeight to toHeight (inclusive), from the blocks in the block store and the ABCI
+// responses in state.db, and writes them to the destination DB. The tags that are indexed are
+// taken from the tx_index section of the node config. If fromHeight is zero the oldest block in the
+// store is used, and if toHeight is zero the latest block is used. Returns the number of txs indexed.
+func ReindexTxs(rootPath, destDBPath string, fromHeight, toHeight, batchSize, logLevel int64) (int64, error) {
+	cfg, err := parseConfig(rootPath)
+	if err != nil {
+		return 0, err
+	}
+	indexAllTags := cfg.TxIndex.IndexAllTags
+	indexTags := []string{}
+	for _, tag := range strings.Split(cfg.TxIndex.IndexTags, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			indexTags = append(indexTags, tag)
+		}
+	}
+	indexHeight := indexAllTags || cmn.StringInSlice(types.TxHeightKey, indexTags)
+
+	blockStore := NewBlockStore(rootPath, true)
+	defer blockStore.Close()
+	stateStore := NewStateStore(rootPath, true)
+	defer stateStore.Close()
+
+	oldestHeight := blockStore.OldestHeight()
+	latestHeight := blockStore.Height()
+	if fromHeight == 0 {
+		fromHeight = oldestHeight
+	}
+	if toHeight == 0 {
+		toHeight = latestHeight
+	}
+	if oldestHeight == -1 || fromHeight < oldestHeight || toHeight > latestHeight || fromHeight > toHeight {
+		return 0, errors.Errorf(
+			"can't reindex blocks %d to %d, the block store contains blocks %d to %d",
+			fromHeight, toHeight, oldestHeight, latestHeight,
+		)
+	}
+
+	dbName := strings.TrimSuffix(path.Base(destDBPath), ".db")
+	dbDir := path.Dir(destDBPath)
+	destDB, err := leveldb.OpenFile(filepath.Join(dbDir, dbName+".db"), nil)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to open destination DB")
+	}
+	defer destDB.Close()
+	batch := new(leveldb.Batch)
+
+	progressInterval := int64(0)
+	if logLevel > 0 {
+		progressInterval = (toHeight - fromHeight + 1) / int64(math.Pow(10, float64(logLevel)))
+	}
+	numTxs := int64(0)
+	for height := fromHeight; height <= toHeight; height++ {
+		block, err := blockStore.loadBlock(height)
+		if err != nil {
+			return numTxs, err
+		}
+		if len(block.Data.Txs) > 0 {
+			abciResponses, err := sm.LoadABCIResponses(stateStore.stateDB, height)
+			if err != nil {
+				return numTxs, errors.Wrapf(err, "failed to load ABCI responses for block %d", height)
+			}
+			if len(abciResponses.DeliverTx) != len(block.Data.Txs) {
+				return numTxs, errors.Errorf(
+					"block %d contains %d txs, but there are %d ABCI responses",
+					height, len(block.Data.Txs), len(abciResponses.DeliverTx),
+				)
+			}
+			for i, tx := range block.Data.Txs {
+				txResult := &types.TxResult{
+					Height: height,
+					Index:  uint32(i),
+					Tx:     tx,
+					Result: *abciResponses.DeliverTx[i],
+				}
+				for _, tag := range txResult.Result.Tags {
+					if indexAllTags || cmn.StringInSlice(string(tag.Key), indexTags) {
+						batch.Put(txIndexTagKey(tag, txResult), tx.Hash())
+					}
+				}
+				if indexHeight {
+					batch.Put(txIndexHeightKey(txResult), tx.Hash())
+				}
+				rawTxResult, err := cdc.MarshalBinaryBare(txResult)
+				if err != nil {
+					return numTxs, errors.Wrapf(err, "failed to encode result of tx %d in block %d", i, height)
+				}
+				batch.Put(tx.Hash(), rawTxResult)
+				numTxs++
+			}
+		}
+
+		if (progressInterval > 0) && ((height-fromHeight+1)%progressInterval == 0) {
+			log.Printf(
+				"%v blocks processed: %v%% done, %v txs indexed",
+				height-fromHeight+1, (100*(height-fromHeight+1))/(toHeight-fromHeight+1), numTxs,
+			)
+		}
+
+		if int64(batch.Len()) >= batchSize {
+			if err := destDB.Write(batch, &opt.WriteOptions{Sync: false}); err != nil {
+				return numTxs, errors.Wrap(err, "failed to write batch to DB")
+			}
+			batch.Reset()
+		}
+	}
+	if err := destDB.Write(batch, &opt.WriteOptions{Sync: true}); err != nil {
+		return numTxs, errors.Wrap(err, "failed to write batch to DB")
+	}
+	return numTxs, nil
+}
+
+// loadBlock is like LoadBlock but returns an error instead of panicking if the block is missing or
+// can't be decoded.
+func (bs *BlockStore) loadBlock(height int64) (*types.Block, error) {
+	meta, err := bs.loadBlockMeta(height)
+	if err != nil {
+		return nil, err
+	}
+	if meta == nil {
+		return nil, errors.Errorf("block %d is missing", height)
+	}
+	block, err := bs.loadBlockFromParts(height, meta.BlockID.PartsHeader.Total)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to load block %d", height)
+	}
+	return block, nil
+}
@@ -0,0 +1,60 @@
+package blockstore
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	abci "github.com/tendermint/tendermint/abci/types"
+	dbm "github.com/tendermint/tendermint/libs/db"
+	sm "github.com/tendermint/tendermint/state"
+)
+
+func TestReindexTxs(t *testing.T) {
+	chainDataDir := "./tempReindexTxs"
+	destDBPath := "./tempReindexTxs/data/reindexed.db"
+	makeTestChain(t, chainDataDir, 10)
+	defer os.RemoveAll(chainDataDir)
+	require.NoError(t, os.MkdirAll(path.Join(chainDataDir, "config"), 0755))
+	require.NoError(t, ioutil.WriteFile(
+		path.Join(chainDataDir, "config", "config.toml"),
+		[]byte("[tx_index]\nindexer = \"kv\"\nindex_all_tags = true\n"),
+		0644,
+	))
+	makeTestTxIndex(t, chainDataDir)
+
+	stateStore := NewStateStore(chainDataDir, false)
+	for height := int64(1); height <= 10; height++ {
+		abciResponses := &sm.ABCIResponses{
+			DeliverTx: []*abci.ResponseDeliverTx{testDeliverTxResponse(height)},
+			EndBlock:  &abci.ResponseEndBlock{},
+		}
+		stateStore.stateDB.Set(calcABCIResponsesKey(height), abciResponses.Bytes())
+	}
+	stateStore.Close()
+
+	_, err := ReindexTxs(chainDataDir, destDBPath, 5, 11, 3, 0)
+	require.Error(t, err)
+	numTxs, err := ReindexTxs(chainDataDir, destDBPath, 0, 0, 3, 1)
+	require.NoError(t, err)
+	require.Equal(t, int64(10), numTxs)
+
+	// the reindexed DB should be identical to the one written by the Tendermint indexer
+	readAll := func(dbName string) map[string]string {
+		db, err := dbm.NewGoLevelDB(dbName, path.Join(chainDataDir, "data"))
+		require.NoError(t, err)
+		defer db.Close()
+		kvs := map[string]string{}
+		it := db.Iterator(nil, nil)
+		defer it.Close()
+		for ; it.Valid(); it.Next() {
+			kvs[string(it.Key())] = string(it.Value())
+		}
+		return kvs
+	}
+	expected := readAll("tx_index")
+	require.Equal(t, 40, len(expected))
+	require.Equal(t, expected, readAll("reindexed"))
+}
@@ -0,0 +1,137 @@
+package blockstore
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+)
+
+// RetentionPolicy specifies which blocks to keep when the block store is purged. If both limits
+// are set the blocks covered by either one are kept.
+type RetentionPolicy struct {
+	// Number of most recent blocks to keep, zero means no limit.
+	KeepLast int64
+	// Keep the blocks created within this duration of the latest block, zero means no limit.
+	KeepDuration time.Duration
+}
+
+// IsSet checks if any of the limits in the policy are set.
+func (p RetentionPolicy) IsSet() bool {
+	return p.KeepLast > 0 || p.KeepDuration > 0
+}
+
+// LoadRetentionPolicy loads the policy from the retention section of the clusterkit config file
+// at configPath, e.g.
+//
+//	[retention]
+//	keep_last = 100000
+//	keep_duration = "30d"
+//
+// The format of the file is inferred from the extension, TOML, YAML and JSON files are supported.
+func LoadRetentionPolicy(configPath string) (RetentionPolicy, error) {
+	var policy RetentionPolicy
+	v := viper.New()
+	v.SetConfigFile(configPath)
+	if err := v.ReadInConfig(); err != nil {
+		return policy, errors.Wrapf(err, "failed to load %s", configPath)
+	}
+	if !v.IsSet("retention") {
+		return policy, fmt.Errorf("no retention section in %s", configPath)
+	}
+	policy.KeepLast = v.GetInt64("retention.keep_last")
+	if keepDuration := v.GetString("retention.keep_duration"); len(keepDuration) > 0 {
+		var err error
+		policy.KeepDuration, err = ParseRetentionDuration(keepDuration)
+		if err != nil {
+			return policy, err
+		}
+	}
+	return policy, nil
+}
+
+// ParseRetentionDuration parses a duration such as 30d, 2w or 12h. In addition to the units
+// supported by time.ParseDuration, d (24h) and w (7d) are supported as a single unit.
+func ParseRetentionDuration(s string) (time.Duration, error) {
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if strings.HasSuffix(s, suffix) {
+			n, err := strconv.ParseInt(strings.TrimSuffix(s, suffix), 10, 64)
+			if err != nil || n < 0 {
+				return 0, fmt.Errorf("invalid duration '%s'", s)
+			}
+			return time.Duration(n) * unit, nil
+		}
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid duration '%s'", s)
+	}
+	return d, nil
+}
+
+// RetentionHeight returns the height of the oldest block the policy keeps, which is the height to
+// pass to Purge. The block times are taken from the block headers, and KeepDuration is measured
+// back from the time of the latest block rather than the current time, so blocks aren't purged
+// just because the node has been stopped for a while.
+func (bs *BlockStore) RetentionHeight(policy RetentionPolicy) (int64, error) {
+	if !policy.IsSet() {
+		return 0, errors.New("no retention limits set")
+	}
+	latestHeight := bs.Height()
+	oldestHeight := bs.OldestHeight()
+	if oldestHeight == -1 {
+		return 0, errors.New("no blocks found in the block store")
+	}
+
+	targetHeight := latestHeight
+	if policy.KeepLast > 0 {
+		targetHeight = latestHeight - policy.KeepLast + 1
+	}
+	if policy.KeepDuration > 0 {
+		height, err := bs.firstBlockAfter(oldestHeight, latestHeight, policy.KeepDuration)
+		if err != nil {
+			return 0, err
+		}
+		if policy.KeepLast == 0 || height < targetHeight {
+			targetHeight = height
+		}
+	}
+	if targetHeight < oldestHeight {
+		targetHeight = oldestHeight
+	}
+	return targetHeight, nil
+}
+
+// firstBlockAfter returns the height of the oldest block created within the given duration of
+// the latest block. Block times never decrease, so the blocks are binary searched.
+func (bs *BlockStore) firstBlockAfter(oldestHeight, latestHeight int64, d time.Duration) (int64, error) {
+	blockTime := func(height int64) (time.Time, error) {
+		meta := bs.LoadBlockMeta(height)
+		if meta == nil {
+			return time.Time{}, fmt.Errorf("block %d is missing", height)
+		}
+		return meta.Header.Time, nil
+	}
+	latestTime, err := blockTime(latestHeight)
+	if err != nil {
+		return 0, err
+	}
+	cutoff := latestTime.Add(-d)
+	low, high := oldestHeight, latestHeight
+	for low < high {
+		mid := low + (high-low)/2
+		t, err := blockTime(mid)
+		if err != nil {
+			return 0, err
+		}
+		if t.Before(cutoff) {
+			low = mid + 1
+		} else {
+			high = mid
+		}
+	}
+	return low, nil
+}
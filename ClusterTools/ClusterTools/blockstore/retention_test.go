@@ -0,0 +1,81 @@
+package blockstore
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRetentionDuration(t *testing.T) {
+	d, err := ParseRetentionDuration("30d")
+	require.NoError(t, err)
+	require.Equal(t, 30*24*time.Hour, d)
+	d, err = ParseRetentionDuration("2w")
+	require.NoError(t, err)
+	require.Equal(t, 14*24*time.Hour, d)
+	d, err = ParseRetentionDuration("90m")
+	require.NoError(t, err)
+	require.Equal(t, 90*time.Minute, d)
+	_, err = ParseRetentionDuration("d")
+	require.Error(t, err)
+	_, err = ParseRetentionDuration("-1d")
+	require.Error(t, err)
+}
+
+func TestRetentionHeight(t *testing.T) {
+	chainDataDir := "./tempRetention"
+	makeTestChain(t, chainDataDir, 48)
+	defer os.RemoveAll(chainDataDir)
+
+	bs := NewBlockStore(chainDataDir, false)
+	defer bs.Close()
+
+	_, err := bs.RetentionHeight(RetentionPolicy{})
+	require.Error(t, err)
+
+	height, err := bs.RetentionHeight(RetentionPolicy{KeepLast: 10})
+	require.NoError(t, err)
+	require.Equal(t, int64(39), height)
+
+	// the blocks are an hour apart, so blocks 38 to 48 are within 10 hours of the latest block
+	height, err = bs.RetentionHeight(RetentionPolicy{KeepDuration: 10 * time.Hour})
+	require.NoError(t, err)
+	require.Equal(t, int64(38), height)
+
+	// the blocks covered by either limit are kept
+	height, err = bs.RetentionHeight(RetentionPolicy{KeepLast: 20, KeepDuration: 10 * time.Hour})
+	require.NoError(t, err)
+	require.Equal(t, int64(29), height)
+	height, err = bs.RetentionHeight(RetentionPolicy{KeepLast: 100})
+	require.NoError(t, err)
+	require.Equal(t, int64(1), height)
+
+	require.NoError(t, bs.Purge(20, nil, 100, 0, false, true))
+	height, err = bs.RetentionHeight(RetentionPolicy{KeepDuration: 30 * 24 * time.Hour})
+	require.NoError(t, err)
+	require.Equal(t, int64(20), height)
+	height, err = bs.RetentionHeight(RetentionPolicy{KeepDuration: time.Hour})
+	require.NoError(t, err)
+	require.Equal(t, int64(47), height)
+}
+
+func TestLoadRetentionPolicy(t *testing.T) {
+	configPath := "./tempClusterkit.toml"
+	defer os.Remove(configPath)
+
+	require.NoError(t, ioutil.WriteFile(
+		configPath,
+		[]byte("[retention]\nkeep_last = 1000\nkeep_duration = \"30d\"\n"),
+		0644,
+	))
+	policy, err := LoadRetentionPolicy(configPath)
+	require.NoError(t, err)
+	require.Equal(t, RetentionPolicy{KeepLast: 1000, KeepDuration: 30 * 24 * time.Hour}, policy)
+
+	require.NoError(t, ioutil.WriteFile(configPath, []byte("[other]\nkeep_last = 1000\n"), 0644))
+	_, err = LoadRetentionPolicy(configPath)
+	require.Error(t, err)
+}
@@ -0,0 +1,199 @@
+package blockstore
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	dbm "github.com/tendermint/tendermint/libs/db"
+	sm "github.com/tendermint/tendermint/state"
+	"github.com/tendermint/tendermint/types"
+)
+
+// StateStore wraps the Tendermint state.db, which contains the latest state, and the validators,
+// consensus params and ABCI responses for each height.
+type StateStore struct {
+	stateDB dbm.DB
+}
+
+func NewStateStore(chainDataDir string, readOnly bool) *StateStore {
+	var stateDB dbm.DB
+
+	if readOnly {
+		var err error
+		stateDB, err = dbm.NewGoLevelDBWithOpts(
+			"state", path.Join(chainDataDir, "data"),
+			&opt.Options{
+				ReadOnly: true,
+			},
+		)
+		if err != nil {
+			panic("failed to load state store")
+		}
+	} else {
+		stateDB = dbm.NewDB("state", "leveldb", path.Join(chainDataDir, "data"))
+	}
+
+	return &StateStore{
+		stateDB: stateDB,
+	}
+}
+
+func (s *StateStore) Close() {
+	s.stateDB.Close()
+}
+
+// Height returns the height of the last block that was applied to the state.
+func (s *StateStore) Height() int64 {
+	return sm.LoadState(s.stateDB).LastBlockHeight
+}
+
+// stateKey is the key the latest state is stored under in state.db.
+var stateKey = []byte("stateKey")
+
+// StateRollbackCheck is the result of loading one of the records a rollback of state.db is built
+// from, Error is empty if the record was loaded successfully.
+type StateRollbackCheck struct {
+	Name  string `json:"name"`
+	Error string `json:"error,omitempty"`
+}
+
+// StateRollbackPlan contains the state Rollback would save, and the checks made while loading it.
+type StateRollbackPlan struct {
+	TargetHeight int64                `json:"targetHeight"`
+	LatestHeight int64                `json:"latestHeight"`
+	Checks       []StateRollbackCheck `json:"checks"`
+	state        sm.State
+}
+
+// Err returns an error for the first failed check, or nil if all the checks passed.
+func (p *StateRollbackPlan) Err() error {
+	for _, check := range p.Checks {
+		if check.Error != "" {
+			return fmt.Errorf("can't roll back state.db, failed to load %s: %s", check.Name, check.Error)
+		}
+	}
+	return nil
+}
+
+// Rollback rewinds the state to the one that was saved after the block at the target height was
+// applied, and removes the validators, consensus params and ABCI responses saved for any later
+// heights. The block store must still contain the block after the target height, since the app
+// hash resulting from the target block is only stored in the header of the next block.
+func (s *StateStore) Rollback(targetHeight int64, blockStore *BlockStore) error {
+	plan, err := s.PlanRollback(targetHeight, blockStore)
+	if err != nil {
+		return err
+	}
+	return s.ApplyRollback(plan)
+}
+
+// PlanRollback loads everything Rollback needs to rebuild the state at the target height, without
+// modifying state.db. Every record is loaded even if an earlier one fails, the result of each is
+// recorded in the plan's checks.
+func (s *StateStore) PlanRollback(targetHeight int64, blockStore *BlockStore) (*StateRollbackPlan, error) {
+	state := sm.LoadState(s.stateDB)
+	if state.IsEmpty() {
+		return nil, fmt.Errorf("state.db is empty")
+	}
+	latestHeight := state.LastBlockHeight
+	if targetHeight > latestHeight || targetHeight < 1 {
+		return nil, fmt.Errorf(
+			"can't roll back state.db to height %d, current height is %d", targetHeight, latestHeight,
+		)
+	}
+	plan := &StateRollbackPlan{TargetHeight: targetHeight, LatestHeight: latestHeight}
+	if targetHeight == latestHeight {
+		return plan, nil
+	}
+	check := func(name string, err error) {
+		c := StateRollbackCheck{Name: name}
+		if err != nil {
+			c.Error = err.Error()
+		}
+		plan.Checks = append(plan.Checks, c)
+	}
+	loadMeta := func(height int64) *types.BlockMeta {
+		meta, err := blockStore.loadBlockMeta(height)
+		if err == nil && meta == nil {
+			err = fmt.Errorf("block %d isn't in the block store", height)
+		}
+		check(fmt.Sprintf("block meta %d", height), err)
+		return meta
+	}
+
+	meta := loadMeta(targetHeight)
+	nextMeta := loadMeta(targetHeight + 1)
+	// Validator changes take effect two blocks later, so the next validators are those that were
+	// saved for two blocks after the target height.
+	lastValidators, err := sm.LoadValidators(s.stateDB, targetHeight)
+	check(fmt.Sprintf("validators at height %d", targetHeight), err)
+	validators, err := sm.LoadValidators(s.stateDB, targetHeight+1)
+	check(fmt.Sprintf("validators at height %d", targetHeight+1), err)
+	nextValidators, err := sm.LoadValidators(s.stateDB, targetHeight+2)
+	valInfo := &sm.ValidatorsInfo{}
+	if err == nil {
+		err = cdc.UnmarshalBinaryBare(s.stateDB.Get(calcValidatorsKey(targetHeight+2)), valInfo)
+	}
+	check(fmt.Sprintf("validators at height %d", targetHeight+2), err)
+	consensusParams, err := sm.LoadConsensusParams(s.stateDB, targetHeight+1)
+	paramsInfo := &sm.ConsensusParamsInfo{}
+	if err == nil {
+		err = cdc.UnmarshalBinaryBare(s.stateDB.Get(calcConsensusParamsKey(targetHeight+1)), paramsInfo)
+	}
+	check(fmt.Sprintf("consensus params at height %d", targetHeight+1), err)
+	abciResponses, err := sm.LoadABCIResponses(s.stateDB, targetHeight)
+	check(fmt.Sprintf("ABCI responses at height %d", targetHeight), err)
+	if plan.Err() != nil {
+		return plan, nil
+	}
+
+	state.LastBlockHeight = targetHeight
+	state.LastBlockTotalTx = meta.Header.TotalTxs
+	state.LastBlockID = meta.BlockID
+	state.LastBlockTime = meta.Header.Time
+	state.NextValidators = nextValidators
+	state.Validators = validators
+	state.LastValidators = lastValidators
+	state.LastHeightValidatorsChanged = valInfo.LastHeightChanged
+	state.ConsensusParams = consensusParams
+	state.LastHeightConsensusParamsChanged = paramsInfo.LastHeightChanged
+	state.LastResultsHash = abciResponses.ResultsHash()
+	state.AppHash = nextMeta.Header.AppHash
+	plan.state = state
+	return plan, nil
+}
+
+// ApplyRollback saves the state from the plan and deletes the records of the later heights. Both
+// are written in a single batch, so state.db is never left with a state that's missing any of the
+// records it refers to.
+func (s *StateStore) ApplyRollback(plan *StateRollbackPlan) error {
+	if err := plan.Err(); err != nil {
+		return err
+	}
+	if plan.TargetHeight == plan.LatestHeight {
+		return nil
+	}
+	// The validators & consensus params sm.SaveState would write for the target height are the
+	// ones that were loaded from state.db, so only the state itself needs to be written.
+	batch := s.stateDB.NewBatch()
+	batch.Set(stateKey, plan.state.Bytes())
+	for height := plan.TargetHeight + 1; height <= plan.LatestHeight; height++ {
+		batch.Delete(calcABCIResponsesKey(height))
+		batch.Delete(calcValidatorsKey(height + 2))
+		batch.Delete(calcConsensusParamsKey(height + 1))
+	}
+	return writeBatch(batch, true)
+}
+
+func calcValidatorsKey(height int64) []byte {
+	return []byte(fmt.Sprintf("validatorsKey:%v", height))
+}
+
+func calcConsensusParamsKey(height int64) []byte {
+	return []byte(fmt.Sprintf("consensusParamsKey:%v", height))
+}
+
+func calcABCIResponsesKey(height int64) []byte {
+	return []byte(fmt.Sprintf("abciResponsesKey:%v", height))
+}
@@ -0,0 +1,86 @@
+package blockstore
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	abci "github.com/tendermint/tendermint/abci/types"
+	"github.com/tendermint/tendermint/crypto/ed25519"
+	sm "github.com/tendermint/tendermint/state"
+	"github.com/tendermint/tendermint/types"
+)
+
+func TestRollbackStateStore(t *testing.T) {
+	chainDataDir := "./tempRollbackState"
+	makeTestChain(t, chainDataDir, 6)
+	defer os.RemoveAll(chainDataDir)
+
+	bs := NewBlockStore(chainDataDir, false)
+	defer bs.Close()
+	ss := NewStateStore(chainDataDir, false)
+	defer ss.Close()
+
+	validators := types.NewValidatorSet([]*types.Validator{types.NewValidator(ed25519.GenPrivKey().PubKey(), 10)})
+	states := map[int64]sm.State{}
+	for height := int64(0); height <= 5; height++ {
+		state := sm.State{
+			ChainID:                          "test",
+			LastBlockHeight:                  height,
+			NextValidators:                   validators,
+			Validators:                       validators,
+			LastValidators:                   validators,
+			LastHeightValidatorsChanged:      1,
+			ConsensusParams:                  *types.DefaultConsensusParams(),
+			LastHeightConsensusParamsChanged: 1,
+		}
+		if height > 0 {
+			meta, err := bs.loadBlockMeta(height)
+			require.NoError(t, err)
+			state.LastBlockID = meta.BlockID
+			state.LastBlockTime = meta.Header.Time
+			abciResponses := &sm.ABCIResponses{
+				DeliverTx: []*abci.ResponseDeliverTx{{Data: []byte{byte(height)}}},
+				EndBlock:  &abci.ResponseEndBlock{},
+			}
+			ss.stateDB.Set(calcABCIResponsesKey(height), abciResponses.Bytes())
+			state.LastResultsHash = abciResponses.ResultsHash()
+		}
+		sm.SaveState(ss.stateDB, state)
+		states[height] = state
+	}
+	require.Equal(t, int64(5), ss.Height())
+
+	require.Error(t, ss.Rollback(6, bs))
+	require.NoError(t, ss.Rollback(3, bs))
+	require.Equal(t, int64(3), ss.Height())
+
+	state := sm.LoadState(ss.stateDB)
+	expected := states[3]
+	require.Equal(t, expected.LastBlockID, state.LastBlockID)
+	require.Equal(t, expected.LastResultsHash, state.LastResultsHash)
+	require.Equal(t, expected.Validators.Hash(), state.Validators.Hash())
+	require.Equal(t, expected.NextValidators.Hash(), state.NextValidators.Hash())
+	require.Equal(t, expected.LastHeightValidatorsChanged, state.LastHeightValidatorsChanged)
+	require.Equal(t, expected.ConsensusParams, state.ConsensusParams)
+	require.Equal(t, expected.LastHeightConsensusParamsChanged, state.LastHeightConsensusParamsChanged)
+
+	for height := int64(4); height <= 5; height++ {
+		require.False(t, ss.stateDB.Has(calcABCIResponsesKey(height)))
+		require.False(t, ss.stateDB.Has(calcValidatorsKey(height+2)))
+	}
+	require.True(t, ss.stateDB.Has(calcABCIResponsesKey(3)))
+	require.True(t, ss.stateDB.Has(calcValidatorsKey(5)))
+
+	// nothing is changed if any of the records the state is rebuilt from are missing
+	ss.stateDB.Delete(calcABCIResponsesKey(2))
+	plan, err := ss.PlanRollback(2, bs)
+	require.NoError(t, err)
+	require.Len(t, plan.Checks, 7)
+	require.Error(t, plan.Err())
+	require.Equal(t, "ABCI responses at height 2", plan.Checks[6].Name)
+	require.NotEmpty(t, plan.Checks[6].Error)
+	require.Error(t, ss.ApplyRollback(plan))
+	require.Equal(t, int64(3), ss.Height())
+	require.True(t, ss.stateDB.Has(calcValidatorsKey(5)))
+}
@@ -6,6 +6,7 @@ import (
 
 	"github.com/syndtr/goleveldb/leveldb/opt"
 	"github.com/tendermint/tendermint/blockchain"
+	cmn "github.com/tendermint/tendermint/libs/common"
 	dbm "github.com/tendermint/tendermint/libs/db"
 	"github.com/tendermint/tendermint/types"
 )
@@ -42,21 +43,73 @@ func (s *TxIndexStore) Close() {
 	s.txIndexDB.Close()
 }
 
-func (s *TxIndexStore) Delete(txs []types.Tx) error {
-	batch := s.txIndexDB.NewBatch()
+// TxIndexDeleter removes the entries written by the Tendermint kv indexer for the txs in a block:
+// the tx result stored under the tx hash, the tx.height key, and the keys for the tags of the tx.
+// Deletions are written to the tx index store in batches.
+type TxIndexDeleter struct {
+	store      *TxIndexStore
+	batch      dbm.Batch
+	batchSize  int64
+	numInBatch int64
+	NumTxs     int64
+	NumKeys    int64
+}
+
+func (s *TxIndexStore) NewDeleter(batchSize int64) *TxIndexDeleter {
+	return &TxIndexDeleter{
+		store:     s,
+		batch:     s.txIndexDB.NewBatch(),
+		batchSize: batchSize,
+	}
+}
+
+// DeleteBlockTxs deletes the index entries of the txs in the block at the given height. If the
+// same tx was included in a later block the index entries for that block are left alone.
+func (d *TxIndexDeleter) DeleteBlockTxs(height int64, txs []types.Tx) error {
 	for _, tx := range txs {
-		rawTxResult := s.txIndexDB.Get(tx.Hash())
-		if len(rawTxResult) > 0 {
-			batch.Delete(tx.Hash())
+		rawTxResult := d.store.txIndexDB.Get(tx.Hash())
+		if len(rawTxResult) == 0 {
+			continue
+		}
+		txResult := types.TxResult{}
+		if err := cdc.UnmarshalBinaryBare(rawTxResult, &txResult); err != nil {
+			return fmt.Errorf("error unmarshaling TxResult: %v", err)
+		}
+		if txResult.Height != height {
+			continue
+		}
 
-			txResult := types.TxResult{}
-			if err := cdc.UnmarshalBinaryBare(rawTxResult, &txResult); err != nil {
-				return fmt.Errorf("error unmarshaling TxResult: %v", err)
+		d.delete(tx.Hash())
+		d.delete(txIndexHeightKey(&txResult))
+		for _, tag := range txResult.Result.Tags {
+			d.delete(txIndexTagKey(tag, &txResult))
+		}
+		d.NumTxs++
+		if d.numInBatch >= d.batchSize {
+			if err := d.Flush(); err != nil {
+				return err
 			}
-			batch.Delete(txIndexHeightKey(&txResult))
 		}
 	}
-	batch.Write()
+	return nil
+}
+
+func (d *TxIndexDeleter) delete(key []byte) {
+	d.batch.Delete(key)
+	d.numInBatch++
+	d.NumKeys++
+}
+
+// Flush writes any pending deletions to the tx index store.
+func (d *TxIndexDeleter) Flush() error {
+	if d.numInBatch == 0 {
+		return nil
+	}
+	if err := writeBatch(d.batch, true); err != nil {
+		return err
+	}
+	d.batch = d.store.txIndexDB.NewBatch()
+	d.numInBatch = 0
 	return nil
 }
 
@@ -68,3 +121,12 @@ func txIndexHeightKey(result *types.TxResult) []byte {
 		result.Index,
 	))
 }
+
+func txIndexTagKey(tag cmn.KVPair, result *types.TxResult) []byte {
+	return []byte(fmt.Sprintf("%s/%s/%d/%d",
+		tag.Key,
+		tag.Value,
+		result.Height,
+		result.Index,
+	))
+}
@@ -0,0 +1,141 @@
+package blockstore
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	abci "github.com/tendermint/tendermint/abci/types"
+	"github.com/tendermint/tendermint/crypto/tmhash"
+	cmn "github.com/tendermint/tendermint/libs/common"
+	"github.com/tendermint/tendermint/state/txindex/kv"
+	"github.com/tendermint/tendermint/types"
+)
+
+// makeTestTxIndex indexes the txs in the test chain with the Tendermint kv indexer, each tx is
+// indexed by hash, height, and two tags.
+func makeTestTxIndex(t *testing.T, chainDataDir string) {
+	bs := NewBlockStore(chainDataDir, true)
+	defer bs.Close()
+	txIndexStore := NewTxIndexStore(chainDataDir, false)
+	defer txIndexStore.Close()
+
+	indexer := kv.NewTxIndex(txIndexStore.txIndexDB, kv.IndexAllTags())
+	for height := int64(1); height <= bs.Height(); height++ {
+		block := bs.LoadBlock(height)
+		for i, tx := range block.Data.Txs {
+			require.NoError(t, indexer.Index(&types.TxResult{
+				Height: height,
+				Index:  uint32(i),
+				Tx:     tx,
+				Result: *testDeliverTxResponse(height),
+			}))
+		}
+	}
+}
+
+func testDeliverTxResponse(height int64) *abci.ResponseDeliverTx {
+	return &abci.ResponseDeliverTx{
+		Data: []byte{byte(height)},
+		Tags: []cmn.KVPair{
+			{Key: []byte("account.from"), Value: []byte(fmt.Sprintf("account%d", height%3))},
+			{Key: []byte("contract"), Value: []byte("coin")},
+		},
+	}
+}
+
+// txIndexKeyHeights returns the number of tx index keys for each block height.
+func txIndexKeyHeights(t *testing.T, chainDataDir string) map[int64]int {
+	txIndexStore := NewTxIndexStore(chainDataDir, true)
+	defer txIndexStore.Close()
+
+	heights := map[int64]int{}
+	it := txIndexStore.txIndexDB.Iterator(nil, nil)
+	defer it.Close()
+	for ; it.Valid(); it.Next() {
+		// the tx results are keyed by hash, all the other keys point to the hash
+		hash := it.Key()
+		if len(hash) != tmhash.Size {
+			hash = it.Value()
+		}
+		txResult := types.TxResult{}
+		require.NoError(t, cdc.UnmarshalBinaryBare(txIndexStore.txIndexDB.Get(hash), &txResult))
+		heights[txResult.Height]++
+	}
+	return heights
+}
+
+func TestPurgeTxIndex(t *testing.T) {
+	chainDataDir := "./tempPurgeTxIndex"
+	makeTestChain(t, chainDataDir, 10)
+	defer os.RemoveAll(chainDataDir)
+	makeTestTxIndex(t, chainDataDir)
+	require.Equal(t, 10, len(txIndexKeyHeights(t, chainDataDir)))
+
+	bs := NewBlockStore(chainDataDir, false)
+	txIndexStore := NewTxIndexStore(chainDataDir, false)
+	require.NoError(t, bs.Purge(6, txIndexStore, 2, 0, false, true))
+	bs.Close()
+	txIndexStore.Close()
+
+	require.Equal(t, map[int64]int{6: 4, 7: 4, 8: 4, 9: 4, 10: 4}, txIndexKeyHeights(t, chainDataDir))
+}
+
+func TestRollbackTxIndex(t *testing.T) {
+	chainDataDir := "./tempRollbackTxIndex"
+	makeTestChain(t, chainDataDir, 10)
+	defer os.RemoveAll(chainDataDir)
+	makeTestTxIndex(t, chainDataDir)
+
+	bs := NewBlockStore(chainDataDir, false)
+	txIndexStore := NewTxIndexStore(chainDataDir, false)
+	require.NoError(t, bs.Rollback(7, txIndexStore))
+	bs.Close()
+	txIndexStore.Close()
+
+	heights := txIndexKeyHeights(t, chainDataDir)
+	require.Equal(t, 7, len(heights))
+	for height := int64(1); height <= 7; height++ {
+		require.Equal(t, 4, heights[height])
+	}
+}
+
+func TestTxIndexDeleterKeepsNewerTxResults(t *testing.T) {
+	chainDataDir := "./tempTxIndexDeleter"
+	makeTestChain(t, chainDataDir, 3)
+	defer os.RemoveAll(chainDataDir)
+	makeTestTxIndex(t, chainDataDir)
+
+	txIndexStore := NewTxIndexStore(chainDataDir, false)
+	defer txIndexStore.Close()
+	bs := NewBlockStore(chainDataDir, true)
+	defer bs.Close()
+
+	// the tx in block 3 is indexed at height 3, so trying to delete it as part of block 1 is a no-op
+	deleter := txIndexStore.NewDeleter(1)
+	require.NoError(t, deleter.DeleteBlockTxs(1, bs.LoadBlock(3).Data.Txs))
+	require.Equal(t, int64(0), deleter.NumTxs)
+	require.NoError(t, deleter.DeleteBlockTxs(3, bs.LoadBlock(3).Data.Txs))
+	require.NoError(t, deleter.Flush())
+	require.Equal(t, int64(1), deleter.NumTxs)
+	require.Equal(t, int64(4), deleter.NumKeys)
+	require.False(t, txIndexStore.txIndexDB.Has(bs.LoadBlock(3).Data.Txs[0].Hash()))
+}
+
+func TestTxIndexDeleterFlushError(t *testing.T) {
+	chainDataDir := "./tempTxIndexFlushError"
+	makeTestChain(t, chainDataDir, 3)
+	defer os.RemoveAll(chainDataDir)
+	makeTestTxIndex(t, chainDataDir)
+
+	txIndexStore := NewTxIndexStore(chainDataDir, false)
+	bs := NewBlockStore(chainDataDir, true)
+	defer bs.Close()
+
+	deleter := txIndexStore.NewDeleter(10)
+	require.NoError(t, deleter.DeleteBlockTxs(3, bs.LoadBlock(3).Data.Txs))
+	// writes to a closed DB fail
+	txIndexStore.Close()
+	require.Error(t, deleter.Flush())
+}
@@ -1,5 +1,33 @@
 package blockstore
 
+import (
+	"fmt"
+	"path"
+
+	dbm "github.com/tendermint/tendermint/libs/db"
+)
+
+// DBPath returns the path of the LevelDB with the given name (e.g. blockstore) in chainDataDir.
+func DBPath(chainDataDir, name string) string {
+	return path.Join(chainDataDir, "data", name+".db")
+}
+
+// writeBatch writes the batch to the DB, and returns an error if the write fails instead of
+// panicking like dbm.Batch does.
+func writeBatch(batch dbm.Batch, sync bool) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("failed to write batch: %v", r)
+		}
+	}()
+	if sync {
+		batch.WriteSync()
+	} else {
+		batch.Write()
+	}
+	return nil
+}
+
 // Returns the bytes that mark the end of the key range for the given prefix.
 func prefixRangeEnd(prefix []byte) []byte {
 	if prefix == nil {
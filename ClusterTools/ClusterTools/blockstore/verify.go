@@ -0,0 +1,192 @@
+package blockstore
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"math"
+
+	"github.com/tendermint/tendermint/types"
+)
+
+// HeightRange is an inclusive range of block heights.
+type HeightRange struct {
+	From int64 `json:"from"`
+	To   int64 `json:"to"`
+}
+
+// CorruptBlock lists the problems found with the data stored for a block.
+type CorruptBlock struct {
+	Height   int64    `json:"height"`
+	Problems []string `json:"problems"`
+}
+
+// VerifyReport is the result of checking the consistency of a block store.
+type VerifyReport struct {
+	OldestHeight int64
+	LatestHeight int64
+	// Number of heights checked without finding any problems
+	NumValid int64
+	// Heights with no block meta
+	Gaps    []HeightRange
+	Corrupt []CorruptBlock
+}
+
+func (r *VerifyReport) OK() bool {
+	return len(r.Gaps) == 0 && len(r.Corrupt) == 0
+}
+
+func (r *VerifyReport) addGap(height int64) {
+	if n := len(r.Gaps); n > 0 && r.Gaps[n-1].To+1 == height {
+		r.Gaps[n-1].To = height
+		return
+	}
+	r.Gaps = append(r.Gaps, HeightRange{From: height, To: height})
+}
+
+// OldestHeight returns the lowest height for which there's a block meta in the block store, or -1
+// if the store is empty. Heights are not zero-padded in the keys so every key has to be checked.
+func (bs *BlockStore) OldestHeight() int64 {
+	oldestHeight := int64(-1)
+	it := bs.blockStoreDB.Iterator(calcBlockMetaPrefix, prefixRangeEnd(calcBlockMetaPrefix))
+	defer it.Close()
+	for ; it.Valid(); it.Next() {
+		height := getHeightFromKey(it.Key())
+		if height > 0 && (oldestHeight == -1 || height < oldestHeight) {
+			oldestHeight = height
+		}
+	}
+	return oldestHeight
+}
+
+// Verify walks every height from the oldest block in the store to the latest, and checks that the
+// block meta, parts, commit and seen commit exist and can be decoded, that the block reassembled
+// from the parts matches the block ID in the meta, and that each block links to the previous one.
+func (bs *BlockStore) Verify(logLevel int64) (*VerifyReport, error) {
+	report := &VerifyReport{
+		OldestHeight: bs.OldestHeight(),
+		LatestHeight: bs.Height(),
+	}
+	if report.OldestHeight == -1 {
+		return nil, fmt.Errorf("no blocks found in the block store")
+	}
+	log.Printf("verifying blocks %d to %d", report.OldestHeight, report.LatestHeight)
+
+	var progressInterval int64
+	numHeights := report.LatestHeight - report.OldestHeight + 1
+	if logLevel > 0 {
+		progressInterval = int64(float64(numHeights) / math.Pow(10, float64(logLevel)))
+	}
+
+	var prevMeta *types.BlockMeta
+	for height := report.OldestHeight; height <= report.LatestHeight; height++ {
+		meta, problems := bs.verifyBlock(height, prevMeta)
+		if meta == nil && len(problems) == 0 {
+			report.addGap(height)
+		} else if len(problems) > 0 {
+			report.Corrupt = append(report.Corrupt, CorruptBlock{Height: height, Problems: problems})
+		} else {
+			report.NumValid++
+		}
+		prevMeta = meta
+
+		if progressInterval > 0 && (height-report.OldestHeight+1)%progressInterval == 0 {
+			log.Printf(
+				"%v blocks verified: %v%% done",
+				height-report.OldestHeight+1, (100*(height-report.OldestHeight+1))/numHeights,
+			)
+		}
+	}
+	return report, nil
+}
+
+// verifyBlock checks the data stored for the block at the given height, and returns the block meta
+// (nil if it's missing or can't be decoded) along with any problems found.
+func (bs *BlockStore) verifyBlock(height int64, prevMeta *types.BlockMeta) (*types.BlockMeta, []string) {
+	metaBytes := bs.blockStoreDB.Get(calcBlockMetaKey(height))
+	if metaBytes == nil {
+		return nil, nil
+	}
+
+	var problems []string
+	meta := &types.BlockMeta{}
+	if err := cdc.UnmarshalBinaryBare(metaBytes, meta); err != nil {
+		return nil, []string{fmt.Sprintf("failed to decode block meta: %v", err)}
+	}
+	if meta.Header.Height != height {
+		problems = append(problems, fmt.Sprintf("block meta is for height %d", meta.Header.Height))
+	}
+
+	block, err := bs.loadBlockFromParts(height, meta.BlockID.PartsHeader.Total)
+	if err != nil {
+		problems = append(problems, err.Error())
+	} else {
+		if !bytes.Equal(meta.BlockID.Hash, block.Hash()) {
+			problems = append(problems, fmt.Sprintf(
+				"block hash %X doesn't match block meta hash %X", block.Hash(), meta.BlockID.Hash,
+			))
+		}
+		if prevMeta != nil && !block.LastBlockID.Equals(prevMeta.BlockID) {
+			problems = append(problems, fmt.Sprintf(
+				"last block ID %v doesn't match block ID %v of previous block", block.LastBlockID, prevMeta.BlockID,
+			))
+		}
+	}
+
+	// The commit for a block is stored along with the next block, so the latest block doesn't
+	// have one yet.
+	if bs.Has(calcBlockMetaKey(height + 1)) {
+		if problem := bs.verifyCommit(calcBlockCommitKey(height), "commit", meta.BlockID); problem != "" {
+			problems = append(problems, problem)
+		}
+	}
+	if problem := bs.verifyCommit(calcSeenCommitKey(height), "seen commit", meta.BlockID); problem != "" {
+		problems = append(problems, problem)
+	}
+	return meta, problems
+}
+
+func (bs *BlockStore) verifyCommit(key []byte, name string, blockID types.BlockID) string {
+	commitBytes := bs.blockStoreDB.Get(key)
+	if commitBytes == nil {
+		return fmt.Sprintf("%s is missing", name)
+	}
+	commit := &types.Commit{}
+	if err := cdc.UnmarshalBinaryBare(commitBytes, commit); err != nil {
+		return fmt.Sprintf("failed to decode %s: %v", name, err)
+	}
+	if !commit.BlockID.Equals(blockID) {
+		return fmt.Sprintf("%s is for block %v instead of %v", name, commit.BlockID, blockID)
+	}
+	return ""
+}
+
+// loadBlockFromParts is like LoadBlock but returns an error instead of panicking if any of the
+// parts are missing or the block can't be decoded.
+func (bs *BlockStore) loadBlockFromParts(height int64, numParts int) (*types.Block, error) {
+	parts := make([][]byte, numParts)
+	for i := 0; i < numParts; i++ {
+		parts[i] = bs.blockStoreDB.Get(calcBlockPartKey(height, i))
+		if parts[i] == nil {
+			return nil, fmt.Errorf("block part %d of %d is missing", i, numParts)
+		}
+	}
+	return decodeBlockParts(parts)
+}
+
+// decodeBlockParts reassembles a block from the raw parts stored in the block store.
+func decodeBlockParts(parts [][]byte) (*types.Block, error) {
+	buf := []byte{}
+	for i, partBytes := range parts {
+		part := &types.Part{}
+		if err := cdc.UnmarshalBinaryBare(partBytes, part); err != nil {
+			return nil, fmt.Errorf("failed to decode block part %d: %v", i, err)
+		}
+		buf = append(buf, part.Bytes...)
+	}
+	block := &types.Block{}
+	if err := cdc.UnmarshalBinaryLengthPrefixed(buf, block); err != nil {
+		return nil, fmt.Errorf("failed to decode block: %v", err)
+	}
+	return block, nil
+}
@@ -2,11 +2,18 @@ package blockstore
 
 import (
 	amino "github.com/tendermint/go-amino"
-	cryptoAmino "github.com/tendermint/tendermint/crypto/encoding/amino"
+	"github.com/tendermint/tendermint/types"
 )
 
 var cdc = amino.NewCodec()
 
 func init() {
-	cryptoAmino.RegisterAmino(cdc)
+	// registers the crypto & evidence types needed to decode full blocks
+	types.RegisterBlockAmino(cdc)
+}
+
+// MarshalJSONIndent encodes blocks, commits, tx results etc. to JSON in the same format as the
+// Tendermint RPC.
+func MarshalJSONIndent(v interface{}) ([]byte, error) {
+	return cdc.MarshalJSONIndent(v, "", "  ")
 }
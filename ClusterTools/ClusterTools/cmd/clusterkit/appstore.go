@@ -1,11 +1,17 @@
 package main
 
 import (
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"log"
 	"os"
 	"path/filepath"
+	"strconv"
+	"text/tabwriter"
 	"time"
 
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 
 	"github.com/dappchain/clusterkit/appstore"
@@ -16,6 +22,8 @@ func newCloneAppStoreCommand() *cobra.Command {
 	var logLevel uint64
 	var savesPerCommit uint64
 	var srcValueDBPath string
+	var resume, verifyKeys, force bool
+	var pidFile, chainDataDir string
 	cloneAppStoreCmd := &cobra.Command{
 		Use:   "clone <path/to/src/app.db> <path/to/dest/app.db>",
 		Short: "Clones a single version of the IAVL tree from an IAVL store DB to a new DB",
@@ -45,7 +53,20 @@ func newCloneAppStoreCommand() *cobra.Command {
 				return fmt.Errorf("DB cannot be found at '%s'", srcDBPath)
 			}
 			if _, err := os.Stat(destDBPath); !os.IsNotExist(err) {
-				return fmt.Errorf("Something already exists at '%s', please specify another path", destDBPath)
+				if !resume {
+					return fmt.Errorf("Something already exists at '%s', please specify another path", destDBPath)
+				}
+			} else {
+				// nothing to resume from, start from scratch
+				resume = false
+			}
+			if !force {
+				if err := appstore.CheckDBNotInUse(srcDBPath, pidFile, chainDataDir); err != nil {
+					return err
+				}
+				if err := appstore.CheckDBNotInUse(destDBPath, "", ""); err != nil {
+					return err
+				}
 			}
 
 			if height > 0 {
@@ -54,7 +75,7 @@ func newCloneAppStoreCommand() *cobra.Command {
 				fmt.Println("Cloning the app store from ", srcDBPath, " at its current height")
 			}
 			start := time.Now()
-			err = appstore.CloneIAVLTreeFromDB(srcDBPath, valueDBPath, destDBPath, height, logLevel, savesPerCommit)
+			err = appstore.CloneIAVLTreeFromDB(srcDBPath, valueDBPath, destDBPath, height, logLevel, savesPerCommit, resume, verifyKeys)
 			if err != nil {
 				fmt.Println("Failed cloning ", srcDBPath, ", time taken ", time.Now().Sub(start))
 				return err
@@ -67,6 +88,7 @@ func newCloneAppStoreCommand() *cobra.Command {
 				return nil
 			}
 			fmt.Println("Original DB size ", sizeOld, " bytes")
+			output.set("originalSizeBytes", sizeOld)
 
 			sizeNew, err := dirSize(destDBPath)
 			if err != nil {
@@ -74,6 +96,7 @@ func newCloneAppStoreCommand() *cobra.Command {
 				return nil
 			}
 			fmt.Println("New DB size", sizeNew, " bytes")
+			output.set("newSizeBytes", sizeNew)
 			return nil
 		},
 	}
@@ -81,6 +104,10 @@ func newCloneAppStoreCommand() *cobra.Command {
 	cloneAppStoreCmd.Flags().Uint64VarP(&logLevel, "log", "l", 0, "log Level. Debug information displayed every (100*10^-Loglevel)% of keys. Example 1 every 10%, 2 every 1%, 3 every 0.1%")
 	cloneAppStoreCmd.Flags().Uint64VarP(&savesPerCommit, "saves-per-commit", "s", 0, "Number of saves between commits. zero means no intermediate commits.")
 	cloneAppStoreCmd.Flags().StringVar(&srcValueDBPath, "src-value-db", "", "Optional path to app_state.db")
+	cloneAppStoreCmd.Flags().BoolVar(&resume, "resume", false, "Resume an interrupted clone from the last checkpoint in the destination DB. Checkpoints are saved with every intermediate commit.")
+	cloneAppStoreCmd.Flags().BoolVar(&verifyKeys, "verify-keys", false, "Compare all the keys & values of the clone to the source after cloning, by default only the root hashes are compared.")
+	addNodeGuardFlags(cloneAppStoreCmd, &force, &pidFile)
+	addChainDataFlag(cloneAppStoreCmd, &chainDataDir)
 	return cloneAppStoreCmd
 }
 
@@ -98,9 +125,151 @@ func dirSize(path string) (int64, error) {
 	return size, err
 }
 
+func newVerifyAppStoreCommand() *cobra.Command {
+	var height int64
+	var srcValueDBPath string
+	var verifyKeys bool
+	cmd := &cobra.Command{
+		Use:   "verify <path/to/src/app.db> <path/to/dest/app.db>",
+		Short: "Verifies that an IAVL tree cloned to a new DB matches the tree in the source DB",
+		Args:  cobra.MinimumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			srcDBPath, err := filepath.Abs(args[0])
+			if err != nil {
+				return fmt.Errorf("Failed to resolve source DB path '%s'", args[0])
+			}
+			destDBPath, err := filepath.Abs(args[1])
+			if err != nil {
+				return fmt.Errorf("Failed to resolve destination DB path '%s'", args[1])
+			}
+
+			var valueDBPath string
+			if len(srcValueDBPath) > 0 {
+				valueDBPath, err = filepath.Abs(srcValueDBPath)
+				if err != nil {
+					return fmt.Errorf("Failed to resolve value DB path '%s'", srcValueDBPath)
+				}
+				if info, err := os.Stat(valueDBPath); os.IsNotExist(err) || !info.IsDir() {
+					return fmt.Errorf("DB cannot be found at '%s'", valueDBPath)
+				}
+			}
+
+			if info, err := os.Stat(srcDBPath); os.IsNotExist(err) || !info.IsDir() {
+				return fmt.Errorf("DB cannot be found at '%s'", srcDBPath)
+			}
+			if info, err := os.Stat(destDBPath); os.IsNotExist(err) || !info.IsDir() {
+				return fmt.Errorf("DB cannot be found at '%s'", destDBPath)
+			}
+
+			start := time.Now()
+			result, err := appstore.VerifyIAVLTreeClone(srcDBPath, valueDBPath, destDBPath, height, verifyKeys)
+			if err != nil {
+				return err
+			}
+			output.set("version", result.Version)
+			output.set("srcRootHash", fmt.Sprintf("%X", result.SrcRootHash))
+			output.set("cloneRootHash", fmt.Sprintf("%X", result.DestRootHash))
+			output.set("keysVerified", result.KeysVerified)
+			output.set("numKeys", result.NumKeys)
+			if result.DivergingKey != nil {
+				output.set("divergingKey", fmt.Sprintf("%X", result.DivergingKey))
+			}
+			fmt.Printf("Source root hash %X at version %d\n", result.SrcRootHash, result.Version)
+			fmt.Printf("Clone root hash  %X at version %d\n", result.DestRootHash, result.Version)
+			if result.KeysVerified {
+				fmt.Printf("%d matching keys compared\n", result.NumKeys)
+			}
+			fmt.Printf("Time taken %v\n", time.Since(start))
+			if err := result.Err(); err != nil {
+				return err
+			}
+			fmt.Println("Clone matches the source")
+			return nil
+		},
+	}
+	cmd.Flags().Int64VarP(&height, "height", "b", 0, "IAVL tree version to verify. Default is the latest version in the clone.")
+	cmd.Flags().StringVar(&srcValueDBPath, "src-value-db", "", "Optional path to app_state.db")
+	cmd.Flags().BoolVar(&verifyKeys, "verify-keys", false, "Walk both trees and report the first diverging key, by default only the root hashes are compared.")
+	return cmd
+}
+
+func newDiffAppStoreCommand() *cobra.Command {
+	var heightA, heightB int64
+	var prefix, format string
+	var fullValues bool
+	cmd := &cobra.Command{
+		Use:   "diff <path/to/a/app.db> <path/to/b/app.db>",
+		Short: "Lists the keys that were added, removed or changed between two IAVL tree versions",
+		Long: "Lists the keys that were added, removed or changed between two IAVL tree versions.\n" +
+			"The same DB can be specified twice to compare two versions of the same tree.",
+		Args: cobra.MinimumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dbPathA, err := filepath.Abs(args[0])
+			if err != nil {
+				return fmt.Errorf("Failed to resolve DB path '%s'", args[0])
+			}
+			dbPathB, err := filepath.Abs(args[1])
+			if err != nil {
+				return fmt.Errorf("Failed to resolve DB path '%s'", args[1])
+			}
+			for _, dbPath := range []string{dbPathA, dbPathB} {
+				if info, err := os.Stat(dbPath); os.IsNotExist(err) || !info.IsDir() {
+					return fmt.Errorf("DB cannot be found at '%s'", dbPath)
+				}
+			}
+
+			var stats appstore.IAVLTreeDiffStats
+			if output.isJSON() {
+				// stdout is reserved for the result object, so the diffs are included in it
+				diffs := []appstore.KeyDiffEntry{}
+				stats, err = appstore.DiffIAVLTrees(dbPathA, dbPathB, heightA, heightB, prefix, func(diff appstore.KeyDiff) error {
+					diffs = append(diffs, appstore.NewKeyDiffEntry(diff, fullValues))
+					return nil
+				})
+				if err != nil {
+					return err
+				}
+				output.set("diffs", diffs)
+			} else {
+				w, err := appstore.NewKeyDiffWriter(os.Stdout, format, fullValues)
+				if err != nil {
+					return err
+				}
+				stats, err = appstore.DiffIAVLTrees(dbPathA, dbPathB, heightA, heightB, prefix, w.Write)
+				if flushErr := w.Flush(); err == nil {
+					err = flushErr
+				}
+				if err != nil {
+					return err
+				}
+			}
+			output.set("versionA", stats.VersionA)
+			output.set("versionB", stats.VersionB)
+			output.set("numAdded", stats.NumAdded)
+			output.set("numRemoved", stats.NumRemoved)
+			output.set("numChanged", stats.NumChanged)
+			output.set("numUnchanged", stats.NumUnchanged)
+			log.Printf(
+				"Compared version %d of %s with version %d of %s: %d added, %d removed, %d changed, %d unchanged keys. Time taken %v",
+				stats.VersionA, dbPathA, stats.VersionB, dbPathB,
+				stats.NumAdded, stats.NumRemoved, stats.NumChanged, stats.NumUnchanged, stats.TimeTaken,
+			)
+			return nil
+		},
+	}
+	cmdFlags := cmd.Flags()
+	cmdFlags.Int64Var(&heightA, "height-a", 0, "IAVL tree version to load from the first DB. Default is the latest version.")
+	cmdFlags.Int64Var(&heightB, "height-b", 0, "IAVL tree version to load from the second DB. Default is the latest version.")
+	cmdFlags.StringVarP(&prefix, "prefix", "p", "", "Only compare keys with this prefix, default \"\" to compare all keys.")
+	cmdFlags.StringVar(&format, "format", appstore.DiffFormatText, "Output format: text, json (JSON lines) or csv. Ignored with --output json, the diffs are included in the result object.")
+	cmdFlags.BoolVar(&fullValues, "full-values", false, "Output full values instead of value hashes.")
+	return cmd
+}
+
 func newExtractEvmCommand() *cobra.Command {
 	var logLevel, batchSize uint64
 	var height int64
+	var workers int
 	extractEvmCommand := &cobra.Command{
 		Use:   "extract-evm-state <path/to/src/app.db> <path/to/dest/db>",
 		Short: "Extract the latest EVM state from app.db to a separate LevelDB",
@@ -122,17 +291,89 @@ func newExtractEvmCommand() *cobra.Command {
 				return fmt.Errorf("Something already exists at '%s', please specify another path", destDBPath)
 			}
 
-			return appstore.CopyEvmToLevelDb(srcDBPath, destDBPath, batchSize, logLevel, height)
+			output.set("destDB", destDBPath)
+			err = appstore.CopyEvmToLevelDb(srcDBPath, destDBPath, batchSize, logLevel, height, workers)
+			output.setWriteError(err)
+			return err
 		},
 	}
 	extractEvmCommand.Flags().Uint64Var(&logLevel, "log", 0, "How often progress output should be printed. 1 - every 10%, 2 - every 1%, 3 - every 0.1%.")
 	extractEvmCommand.Flags().Uint64Var(&batchSize, "batch-size", 10000, "Number of keys to write in each batch.")
 	extractEvmCommand.Flags().Int64Var(&height, "height", 0, "app.db height at which EVM state is extracted")
+	extractEvmCommand.Flags().IntVar(&workers, "workers", 1, "Number of workers to walk the IAVL tree with in parallel.")
 	return extractEvmCommand
 }
 
+func newVerifyEvmCommand() *cobra.Command {
+	var height int64
+	cmd := &cobra.Command{
+		Use:   "verify-evm <path/to/app.db> <path/to/evm.db>",
+		Short: "Verifies that the EVM state extracted by extract-evm-state matches the EVM state in app.db",
+		Args:  cobra.MinimumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			appDBPath, err := filepath.Abs(args[0])
+			if err != nil {
+				return fmt.Errorf("Failed to resolve app DB path '%s'", args[0])
+			}
+			evmDBPath, err := filepath.Abs(args[1])
+			if err != nil {
+				return fmt.Errorf("Failed to resolve EVM DB path '%s'", args[1])
+			}
+			if info, err := os.Stat(appDBPath); os.IsNotExist(err) || !info.IsDir() {
+				return fmt.Errorf("DB cannot be found at '%s'", appDBPath)
+			}
+			if info, err := os.Stat(evmDBPath); os.IsNotExist(err) || !info.IsDir() {
+				return fmt.Errorf("DB cannot be found at '%s'", evmDBPath)
+			}
+
+			start := time.Now()
+			result, err := appstore.VerifyEvmExtraction(appDBPath, evmDBPath, height)
+			if err != nil {
+				return err
+			}
+			output.set("version", result.Version)
+			output.set("numKeys", result.NumKeys)
+			output.set("numMissing", result.NumMissing)
+			output.set("numExtra", result.NumExtra)
+			output.set("numDifferent", result.NumDifferent)
+			output.set("expectedRoot", fmt.Sprintf("%X", result.ExpectedRoot))
+			output.set("evmRoot", fmt.Sprintf("%X", result.EvmRoot))
+			output.set("missingKeys", hexKeys(result.MissingKeys))
+			output.set("extraKeys", hexKeys(result.ExtraKeys))
+			output.set("differentKeys", hexKeys(result.DifferentKeys))
+			fmt.Printf("Compared EVM state at height %d, %d matching keys\n", result.Version, result.NumKeys)
+			printKeys := func(desc string, num uint64, keys [][]byte) {
+				if num == 0 || output.isJSON() {
+					return
+				}
+				fmt.Printf("%d %s keys", num, desc)
+				if uint64(len(keys)) < num {
+					fmt.Printf(", first %d", len(keys))
+				}
+				fmt.Println(":")
+				for _, key := range keys {
+					fmt.Printf("  %X\n", key)
+				}
+			}
+			printKeys("missing", result.NumMissing, result.MissingKeys)
+			printKeys("extra", result.NumExtra, result.ExtraKeys)
+			printKeys("different", result.NumDifferent, result.DifferentKeys)
+			fmt.Printf("Expected vmevmroot %X, evm.db has %X\n", result.ExpectedRoot, result.EvmRoot)
+			fmt.Printf("Time taken %v\n", time.Since(start))
+			if err := result.Err(); err != nil {
+				return err
+			}
+			fmt.Println("evm.db matches app.db")
+			return nil
+		},
+	}
+	cmd.Flags().Int64VarP(&height, "height", "b", 0, "app.db height the EVM state was extracted at. Default is the latest height.")
+	return cmd
+}
+
 func newExtractEvmAuxCommand() *cobra.Command {
 	var logLevel, batchSize uint64
+	var height, fromBlock, toBlock int64
 	var onlyBloomFilter, onlyTxHash bool
 	extractEvmCommand := &cobra.Command{
 		Use:   "extract-evm-data <path/to/src/app.db> <path/to/dest/db>",
@@ -153,20 +394,92 @@ func newExtractEvmAuxCommand() *cobra.Command {
 			}
 			bloomfilter := !onlyTxHash
 			txHash := !onlyBloomFilter
-			return appstore.CopyEvmAuxiliary(srcDBPath, destDBPath, batchSize, logLevel, bloomfilter, txHash)
+			output.set("destDB", destDBPath)
+			err = appstore.CopyEvmAuxiliary(
+				srcDBPath, destDBPath, batchSize, logLevel, bloomfilter, txHash, height, fromBlock, toBlock,
+			)
+			output.setWriteError(err)
+			return err
 		},
 	}
 	extractEvmCommand.Flags().Uint64Var(&logLevel, "log", 0, "How often progress output should be printed. 1 - every 10%, 2 - every 1%, 3 - every 0.1%.")
 	extractEvmCommand.Flags().Uint64Var(&batchSize, "batch-size", 10000, "Number of keys to write in each batch.")
 	extractEvmCommand.Flags().BoolVar(&onlyBloomFilter, "bloom-filters", false, "Extract bloom filters only")
 	extractEvmCommand.Flags().BoolVar(&onlyTxHash, "tx-hashes", false, "Extract EVM Tx Hashes only")
+	extractEvmCommand.Flags().Int64Var(&height, "height", 0, "app.db height at which EVM data is extracted. Defaults to the latest height.")
+	extractEvmCommand.Flags().Int64Var(&fromBlock, "from-block", 0, "Only extract the EVM data of blocks from this height onwards.")
+	extractEvmCommand.Flags().Int64Var(&toBlock, "to-block", 0, "Only extract the EVM data of blocks up to this height. Defaults to --height.")
 	return extractEvmCommand
 }
 
+func newExtractPrefixCommand() *cobra.Command {
+	var logLevel, batchSize uint64
+	var height int64
+	var workers int
+	var prefixes []string
+	var rulesPath string
+	cmd := &cobra.Command{
+		Use:   "extract-prefix <path/to/src/app.db> <path/to/dest/db> --prefix <prefix> --rules <path/to/rules.json>",
+		Short: "Extract the keys with the given prefixes from app.db to a separate LevelDB, rewriting the keys using the rules in the rule file",
+		Args:  cobra.MinimumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			srcDBPath, err := filepath.Abs(args[0])
+			if err != nil {
+				return fmt.Errorf("Failed to resolve source DB path '%s'", args[0])
+			}
+			destDBPath, err := filepath.Abs(args[1])
+			if err != nil {
+				return fmt.Errorf("Failed to resolve destination DB path '%s'", args[1])
+			}
+
+			if info, err := os.Stat(srcDBPath); os.IsNotExist(err) || !info.IsDir() {
+				return fmt.Errorf("DB cannot be found at '%s'", srcDBPath)
+			}
+			if _, err := os.Stat(destDBPath); !os.IsNotExist(err) {
+				return fmt.Errorf("Something already exists at '%s', please specify another path", destDBPath)
+			}
+
+			var rules *appstore.KeyRewriteRules
+			if rulesPath != "" {
+				if rules, err = appstore.LoadKeyRewriteRules(rulesPath); err != nil {
+					return err
+				}
+				// extract all the prefixes in the rule file unless specific prefixes were requested
+				if len(prefixes) == 0 {
+					prefixes = rules.Prefixes()
+				}
+			}
+			if len(prefixes) == 0 {
+				return fmt.Errorf("at least one prefix must be specified with --prefix or --rules")
+			}
+
+			output.set("destDB", destDBPath)
+			output.set("prefixes", prefixes)
+			numKeys, err := appstore.ExtractPrefixes(srcDBPath, destDBPath, prefixes, rules, height, batchSize, logLevel, workers)
+			output.set("numKeys", numKeys)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Extracted %d keys to %s\n", numKeys, destDBPath)
+			return nil
+		},
+	}
+	cmdFlags := cmd.Flags()
+	cmdFlags.StringSliceVar(&prefixes, "prefix", nil, "Prefix of the keys to extract, can be specified multiple times. Defaults to all the prefixes in the rule file.")
+	cmdFlags.StringVar(&rulesPath, "rules", "", "Path to a JSON file with the rules used to rewrite the extracted keys.")
+	cmdFlags.Uint64Var(&logLevel, "log", 0, "How often progress output should be printed. 1 - every 10%, 2 - every 1%, 3 - every 0.1%.")
+	cmdFlags.Uint64Var(&batchSize, "batch-size", 10000, "Number of keys to write in each batch.")
+	cmdFlags.Int64Var(&height, "height", 0, "app.db height at which the keys are extracted. Defaults to the latest height.")
+	cmdFlags.IntVar(&workers, "workers", 1, "Number of workers to walk the IAVL tree with in parallel.")
+	return cmd
+}
+
 func newTotalDataCommand() *cobra.Command {
 	var blockNumber int64
-	var prefix string
+	var prefix, sortBy, format string
 	var logLevel uint64
+	var workers int
+	var grouping appstore.PrefixGrouping
 	totalDataCmd := &cobra.Command{
 		Use:   "total-data <path/to/app.db>",
 		Short: "Displays stats for an IAVL store DB. WARNING: Might take a long time with a large DB!",
@@ -180,10 +493,27 @@ func newTotalDataCommand() *cobra.Command {
 				return fmt.Errorf("DB not found at %s", dbPath)
 			}
 
-			stats, err := appstore.TotalData(dbPath, prefix, blockNumber, logLevel)
+			if grouping.Bytes > 0 || grouping.Segments > 0 {
+				if format != "table" && format != "json" {
+					return fmt.Errorf("unsupported format '%s'", format)
+				}
+				groups, stats, err := appstore.TotalDataByPrefix(dbPath, prefix, blockNumber, logLevel, workers, grouping, sortBy)
+				if err != nil {
+					return err
+				}
+				setTotalDataOutput(stats)
+				output.set("groups", newPrefixGroupsJSON(groups))
+				if output.isJSON() {
+					return nil
+				}
+				return printPrefixGroups(groups, stats, format)
+			}
+
+			stats, err := appstore.TotalData(dbPath, prefix, blockNumber, logLevel, workers)
 			if err != nil {
 				return err
 			}
+			setTotalDataOutput(stats)
 
 			fmt.Printf(
 				"%v keys found, key total %v bytes, values total %v bytes for a combined memory used of %v bytes.\nTime taken %v seconds.\n",
@@ -196,11 +526,283 @@ func newTotalDataCommand() *cobra.Command {
 	totalDataCmd.Flags().StringVarP(&prefix, "prefix", "p", "", "prefix for keys to total, default \"\" to total all keys.")
 	totalDataCmd.Flags().Uint64VarP(&logLevel, "log", "l", 0, "log Level. Debug information displayed every (100*10^-Loglevel)% of keys. Example 1 every 10%, 2 every 1%, 3 every 0.1%")
 	totalDataCmd.Flags().Int64VarP(&blockNumber, "height", "b", 0, "block height from which to clone app store. Default is the current height.")
+	totalDataCmd.Flags().IntVar(&workers, "workers", 1, "Number of workers to walk the IAVL tree with in parallel.")
+	totalDataCmd.Flags().IntVar(&grouping.Bytes, "group-bytes", 0, "Break down the stats by the first N bytes of each key.")
+	totalDataCmd.Flags().IntVar(&grouping.Segments, "group-segments", 0, "Break down the stats by the first N \\x00-delimited segments of each key.")
+	totalDataCmd.Flags().StringVar(&sortBy, "sort", appstore.SortGroupsByBytes, "Order of the breakdown: bytes, keys or prefix.")
+	totalDataCmd.Flags().StringVar(&format, "format", "table", "Format of the breakdown: table or json.")
 	return totalDataCmd
 }
 
+func setTotalDataOutput(stats appstore.IAVLStoreStats) {
+	output.set("numKeys", stats.NumKeys)
+	output.set("totalKeyBytes", stats.TotalKeyBytes)
+	output.set("totalValueBytes", stats.TotalValueBytes)
+}
+
+type prefixGroupJSON struct {
+	Prefix          string `json:"prefix"`
+	PrefixHex       string `json:"prefixHex"`
+	NumKeys         uint64 `json:"numKeys"`
+	TotalKeyBytes   uint64 `json:"totalKeyBytes"`
+	TotalValueBytes uint64 `json:"totalValueBytes"`
+	MaxValueSize    uint64 `json:"maxValueSize"`
+	P50ValueSize    uint64 `json:"p50ValueSize"`
+	P99ValueSize    uint64 `json:"p99ValueSize"`
+}
+
+func newPrefixGroupsJSON(groups []*appstore.IAVLStoreGroupStats) []prefixGroupJSON {
+	out := make([]prefixGroupJSON, 0, len(groups))
+	for _, g := range groups {
+		out = append(out, prefixGroupJSON{
+			Prefix:          strconv.Quote(string(g.Prefix)),
+			PrefixHex:       hex.EncodeToString(g.Prefix),
+			NumKeys:         g.NumKeys,
+			TotalKeyBytes:   g.TotalKeyBytes,
+			TotalValueBytes: g.TotalValueBytes,
+			MaxValueSize:    g.MaxValueSize,
+			P50ValueSize:    g.P50ValueSize,
+			P99ValueSize:    g.P99ValueSize,
+		})
+	}
+	return out
+}
+
+func printPrefixGroups(groups []*appstore.IAVLStoreGroupStats, stats appstore.IAVLStoreStats, format string) error {
+	switch format {
+	case "json":
+		out := struct {
+			NumKeys         uint64            `json:"numKeys"`
+			TotalKeyBytes   uint64            `json:"totalKeyBytes"`
+			TotalValueBytes uint64            `json:"totalValueBytes"`
+			Groups          []prefixGroupJSON `json:"groups"`
+		}{
+			NumKeys:         stats.NumKeys,
+			TotalKeyBytes:   stats.TotalKeyBytes,
+			TotalValueBytes: stats.TotalValueBytes,
+			Groups:          newPrefixGroupsJSON(groups),
+		}
+		buf, err := json.MarshalIndent(out, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(buf))
+	case "table":
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+		fmt.Fprintln(w, "PREFIX\tKEYS\tKEY BYTES\tVALUE BYTES\tMAX VALUE\tP50 VALUE\tP99 VALUE\t")
+		for _, g := range groups {
+			fmt.Fprintf(
+				w, "%q\t%d\t%d\t%d\t%d\t%d\t%d\t\n",
+				g.Prefix, g.NumKeys, g.TotalKeyBytes, g.TotalValueBytes, g.MaxValueSize, g.P50ValueSize, g.P99ValueSize,
+			)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		fmt.Printf(
+			"%v keys in %v groups, key total %v bytes, values total %v bytes.\nTime taken %v seconds.\n",
+			stats.NumKeys, len(groups), stats.TotalKeyBytes, stats.TotalValueBytes, int64(stats.TimeTaken.Seconds()),
+		)
+	default:
+		return fmt.Errorf("unsupported format '%s'", format)
+	}
+	return nil
+}
+
+func newAnalyzeStorageCommand() *cobra.Command {
+	var logLevel uint64
+	var skipCloneEstimate bool
+	cmd := &cobra.Command{
+		Use:   "analyze-storage <path/to/app.db>",
+		Short: "Reports how much space IAVL nodes, orphans & roots take up in an IAVL store DB",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dbPath, err := filepath.Abs(args[0])
+			if err != nil {
+				return fmt.Errorf("Failed to resolve source DB path '%s'", args[0])
+			}
+			if info, err := os.Stat(dbPath); os.IsNotExist(err) || !info.IsDir() {
+				return fmt.Errorf("DB cannot be found at '%s'", dbPath)
+			}
+
+			stats, err := appstore.AnalyzeIAVLStorage(dbPath, !skipCloneEstimate, logLevel)
+			if err != nil {
+				return err
+			}
+
+			output.set("nodes", stats.Nodes)
+			output.set("orphans", stats.Orphans)
+			output.set("roots", stats.Roots)
+			output.set("other", stats.Other)
+			output.set("numVersions", stats.NumVersions)
+			output.set("latestVersion", stats.LatestVersion)
+			output.set("versions", stats.Versions)
+			if stats.CloneEstimated {
+				output.set("latestNodes", stats.LatestNodes)
+				output.set("latestLeaves", stats.LatestLeaves)
+				output.set("reclaimableBytes", stats.ReclaimableBytes())
+			}
+
+			if !output.isJSON() {
+				w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+				fmt.Fprintln(w, "CATEGORY\tKEYS\tKEY BYTES\tVALUE BYTES\tTOTAL BYTES\t")
+				for _, c := range []struct {
+					name  string
+					stats appstore.KeySpaceStats
+				}{
+					{"nodes (n)", stats.Nodes},
+					{"orphans (o)", stats.Orphans},
+					{"roots (r)", stats.Roots},
+					{"other", stats.Other},
+				} {
+					fmt.Fprintf(
+						w, "%s\t%d\t%d\t%d\t%d\t\n",
+						c.name, c.stats.NumKeys, c.stats.KeyBytes, c.stats.ValueBytes, c.stats.TotalBytes(),
+					)
+				}
+				if err := w.Flush(); err != nil {
+					return err
+				}
+			}
+
+			fmt.Printf("%d persisted versions, latest version %d\n", stats.NumVersions, stats.LatestVersion)
+			printVersionRanges(stats.Versions)
+
+			if stats.CloneEstimated {
+				fmt.Printf(
+					"Latest version has %d nodes (%d leaves) taking up %d bytes\n",
+					stats.LatestNodes.NumKeys, stats.LatestLeaves, stats.LatestNodes.TotalBytes(),
+				)
+				fmt.Printf(
+					"Cloning the latest version would reclaim approximately %d of %d bytes\n",
+					stats.ReclaimableBytes(), stats.TotalBytes(),
+				)
+			}
+			if size, err := dirSize(dbPath); err == nil {
+				fmt.Println("DB size on disk ", size, " bytes")
+				output.set("sizeBytes", size)
+			}
+			fmt.Printf("Time taken %v\n", stats.TimeTaken)
+			return nil
+		},
+	}
+	cmd.Flags().Uint64VarP(&logLevel, "log", "l", 0, "Print progress every million keys if greater than zero.")
+	cmd.Flags().BoolVar(&skipCloneEstimate, "skip-clone-estimate", false, "Don't walk the latest version to estimate how much space a clone would reclaim.")
+	return cmd
+}
+
+func newPruneAppStoreCommand() *cobra.Command {
+	var keepRecent, keepEvery int64
+	var logLevel uint64
+	var dryRun, skipCompaction, force bool
+	var pidFile, chainDataDir, backupDir string
+	cmd := &cobra.Command{
+		Use:   "prune <path/to/app.db> --keep-recent <versions>",
+		Short: "Deletes old IAVL tree versions and their orphaned nodes from an IAVL store DB in place",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dbPath, err := filepath.Abs(args[0])
+			if err != nil {
+				return fmt.Errorf("Failed to resolve DB path '%s'", args[0])
+			}
+			if info, err := os.Stat(dbPath); os.IsNotExist(err) || !info.IsDir() {
+				return fmt.Errorf("DB cannot be found at '%s'", dbPath)
+			}
+			if !force && !dryRun {
+				if err := appstore.CheckDBNotInUse(dbPath, pidFile, chainDataDir); err != nil {
+					return err
+				}
+			}
+
+			sizeOld, err := dirSize(dbPath)
+			if err != nil {
+				return errors.Wrapf(err, "failed to compute size of '%s'", dbPath)
+			}
+			if dryRun {
+				// nothing is modified, so there's nothing to back up
+				backupDir = ""
+			}
+			var stats *appstore.IAVLPruneStats
+			err = withBackup(backupDir, "app-store-prune", []string{dbPath}, func() error {
+				var err error
+				stats, err = appstore.PruneIAVLVersions(dbPath, keepRecent, keepEvery, dryRun, skipCompaction, logLevel)
+				return err
+			})
+			if err != nil {
+				return err
+			}
+
+			output.set("dryRun", dryRun)
+			output.set("numNodes", stats.NumNodes)
+			output.set("numBytes", stats.NumBytes)
+			output.set("latestVersion", stats.LatestVersion)
+			output.set("prunedVersions", stats.PrunedVersions)
+			output.set("keptVersions", stats.KeptVersions)
+			output.set("originalSizeBytes", sizeOld)
+
+			action := "Pruned"
+			if dryRun {
+				action = "Would prune"
+			}
+			fmt.Printf(
+				"%s %d orphaned nodes taking up %d bytes (uncompressed) from the following versions:\n",
+				action, stats.NumNodes, stats.NumBytes,
+			)
+			printVersionRanges(stats.PrunedVersions)
+			fmt.Printf("Kept versions (latest %d):\n", stats.LatestVersion)
+			printVersionRanges(stats.KeptVersions)
+			fmt.Printf("Time taken %v\n", stats.TimeTaken)
+			if dryRun {
+				return nil
+			}
+
+			fmt.Println("Original DB size ", sizeOld, " bytes")
+			sizeNew, err := dirSize(dbPath)
+			if err != nil {
+				fmt.Printf("failed to compute size of '%s', err: %v\n", dbPath, err)
+				return nil
+			}
+			fmt.Println("New DB size", sizeNew, " bytes")
+			output.set("newSizeBytes", sizeNew)
+			return nil
+		},
+	}
+	cmd.Flags().Int64Var(&keepRecent, "keep-recent", 1, "Number of most recent versions to keep.")
+	cmd.Flags().Int64Var(&keepEvery, "keep-every", 0, "Also keep every version that's a multiple of this number, zero means no extra versions are kept.")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Report what would be pruned without deleting anything.")
+	cmd.Flags().BoolVar(&skipCompaction, "skip-compaction", false, "Don't compact DB after pruning")
+	cmd.Flags().Uint64Var(&logLevel, "log", 0, "How often progress output should be printed. 1 - every 10%, 2 - every 1%, 3 - every 0.1%.")
+	addNodeGuardFlags(cmd, &force, &pidFile)
+	addChainDataFlag(cmd, &chainDataDir)
+	addBackupFlag(cmd, &backupDir)
+	return cmd
+}
+
+// printVersionRanges lists the version ranges, with --output json they're only part of the result.
+func printVersionRanges(ranges []appstore.VersionRange) {
+	if output.isJSON() {
+		return
+	}
+	for _, r := range ranges {
+		if r.From == r.To {
+			fmt.Printf("  %d\n", r.From)
+		} else {
+			fmt.Printf("  %d - %d\n", r.From, r.To)
+		}
+	}
+}
+
+func hexKeys(keys [][]byte) []string {
+	out := make([]string, 0, len(keys))
+	for _, key := range keys {
+		out = append(out, fmt.Sprintf("%X", key))
+	}
+	return out
+}
+
 func newExtractValuesFromIAVLStoreCommand() *cobra.Command {
 	var version, logLevel, batchSize int64
+	var workers int
 	cmd := &cobra.Command{
 		Use:   "extract-values <path/to/src/app.db> <path/to/dest/db>",
 		Short: "Extracts the keys & values stored in the leaf nodes of an IAVL tree to a new DB",
@@ -228,7 +830,9 @@ func newExtractValuesFromIAVLStoreCommand() *cobra.Command {
 				fmt.Printf("Extracting keys & values from latest IAVL tree version in %s\n", srcDBPath)
 			}
 			start := time.Now()
-			err = appstore.ExtractIAVLTreeValuesFromDB(srcDBPath, destDBPath, version, logLevel, batchSize)
+			output.set("destDB", destDBPath)
+			err = appstore.ExtractIAVLTreeValuesFromDB(srcDBPath, destDBPath, version, logLevel, batchSize, workers)
+			output.setWriteError(err)
 			if err != nil {
 				fmt.Printf("Failed to extract keys & values, time taken: %v mins\n", time.Now().Sub(start).Minutes())
 				return err
@@ -241,6 +845,7 @@ func newExtractValuesFromIAVLStoreCommand() *cobra.Command {
 	cmdFlags.Int64Var(&version, "version", 0, "The IAVL tree version to extract keys & values from. Defaults to the latest tree.")
 	cmdFlags.Int64Var(&logLevel, "log", 0, "How often progress output should be printed. 1 - every 10%, 2 - every 1%, 3 - every 0.1%.")
 	cmdFlags.Int64Var(&batchSize, "batch-size", 10000, "Number of keys to write in each batch.")
+	cmdFlags.IntVar(&workers, "workers", 1, "Number of workers to walk the IAVL tree with in parallel.")
 	return cmd
 }
 
@@ -252,9 +857,15 @@ func newAppStoreCommand() *cobra.Command {
 	cmd.AddCommand(
 		newExtractValuesFromIAVLStoreCommand(),
 		newCloneAppStoreCommand(),
+		newVerifyAppStoreCommand(),
+		newDiffAppStoreCommand(),
 		newTotalDataCommand(),
+		newAnalyzeStorageCommand(),
+		newPruneAppStoreCommand(),
 		newExtractEvmCommand(),
+		newVerifyEvmCommand(),
 		newExtractEvmAuxCommand(),
+		newExtractPrefixCommand(),
 	)
 	return cmd
 }
@@ -9,10 +9,12 @@ import (
 	"github.com/spf13/cobra"
 
 	"github.com/dappchain/clusterkit/blockstore"
+	"github.com/dappchain/clusterkit/nodeguard"
 )
 
 func newIndexBlockStoreCommand() *cobra.Command {
-	var batchSize, logLevel int64
+	var fromHeight, batchSize, logLevel int64
+	var incremental bool
 	cmd := &cobra.Command{
 		Use:   "index-by-hash <path/to/src/chaindata> <path/to/dest/db>",
 		Short: "Indexes an existing block store by hash and writes the index to a new DB.",
@@ -30,11 +32,12 @@ func newIndexBlockStoreCommand() *cobra.Command {
 			if info, err := os.Stat(srcDBPath); os.IsNotExist(err) || !info.IsDir() {
 				return fmt.Errorf("DB cannot be found at '%s'", srcDBPath)
 			}
-			if _, err := os.Stat(destDBPath); !os.IsNotExist(err) {
+			if _, err := os.Stat(destDBPath); !incremental && !os.IsNotExist(err) {
 				return fmt.Errorf("Something already exists at '%s', please specify another path", destDBPath)
 			}
+			output.set("destDB", destDBPath)
 			start := time.Now()
-			err = blockstore.IndexBlockStore(srcDBPath, destDBPath, batchSize, logLevel)
+			err = blockstore.IndexBlockStore(srcDBPath, destDBPath, fromHeight, batchSize, logLevel, incremental)
 			if err != nil {
 				fmt.Printf("Failed to extract keys & values, time taken: %v mins\n", time.Now().Sub(start).Minutes())
 				return err
@@ -45,34 +48,75 @@ func newIndexBlockStoreCommand() *cobra.Command {
 	}
 	cmd.Flags().Int64Var(&batchSize, "batch-size", 10000, "Number of keys to write in each batch.")
 	cmd.Flags().Int64Var(&logLevel, "log", 0, "How often progress output should be printed. 1 - every 10%, 2 - every 1%, 3 - every 0.1%.")
+	cmd.Flags().Int64Var(&fromHeight, "from", 0, "Height of the first block to index, for block stores that have been purged.")
+	cmd.Flags().BoolVar(&incremental, "incremental", false, "Update an existing index, starting from the block after the last indexed block.")
 	return cmd
 }
 
 func newRollbackBlockStoreCommand() *cobra.Command {
 	var height int64
+	var pruneTxIndex, dryRun, force bool
+	var pidFile, backupDir string
 	cmd := &cobra.Command{
 		Use:   "rollback <path/to/chaindata> --height <block-height>",
 		Short: "Rolls back the blockstore.db to the specified height.",
 		Args:  cobra.MinimumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			blockStore := blockstore.NewBlockStore(args[0], false)
-			defer blockStore.Close()
+			if dryRun {
+				blockStore := blockstore.NewBlockStore(args[0], true)
+				defer blockStore.Close()
 
-			if err := blockStore.Rollback(height, nil); err != nil {
-				return err
+				plan, err := blockStore.PlanRollback(height)
+				if err != nil {
+					return err
+				}
+				fmt.Printf("Rolling back blockstore.db to height %d would delete:\n", height)
+				printBlockDeletionPlan(plan)
+				return nil
 			}
-			fmt.Printf("Rolled back blockstore.db to height %d\n", height)
-			return nil
+			if !force {
+				if err := blockstore.CheckNodeStopped(args[0], pidFile); err != nil {
+					return err
+				}
+			}
+
+			dbPaths := []string{blockstore.DBPath(args[0], "blockstore")}
+			if pruneTxIndex {
+				dbPaths = append(dbPaths, blockstore.DBPath(args[0], "tx_index"))
+			}
+			return withBackup(backupDir, "block-store-rollback", dbPaths, func() error {
+				blockStore := blockstore.NewBlockStore(args[0], false)
+				defer blockStore.Close()
+
+				var txIndexStore *blockstore.TxIndexStore
+				if pruneTxIndex {
+					txIndexStore = blockstore.NewTxIndexStore(args[0], false)
+					defer txIndexStore.Close()
+				}
+
+				output.set("previousHeight", blockStore.Height())
+				if err := blockStore.Rollback(height, txIndexStore); err != nil {
+					return err
+				}
+				output.set("height", height)
+				fmt.Printf("Rolled back blockstore.db to height %d\n", height)
+				return nil
+			})
 		},
 	}
 
 	cmd.Flags().Int64Var(&height, "height", 1, "Block height to rollback to.")
+	cmd.Flags().BoolVar(&pruneTxIndex, "prune-tx-index", false, "Also remove the txs in the removed blocks from the tx_index.db")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Report what would be removed from the blockstore.db without deleting anything.")
+	addNodeGuardFlags(cmd, &force, &pidFile)
+	addBackupFlag(cmd, &backupDir)
 	return cmd
 }
 
 func newPurgeBlockStoreCommand() *cobra.Command {
-	var batchSize, logLevel, height int64
-	var skipMissingBlock, skipCompaction bool
+	var batchSize, logLevel, height, keepLast int64
+	var skipMissingBlock, skipCompaction, pruneTxIndex, dryRun, force bool
+	var pidFile, backupDir, keepDuration, keepFromConfig string
 	cmd := &cobra.Command{
 		Use:   "purge <path/to/chaindata> --height <block-height>",
 		Short: "Remove blocks in the blockstore.db below the specified height.",
@@ -81,15 +125,80 @@ func newPurgeBlockStoreCommand() *cobra.Command {
 			if info, err := os.Stat(args[0]); os.IsNotExist(err) || !info.IsDir() {
 				return fmt.Errorf("chaindata cannot be found at '%s'", args[0])
 			}
+			if !dryRun && !force {
+				if err := blockstore.CheckNodeStopped(args[0], pidFile); err != nil {
+					return err
+				}
+			}
 
-			blockStore := blockstore.NewBlockStore(args[0], false)
-			defer blockStore.Close()
+			policy := blockstore.RetentionPolicy{KeepLast: keepLast}
+			if len(keepFromConfig) > 0 {
+				var err error
+				if policy, err = blockstore.LoadRetentionPolicy(keepFromConfig); err != nil {
+					return err
+				}
+				// the flags override the config file
+				if keepLast > 0 {
+					policy.KeepLast = keepLast
+				}
+			}
+			if len(keepDuration) > 0 {
+				var err error
+				if policy.KeepDuration, err = blockstore.ParseRetentionDuration(keepDuration); err != nil {
+					return err
+				}
+			}
+			if policy.IsSet() {
+				if cmd.Flags().Changed("height") {
+					return fmt.Errorf("--height can't be combined with a retention policy")
+				}
+				var purge bool
+				var err error
+				if height, purge, err = retentionHeight(args[0], policy); err != nil {
+					return err
+				}
+				if !purge {
+					return nil
+				}
+			} else if len(keepFromConfig) > 0 {
+				return fmt.Errorf("no retention limits set in %s", keepFromConfig)
+			}
 
-			if err := blockStore.Purge(height, nil, batchSize, logLevel, skipMissingBlock, skipCompaction); err != nil {
-				return err
+			if dryRun {
+				blockStore := blockstore.NewBlockStore(args[0], true)
+				defer blockStore.Close()
+
+				plan, err := blockStore.PlanPurge(height, logLevel, skipMissingBlock)
+				if err != nil {
+					return err
+				}
+				fmt.Printf("Purging blockstore.db below height %d would delete:\n", height)
+				printBlockDeletionPlan(plan)
+				return nil
 			}
-			fmt.Printf("Purge blockstore.db below height %d\n", height)
-			return nil
+
+			dbPaths := []string{blockstore.DBPath(args[0], "blockstore")}
+			if pruneTxIndex {
+				dbPaths = append(dbPaths, blockstore.DBPath(args[0], "tx_index"))
+			}
+			return withBackup(backupDir, "block-store-purge", dbPaths, func() error {
+				blockStore := blockstore.NewBlockStore(args[0], false)
+				defer blockStore.Close()
+
+				var txIndexStore *blockstore.TxIndexStore
+				if pruneTxIndex {
+					txIndexStore = blockstore.NewTxIndexStore(args[0], false)
+					defer txIndexStore.Close()
+				}
+
+				output.set("previousOldestHeight", blockStore.OldestHeight())
+				if err := blockStore.Purge(height, txIndexStore, batchSize, logLevel, skipMissingBlock, skipCompaction); err != nil {
+					return err
+				}
+				output.set("oldestHeight", height)
+				fmt.Printf("Purge blockstore.db below height %d\n", height)
+				return nil
+			})
 		},
 	}
 
@@ -98,9 +207,339 @@ func newPurgeBlockStoreCommand() *cobra.Command {
 	cmd.Flags().Int64Var(&logLevel, "log", 0, "How often progress output should be printed. 1 - every 10%, 2 - every 1%, 3 - every 0.1%.")
 	cmd.Flags().BoolVar(&skipMissingBlock, "skip-missing", false, "Skip the missing blocks during purging")
 	cmd.Flags().BoolVar(&skipCompaction, "skip-compaction", false, "Don't compact DB after purging")
+	cmd.Flags().BoolVar(&pruneTxIndex, "prune-tx-index", false, "Also remove the txs in the purged blocks from the tx_index.db")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Report what would be removed from the blockstore.db without deleting anything.")
+	cmd.Flags().Int64Var(&keepLast, "keep-last", 0, "Instead of --height, keep this number of the most recent blocks.")
+	cmd.Flags().StringVar(&keepDuration, "keep-duration", "", "Instead of --height, keep the blocks created within this duration (e.g. 30d, 2w, 12h) of the latest block.")
+	cmd.Flags().StringVar(&keepFromConfig, "keep-from-config", "", "Instead of --height, keep the blocks specified by the retention section of this clusterkit config file.")
+	addNodeGuardFlags(cmd, &force, &pidFile)
+	addBackupFlag(cmd, &backupDir)
+	return cmd
+}
+
+// retentionHeight resolves the retention policy to the height of the oldest block to keep in the
+// block store, the returned bool is false if there are no blocks to purge.
+func retentionHeight(chainDataDir string, policy blockstore.RetentionPolicy) (int64, bool, error) {
+	blockStore := blockstore.NewBlockStore(chainDataDir, true)
+	defer blockStore.Close()
+
+	height, err := blockStore.RetentionHeight(policy)
+	if err != nil {
+		return 0, false, err
+	}
+	output.set("retentionHeight", height)
+	if height <= blockStore.OldestHeight() {
+		fmt.Printf("The retention policy keeps all the blocks from height %d, nothing to purge\n", blockStore.OldestHeight())
+		return height, false, nil
+	}
+	fmt.Printf("The retention policy keeps the blocks from height %d\n", height)
+	return height, true, nil
+}
+
+func printBlockDeletionPlan(plan *blockstore.BlockDeletionPlan) {
+	output.set("dryRun", true)
+	output.set("plan", plan)
+	output.set("numKeys", plan.NumKeys())
+	output.set("numBytes", plan.NumBytes())
+	if output.isJSON() {
+		return
+	}
+
+	if plan.NumBlocks > 0 {
+		fmt.Printf("  blocks        %d (heights %d - %d)\n", plan.NumBlocks, plan.FromHeight, plan.ToHeight)
+	} else {
+		fmt.Printf("  blocks        0\n")
+	}
+	printKeys := func(name string, stats blockstore.BlockKeyStats) {
+		fmt.Printf("  %-13s %d keys, %d bytes\n", name, stats.NumKeys, stats.NumBytes)
+	}
+	printKeys("meta", plan.Meta)
+	printKeys("parts", plan.Parts)
+	printKeys("commits", plan.Commits)
+	printKeys("seen commits", plan.SeenCommits)
+	printKeys("total", blockstore.BlockKeyStats{NumKeys: plan.NumKeys(), NumBytes: plan.NumBytes()})
+	if plan.OldestHeight == -1 {
+		fmt.Println("No blocks would be left in the blockstore.db")
+	} else {
+		fmt.Printf("Blocks left afterwards: %d - %d\n", plan.OldestHeight, plan.LatestHeight)
+	}
+	fmt.Printf("Estimated space reclaimed after compaction: %d bytes (before compression)\n", plan.NumBytes())
+}
+
+func newVerifyBlockStoreCommand() *cobra.Command {
+	var logLevel int64
+	cmd := &cobra.Command{
+		Use:   "verify <path/to/chaindata>",
+		Short: "Checks that every block in the blockstore.db is complete and links to the previous block.",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if info, err := os.Stat(args[0]); os.IsNotExist(err) || !info.IsDir() {
+				return fmt.Errorf("chaindata cannot be found at '%s'", args[0])
+			}
+
+			blockStore := blockstore.NewBlockStore(args[0], true)
+			defer blockStore.Close()
+
+			start := time.Now()
+			report, err := blockStore.Verify(logLevel)
+			if err != nil {
+				return err
+			}
+			output.set("oldestHeight", report.OldestHeight)
+			output.set("latestHeight", report.LatestHeight)
+			output.set("numValid", report.NumValid)
+			output.set("gaps", report.Gaps)
+			output.set("corrupt", report.Corrupt)
+			fmt.Printf("Oldest height: %d\n", report.OldestHeight)
+			fmt.Printf("Latest height: %d\n", report.LatestHeight)
+			fmt.Printf("Valid blocks:  %d\n", report.NumValid)
+			if !output.isJSON() {
+				for _, gap := range report.Gaps {
+					if gap.From == gap.To {
+						fmt.Printf("Missing block %d\n", gap.From)
+					} else {
+						fmt.Printf("Missing blocks %d - %d\n", gap.From, gap.To)
+					}
+				}
+				for _, block := range report.Corrupt {
+					fmt.Printf("Corrupt block %d:\n", block.Height)
+					for _, problem := range block.Problems {
+						fmt.Printf("  %s\n", problem)
+					}
+				}
+			}
+			fmt.Printf("Time taken %v\n", time.Since(start))
+			if !report.OK() {
+				return fmt.Errorf(
+					"found %d gaps and %d corrupt blocks in blockstore.db", len(report.Gaps), len(report.Corrupt),
+				)
+			}
+			fmt.Println("No problems found in blockstore.db")
+			return nil
+		},
+	}
+	cmd.Flags().Int64Var(&logLevel, "log", 0, "How often progress output should be printed. 1 - every 10%, 2 - every 1%, 3 - every 0.1%.")
 	return cmd
 }
 
+func newExportBlockStoreCommand() *cobra.Command {
+	var fromHeight, toHeight, blocksPerChunk, logLevel int64
+	cmd := &cobra.Command{
+		Use:   "export <path/to/chaindata> <path/to/archive>",
+		Short: "Exports a range of blocks from the blockstore.db to a compressed archive file.",
+		Args:  cobra.MinimumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if info, err := os.Stat(args[0]); os.IsNotExist(err) || !info.IsDir() {
+				return fmt.Errorf("chaindata cannot be found at '%s'", args[0])
+			}
+			if _, err := os.Stat(args[1]); !os.IsNotExist(err) {
+				return fmt.Errorf("Something already exists at '%s', please specify another path", args[1])
+			}
+
+			blockStore := blockstore.NewBlockStore(args[0], true)
+			defer blockStore.Close()
+
+			start := time.Now()
+			header, err := blockStore.Export(args[1], fromHeight, toHeight, blocksPerChunk, logLevel)
+			if err != nil {
+				return err
+			}
+			setArchiveOutput(header)
+			fmt.Printf(
+				"Exported blocks %d to %d of chain %s, time taken: %v\n",
+				header.FromHeight, header.ToHeight, header.ChainID, time.Since(start),
+			)
+			return nil
+		},
+	}
+	cmd.Flags().Int64Var(&fromHeight, "from", 0, "Height of the first block to export. Default is the oldest block.")
+	cmd.Flags().Int64Var(&toHeight, "to", 0, "Height of the last block to export. Default is the latest block.")
+	cmd.Flags().Int64Var(&blocksPerChunk, "blocks-per-chunk", 1000, "Number of blocks to compress into each chunk of the archive.")
+	cmd.Flags().Int64Var(&logLevel, "log", 0, "How often progress output should be printed. 1 - every 10%, 2 - every 1%, 3 - every 0.1%.")
+	return cmd
+}
+
+func newImportBlockStoreCommand() *cobra.Command {
+	var batchSize, logLevel int64
+	var force, skipNodeCheck bool
+	var pidFile string
+	cmd := &cobra.Command{
+		Use:   "import <path/to/archive> <path/to/chaindata>",
+		Short: "Imports the blocks from an archive file into the blockstore.db.",
+		Args:  cobra.MinimumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if info, err := os.Stat(args[0]); os.IsNotExist(err) || info.IsDir() {
+				return fmt.Errorf("archive cannot be found at '%s'", args[0])
+			}
+			if !skipNodeCheck {
+				if err := blockstore.CheckNodeStopped(args[1], pidFile); err != nil {
+					// --force means something else here
+					if nodeErr, ok := err.(*nodeguard.NodeRunningError); ok {
+						nodeErr.SkipFlag = "--skip-node-check"
+					}
+					return err
+				}
+			}
+
+			blockStore := blockstore.NewBlockStore(args[1], false)
+			defer blockStore.Close()
+
+			start := time.Now()
+			header, err := blockStore.Import(args[0], force, batchSize, logLevel)
+			if err != nil {
+				return err
+			}
+			setArchiveOutput(header)
+			output.set("latestHeight", blockStore.Height())
+			fmt.Printf(
+				"Imported blocks %d to %d of chain %s, time taken: %v\n",
+				header.FromHeight, header.ToHeight, header.ChainID, time.Since(start),
+			)
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&force, "force", false, "Import blocks that overlap, or are not contiguous with, the blocks in the blockstore.db")
+	cmd.Flags().Int64Var(&batchSize, "batch-size", 1000, "Number of blocks to write in each batch.")
+	cmd.Flags().Int64Var(&logLevel, "log", 0, "How often progress output should be printed. 1 - every 10%, 2 - every 1%, 3 - every 0.1%.")
+	cmd.Flags().BoolVar(&skipNodeCheck, "skip-node-check", false, "Skip the checks that make sure the node isn't running.")
+	cmd.Flags().StringVar(&pidFile, "pid-file", "", "Path to the node's PID file, the command is refused while the process in it is alive.")
+	return cmd
+}
+
+func newReindexTxsBlockStoreCommand() *cobra.Command {
+	var fromHeight, toHeight, batchSize, logLevel int64
+	var destDBPath string
+	cmd := &cobra.Command{
+		Use:   "reindex-txs <path/to/chaindata>",
+		Short: "Rebuilds the tx_index.db from the blocks in the blockstore.db and the ABCI responses in the state.db.",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			chainDataDir, err := filepath.Abs(args[0])
+			if err != nil {
+				return fmt.Errorf("Failed to resolve chaindata path '%s'", args[0])
+			}
+			if info, err := os.Stat(chainDataDir); os.IsNotExist(err) || !info.IsDir() {
+				return fmt.Errorf("chaindata cannot be found at '%s'", chainDataDir)
+			}
+			if destDBPath == "" {
+				destDBPath = filepath.Join(chainDataDir, "data", "tx_index.db")
+			}
+			if destDBPath, err = filepath.Abs(destDBPath); err != nil {
+				return fmt.Errorf("Failed to resolve destination DB path '%s'", destDBPath)
+			}
+			if _, err := os.Stat(destDBPath); !os.IsNotExist(err) {
+				return fmt.Errorf("Something already exists at '%s', please move it or specify another path", destDBPath)
+			}
+
+			start := time.Now()
+			output.set("destDB", destDBPath)
+			numTxs, err := blockstore.ReindexTxs(chainDataDir, destDBPath, fromHeight, toHeight, batchSize, logLevel)
+			output.set("numTxs", numTxs)
+			if err != nil {
+				fmt.Printf("Failed to reindex txs, %d txs indexed, time taken: %v\n", numTxs, time.Since(start))
+				return err
+			}
+			fmt.Printf("Indexed %d txs to %s, time taken: %v\n", numTxs, destDBPath, time.Since(start))
+			return nil
+		},
+	}
+	cmd.Flags().Int64Var(&fromHeight, "from", 0, "Height of the first block to index. Default is the oldest block.")
+	cmd.Flags().Int64Var(&toHeight, "to", 0, "Height of the last block to index. Default is the latest block.")
+	cmd.Flags().StringVar(&destDBPath, "dest", "", "Path to write the new tx index DB to. Default is <path/to/chaindata>/data/tx_index.db")
+	cmd.Flags().Int64Var(&batchSize, "batch-size", 10000, "Number of keys to write in each batch.")
+	cmd.Flags().Int64Var(&logLevel, "log", 0, "How often progress output should be printed. 1 - every 10%, 2 - every 1%, 3 - every 0.1%.")
+	return cmd
+}
+
+func newShowBlockStoreCommand() *cobra.Command {
+	var height int64
+	var hash, blockIndexDBPath string
+	cmd := &cobra.Command{
+		Use:   "show <path/to/chaindata> --height <block-height> | --hash <block-hash>",
+		Short: "Prints the header, commit and tx hashes of a block in the blockstore.db as JSON.",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if info, err := os.Stat(args[0]); os.IsNotExist(err) || !info.IsDir() {
+				return fmt.Errorf("chaindata cannot be found at '%s'", args[0])
+			}
+			if (height > 0) == (hash != "") {
+				return fmt.Errorf("either --height or --hash must be specified")
+			}
+
+			blockStore := blockstore.NewBlockStore(args[0], true)
+			defer blockStore.Close()
+
+			if hash != "" {
+				blockHash, err := blockstore.ParseHash(hash)
+				if err != nil {
+					return err
+				}
+				if height, err = blockStore.FindHeightByHash(blockHash, blockIndexDBPath); err != nil {
+					return err
+				}
+			}
+			summary, err := blockStore.LoadBlockSummary(height)
+			if err != nil {
+				return err
+			}
+			out, err := blockstore.MarshalJSONIndent(summary)
+			if err != nil {
+				return err
+			}
+			output.setJSON("block", out)
+			if !output.isJSON() {
+				fmt.Println(string(out))
+			}
+			return nil
+		},
+	}
+	cmd.Flags().Int64Var(&height, "height", 0, "Height of the block to show.")
+	cmd.Flags().StringVar(&hash, "hash", "", "Hash of the block to show (hex encoded).")
+	cmd.Flags().StringVar(&blockIndexDBPath, "block-index", "", "Path to a block index DB created by index-by-hash, to look up the block hash in. By default all the blocks are scanned.")
+	return cmd
+}
+
+func newShowTxBlockStoreCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "tx <path/to/chaindata> <tx-hash>",
+		Short: "Looks up a tx in the tx_index.db and prints the tx result as JSON.",
+		Args:  cobra.MinimumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if info, err := os.Stat(args[0]); os.IsNotExist(err) || !info.IsDir() {
+				return fmt.Errorf("chaindata cannot be found at '%s'", args[0])
+			}
+			txHash, err := blockstore.ParseHash(args[1])
+			if err != nil {
+				return err
+			}
+
+			txIndexStore := blockstore.NewTxIndexStore(args[0], true)
+			defer txIndexStore.Close()
+
+			txResult, err := txIndexStore.LoadTxResult(txHash)
+			if err != nil {
+				return err
+			}
+			out, err := blockstore.MarshalJSONIndent(txResult)
+			if err != nil {
+				return err
+			}
+			output.setJSON("tx", out)
+			if !output.isJSON() {
+				fmt.Println(string(out))
+			}
+			return nil
+		},
+	}
+	return cmd
+}
+
+func setArchiveOutput(header *blockstore.ArchiveHeader) {
+	output.set("chainID", header.ChainID)
+	output.set("fromHeight", header.FromHeight)
+	output.set("toHeight", header.ToHeight)
+}
+
 func newBlockStoreCommand() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "block-store",
@@ -110,6 +549,12 @@ func newBlockStoreCommand() *cobra.Command {
 		newIndexBlockStoreCommand(),
 		newRollbackBlockStoreCommand(),
 		newPurgeBlockStoreCommand(),
+		newVerifyBlockStoreCommand(),
+		newExportBlockStoreCommand(),
+		newImportBlockStoreCommand(),
+		newReindexTxsBlockStoreCommand(),
+		newShowBlockStoreCommand(),
+		newShowTxBlockStoreCommand(),
 	)
 	return cmd
 }
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"github.com/spf13/cobra"
+
+	"github.com/dappchain/clusterkit/compact"
+	"github.com/dappchain/clusterkit/nodeguard"
+)
+
+func newCompactDBCommand() *cobra.Command {
+	var keyRange, pidFile, chainDataDir string
+	var numChunks int
+	var force bool
+	cmd := &cobra.Command{
+		Use:   "compact <path/to/db>",
+		Short: "Compacts a LevelDB used by the node (app.db, blockstore.db, state.db, tx_index.db, etc.)",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dbPath, err := filepath.Abs(args[0])
+			if err != nil {
+				return fmt.Errorf("Failed to resolve DB path '%s'", args[0])
+			}
+			if info, err := os.Stat(dbPath); os.IsNotExist(err) || !info.IsDir() {
+				return fmt.Errorf("DB cannot be found at '%s'", dbPath)
+			}
+			if !force {
+				// the node's DBs are in <chaindata>/data
+				if len(chainDataDir) == 0 && filepath.Base(filepath.Dir(dbPath)) == "data" {
+					chainDataDir = filepath.Dir(filepath.Dir(dbPath))
+				}
+				if err := nodeguard.CheckDBs([]string{dbPath}, pidFile, chainDataDir); err != nil {
+					return err
+				}
+			}
+			var start, limit []byte
+			if len(keyRange) > 0 {
+				if start, limit, err = compact.ParseRange(keyRange); err != nil {
+					return err
+				}
+			}
+
+			sizeOld, err := dirSize(dbPath)
+			if err != nil {
+				return fmt.Errorf("failed to compute size of '%s', err: %v", dbPath, err)
+			}
+			fmt.Println("Original DB size ", sizeOld, " bytes")
+			output.set("originalSizeBytes", sizeOld)
+
+			// stop after the current chunk on the first interrupt, a second one aborts right away
+			interrupt := make(chan struct{})
+			sigs := make(chan os.Signal, 1)
+			signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+			defer signal.Stop(sigs)
+			go func() {
+				<-sigs
+				signal.Stop(sigs)
+				fmt.Println("Interrupted, stopping once the current chunk is compacted, interrupt again to abort")
+				close(interrupt)
+			}()
+
+			stats, err := compact.CompactDB(dbPath, start, limit, numChunks, interrupt)
+			if err != nil {
+				return err
+			}
+			output.set("numChunks", stats.NumChunks)
+			output.set("numCompacted", stats.NumCompacted)
+			output.set("interrupted", stats.Interrupted)
+			if stats.Interrupted {
+				fmt.Printf("Compacted %d of %d chunks, time taken %v\n", stats.NumCompacted, stats.NumChunks, stats.TimeTaken)
+			} else {
+				fmt.Printf("Compacted %d chunks, time taken %v\n", stats.NumCompacted, stats.TimeTaken)
+			}
+
+			sizeNew, err := dirSize(dbPath)
+			if err != nil {
+				fmt.Printf("failed to compute size of '%s', err: %v\n", dbPath, err)
+				return nil
+			}
+			fmt.Println("New DB size", sizeNew, " bytes")
+			output.set("newSizeBytes", sizeNew)
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&keyRange, "range", "", "Only compact the keys in this range, start:end (either may be empty), \\xHH escapes are supported and \\: is a colon in a key.")
+	cmd.Flags().IntVar(&numChunks, "chunks", 10, "Number of chunks to split the key range into, each chunk is compacted separately.")
+	addNodeGuardFlags(cmd, &force, &pidFile)
+	addChainDataFlag(cmd, &chainDataDir)
+	return cmd
+}
+
+func newDBCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "db",
+		Short: "Tools that work on any of the node's LevelDBs",
+	}
+	cmd.AddCommand(
+		newCompactDBCommand(),
+	)
+	return cmd
+}
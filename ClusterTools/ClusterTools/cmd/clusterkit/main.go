@@ -13,27 +13,61 @@ func newVersionCommand() *cobra.Command {
 		Use:   "version",
 		Short: "Display the clusterkit version",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			println(version.FullVersion())
+			output.set("version", version.FullVersion())
+			if !output.isJSON() {
+				println(version.FullVersion())
+			}
 			return nil
 		},
 	}
 	return cmd
 }
 
-func main() {
+func newRootCommand() *cobra.Command {
 	rootCmd := &cobra.Command{
 		Use:   "clusterkit",
 		Short: "DAppChain maintenance tools",
 	}
 
+	rootCmd.PersistentFlags().StringVar(&output.format, "output", outputText, "Output format: text or json. With json the result of the command is printed to stdout as a single JSON object, and progress is printed to stderr as JSON lines.")
+
 	rootCmd.AddCommand(
 		newVersionCommand(),
 		newAppStoreCommand(),
 		newBlockStoreCommand(),
+		newNodeCommand(),
+		newSnapshotCommand(),
+		newDBCommand(),
 	)
+	wrapCommands(rootCmd)
+	return rootCmd
+}
+
+// execute runs the command specified by args. With --output json a result object is printed to
+// stdout even if the command isn't run because its args or flags are invalid.
+func execute(rootCmd *cobra.Command, args []string) error {
+	// cobra parses & validates the args and flags before the command is run, so the output format
+	// has to be known up front to keep the errors & usage out of stdout
+	if outputFormatFromArgs(args) == outputJSON {
+		output.format = outputJSON
+		rootCmd.SilenceErrors = true
+		rootCmd.SilenceUsage = true
+	}
+	rootCmd.SetArgs(args)
+	cmd, err := rootCmd.ExecuteC()
+	if err != nil && output.isJSON() && output.Command == "" {
+		if printErr := output.printError(cmd, err); printErr != nil {
+			fmt.Fprintln(os.Stderr, printErr)
+		}
+	}
+	return err
+}
 
-	if err := rootCmd.Execute(); err != nil {
-		fmt.Println(err)
+func main() {
+	if err := execute(newRootCommand(), os.Args[1:]); err != nil {
+		if !output.isJSON() {
+			fmt.Println(err)
+		}
 		os.Exit(1)
 	}
 }
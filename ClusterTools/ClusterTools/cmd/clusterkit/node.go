@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/dappchain/clusterkit/appstore"
+	"github.com/dappchain/clusterkit/blockstore"
+)
+
+func newRollbackNodeCommand() *cobra.Command {
+	var height int64
+	var pruneTxIndex, force bool
+	var pidFile, backupDir string
+	cmd := &cobra.Command{
+		Use:   "rollback <path/to/chaindata> <path/to/app.db> --height <block-height>",
+		Short: "Rolls back the blockstore.db, state.db and app.db to the specified height.",
+		Args:  cobra.MinimumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			chainDataDir := args[0]
+			appDBPath, err := filepath.Abs(args[1])
+			if err != nil {
+				return fmt.Errorf("Failed to resolve app DB path '%s'", args[1])
+			}
+			if info, err := os.Stat(chainDataDir); os.IsNotExist(err) || !info.IsDir() {
+				return fmt.Errorf("chaindata cannot be found at '%s'", chainDataDir)
+			}
+			if info, err := os.Stat(appDBPath); os.IsNotExist(err) || !info.IsDir() {
+				return fmt.Errorf("DB cannot be found at '%s'", appDBPath)
+			}
+			if !force {
+				if err := blockstore.CheckNodeStopped(chainDataDir, pidFile); err != nil {
+					return err
+				}
+				if err := appstore.CheckDBNotInUse(appDBPath, "", ""); err != nil {
+					return err
+				}
+			}
+
+			dbPaths := []string{
+				blockstore.DBPath(chainDataDir, "blockstore"),
+				blockstore.DBPath(chainDataDir, "state"),
+				appDBPath,
+			}
+			if pruneTxIndex {
+				dbPaths = append(dbPaths, blockstore.DBPath(chainDataDir, "tx_index"))
+			}
+			return withBackup(backupDir, "node-rollback", dbPaths, func() error {
+				appHeight, err := appstore.LatestIAVLVersion(appDBPath)
+				if err != nil {
+					return err
+				}
+				blockStore := blockstore.NewBlockStore(chainDataDir, false)
+				defer blockStore.Close()
+				stateStore := blockstore.NewStateStore(chainDataDir, false)
+				defer stateStore.Close()
+
+				blockHeight := blockStore.Height()
+				stateHeight := stateStore.Height()
+				output.set("previousHeights", map[string]int64{
+					"blockstore": blockHeight,
+					"state":      stateHeight,
+					"app":        appHeight,
+				})
+				if !output.isJSON() {
+					fmt.Println("Current heights:")
+					fmt.Printf("  blockstore.db %d (oldest block %d)\n", blockHeight, blockStore.OldestHeight())
+					fmt.Printf("  state.db      %d\n", stateHeight)
+					fmt.Printf("  app.db        %d\n", appHeight)
+				}
+
+				if height < 1 || height < blockStore.OldestHeight() {
+					return fmt.Errorf("can't roll back to height %d, the oldest block is %d", height, blockStore.OldestHeight())
+				}
+				if height > blockHeight || height > stateHeight || height > appHeight {
+					return fmt.Errorf("can't roll back to height %d, it's above the current height of one of the DBs", height)
+				}
+				// The state can only be rolled back while the next block is in the block store.
+				if height < stateHeight && height == blockHeight {
+					return fmt.Errorf("can't roll back state.db to height %d, block %d is missing", height, height+1)
+				}
+
+				// Load everything the state.db rollback needs before any of the DBs are changed, so a
+				// missing record doesn't leave app.db rolled back while state.db can't be.
+				var statePlan *blockstore.StateRollbackPlan
+				if height < stateHeight {
+					statePlan, err = stateStore.PlanRollback(height, blockStore)
+					if err != nil {
+						return err
+					}
+					output.set("preflight", statePlan.Checks)
+					if !output.isJSON() {
+						fmt.Println("Pre-flight checks:")
+						for _, check := range statePlan.Checks {
+							if check.Error == "" {
+								fmt.Printf("  ok    %s\n", check.Name)
+							} else {
+								fmt.Printf("  FAIL  %s: %s\n", check.Name, check.Error)
+							}
+						}
+					}
+					if err := statePlan.Err(); err != nil {
+						return err
+					}
+				}
+
+				// If the rollback is interrupted part way through the node can still recover by replaying
+				// blocks to the app, or the rollback can be run again.
+				if height < appHeight {
+					stats, err := appstore.RollbackIAVLTree(appDBPath, height)
+					if err != nil {
+						return err
+					}
+					output.set("app", stats)
+					fmt.Printf(
+						"Rolled back app.db to version %d, deleted %d versions and %d nodes\n",
+						height, stats.NumVersions, stats.NumNodes,
+					)
+				}
+				if height < stateHeight {
+					if err := stateStore.ApplyRollback(statePlan); err != nil {
+						return err
+					}
+					fmt.Printf("Rolled back state.db to height %d\n", height)
+				}
+				if height < blockHeight {
+					var txIndexStore *blockstore.TxIndexStore
+					if pruneTxIndex {
+						txIndexStore = blockstore.NewTxIndexStore(chainDataDir, false)
+						defer txIndexStore.Close()
+					}
+					if err := blockStore.Rollback(height, txIndexStore); err != nil {
+						return err
+					}
+					fmt.Printf("Rolled back blockstore.db to height %d\n", height)
+				}
+				output.set("height", height)
+				return nil
+			})
+		},
+	}
+	cmd.Flags().Int64Var(&height, "height", 0, "Block height to roll back to.")
+	cmd.Flags().BoolVar(&pruneTxIndex, "prune-tx-index", false, "Also remove the txs in the removed blocks from the tx_index.db")
+	addNodeGuardFlags(cmd, &force, &pidFile)
+	addBackupFlag(cmd, &backupDir)
+	return cmd
+}
+
+// addNodeGuardFlags adds the flags used to check that the node isn't running before its DBs are
+// modified.
+func addNodeGuardFlags(cmd *cobra.Command, force *bool, pidFile *string) {
+	cmd.Flags().BoolVar(force, "force", false, "Skip the checks that make sure the node isn't running.")
+	cmd.Flags().StringVar(pidFile, "pid-file", "", "Path to the node's PID file, the command is refused while the process in it is alive.")
+}
+
+// addChainDataFlag adds the flag used to find the node's config.toml, so commands that don't take
+// the chaindata directory as an arg can check that nothing is listening on the node's RPC address.
+func addChainDataFlag(cmd *cobra.Command, chainDataDir *string) {
+	cmd.Flags().StringVar(chainDataDir, "chaindata", "", "Path to the node's chaindata directory, the command is refused while something is listening on the RPC address in its config/config.toml.")
+}
+
+func newNodeCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "node",
+		Short: "Tools that operate on all of a node's DBs (blockstore.db, state.db & app.db)",
+	}
+	cmd.AddCommand(
+		newRollbackNodeCommand(),
+	)
+	return cmd
+}
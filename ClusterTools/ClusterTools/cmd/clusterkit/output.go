@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/dappchain/clusterkit/appstore"
+)
+
+// Formats supported by the global --output flag.
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
+
+// commandOutput collects the result of the command being run. With --output json the result is
+// printed to stdout as a single JSON object once the command is done, and anything the command
+// prints or logs in the meantime is written to stderr as JSON lines.
+type commandOutput struct {
+	format string
+	// The real stdout, while it's redirected.
+	stdout *os.File
+
+	Command string `json:"command"`
+	Inputs  struct {
+		Args  []string          `json:"args"`
+		Flags map[string]string `json:"flags"`
+	} `json:"inputs"`
+	Result       map[string]interface{} `json:"result"`
+	DurationSecs float64                `json:"durationSecs"`
+	Error        string                 `json:"error,omitempty"`
+}
+
+var output = &commandOutput{
+	format: outputText,
+	Result: map[string]interface{}{},
+}
+
+// progressLine is the format of the progress output written to stderr with --output json.
+type progressLine struct {
+	Type    string `json:"type"`
+	Time    string `json:"time"`
+	Message string `json:"message"`
+}
+
+func (o *commandOutput) isJSON() bool {
+	return o.format == outputJSON
+}
+
+// set adds a field to the result of the command.
+func (o *commandOutput) set(key string, value interface{}) {
+	o.Result[key] = value
+}
+
+// setJSON adds a field that has already been encoded as JSON to the result of the command.
+func (o *commandOutput) setJSON(key string, value []byte) {
+	o.Result[key] = json.RawMessage(value)
+}
+
+// setWriteError adds the number of keys written to the destination DB to the result if err is an
+// appstore.WriteError.
+func (o *commandOutput) setWriteError(err error) {
+	if writeErr, ok := err.(*appstore.WriteError); ok {
+		o.set("numKeysWritten", writeErr.NumKeysWritten)
+	}
+}
+
+// wrapCommands wraps the RunE function of the given command and all its subcommands so the
+// output of each command is handled according to the --output flag.
+func wrapCommands(cmd *cobra.Command) {
+	if runE := cmd.RunE; runE != nil {
+		cmd.RunE = func(cmd *cobra.Command, args []string) error {
+			return output.run(cmd, args, runE)
+		}
+	}
+	for _, subCmd := range cmd.Commands() {
+		wrapCommands(subCmd)
+	}
+}
+
+func (o *commandOutput) run(cmd *cobra.Command, args []string, runE func(*cobra.Command, []string) error) error {
+	switch o.format {
+	case outputText:
+		return runE(cmd, args)
+	case outputJSON:
+	default:
+		return fmt.Errorf("unsupported output format '%s'", o.format)
+	}
+
+	o.setInputs(cmd, args)
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	o.stdout = os.Stdout
+	os.Stdout = w
+	log.SetFlags(0)
+	log.SetOutput(w)
+	progressDone := make(chan struct{})
+	go func() {
+		defer close(progressDone)
+		forwardProgress(r, os.Stderr)
+	}()
+
+	start := time.Now()
+	cmdErr := runE(cmd, args)
+	o.DurationSecs = time.Since(start).Seconds()
+	if cmdErr != nil {
+		o.Error = cmdErr.Error()
+	}
+
+	w.Close()
+	<-progressDone
+	r.Close()
+	os.Stdout = o.stdout
+	log.SetOutput(os.Stderr)
+	log.SetFlags(log.LstdFlags)
+
+	if err := o.print(); err != nil {
+		return err
+	}
+	return cmdErr
+}
+
+// printError prints the result object for a command that failed before it was run, e.g. because
+// its args or flags were invalid.
+func (o *commandOutput) printError(cmd *cobra.Command, err error) error {
+	o.setInputs(cmd, cmd.Flags().Args())
+	o.Error = err.Error()
+	return o.print()
+}
+
+// setInputs records the command being run, and its args & flags.
+func (o *commandOutput) setInputs(cmd *cobra.Command, args []string) {
+	o.Command = cmd.CommandPath()
+	o.Inputs.Args = args
+	o.Inputs.Flags = map[string]string{}
+	cmd.Flags().VisitAll(func(flag *pflag.Flag) {
+		if flag.Name != "help" {
+			o.Inputs.Flags[flag.Name] = flag.Value.String()
+		}
+	})
+}
+
+// print writes the result object to stdout.
+func (o *commandOutput) print() error {
+	buf, err := json.MarshalIndent(o, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(buf))
+	return nil
+}
+
+// outputFormatFromArgs returns the value of the --output flag in the command line args, or the
+// default format if the flag isn't there.
+func outputFormatFromArgs(args []string) string {
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		if arg == "--output" && i+1 < len(args) {
+			return args[i+1]
+		}
+		if strings.HasPrefix(arg, "--output=") {
+			return strings.TrimPrefix(arg, "--output=")
+		}
+	}
+	return outputText
+}
+
+// forwardProgress writes each line read from r to w as a JSON progress line.
+func forwardProgress(r io.Reader, w io.Writer) {
+	enc := json.NewEncoder(w)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		enc.Encode(progressLine{
+			Type:    "progress",
+			Time:    time.Now().UTC().Format(time.RFC3339Nano),
+			Message: scanner.Text(),
+		})
+	}
+	// keep draining so the command doesn't block on a line that's too long
+	io.Copy(ioutil.Discard, r)
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+// resetOutput replaces the global command output with a fresh one, and returns a function that
+// restores the previous one.
+func resetOutput(format string) func() {
+	prev := output
+	output = &commandOutput{
+		format: format,
+		Result: map[string]interface{}{},
+	}
+	return func() { output = prev }
+}
+
+// captureOutput returns what fn writes to stdout & stderr.
+func captureOutput(t *testing.T, fn func()) (string, string) {
+	stdoutFile, err := ioutil.TempFile("", "clusterkit-stdout")
+	require.NoError(t, err)
+	defer os.Remove(stdoutFile.Name())
+	stderrFile, err := ioutil.TempFile("", "clusterkit-stderr")
+	require.NoError(t, err)
+	defer os.Remove(stderrFile.Name())
+
+	stdout, stderr := os.Stdout, os.Stderr
+	os.Stdout, os.Stderr = stdoutFile, stderrFile
+	func() {
+		defer func() { os.Stdout, os.Stderr = stdout, stderr }()
+		fn()
+	}()
+	require.NoError(t, stdoutFile.Close())
+	require.NoError(t, stderrFile.Close())
+
+	outBuf, err := ioutil.ReadFile(stdoutFile.Name())
+	require.NoError(t, err)
+	errBuf, err := ioutil.ReadFile(stderrFile.Name())
+	require.NoError(t, err)
+	return string(outBuf), string(errBuf)
+}
+
+func TestOutputFormatFromArgs(t *testing.T) {
+	for _, test := range []struct {
+		args   []string
+		format string
+	}{
+		{[]string{"block-store", "verify", "data"}, outputText},
+		{[]string{"block-store", "verify", "--output", "json", "data"}, outputJSON},
+		{[]string{"--output=json", "block-store", "verify"}, outputJSON},
+		{[]string{"block-store", "verify", "--output"}, outputText},
+		{[]string{"block-store", "verify", "--", "--output", "json"}, outputText},
+	} {
+		require.Equal(t, test.format, outputFormatFromArgs(test.args), "%v", test.args)
+	}
+}
+
+func TestForwardProgress(t *testing.T) {
+	var buf bytes.Buffer
+	forwardProgress(strings.NewReader("first line\n\nsecond line\n"), &buf)
+
+	dec := json.NewDecoder(&buf)
+	var messages []string
+	for dec.More() {
+		var line progressLine
+		require.NoError(t, dec.Decode(&line))
+		require.Equal(t, "progress", line.Type)
+		require.NotEmpty(t, line.Time)
+		messages = append(messages, line.Message)
+	}
+	require.Equal(t, []string{"first line", "second line"}, messages)
+}
+
+func TestRunJSON(t *testing.T) {
+	defer resetOutput(outputJSON)()
+	var count int
+	cmd := &cobra.Command{
+		Use: "test",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			fmt.Println("printed")
+			log.Println("logged")
+			output.set("count", count)
+			return fmt.Errorf("failed")
+		},
+	}
+	cmd.Flags().IntVar(&count, "count", 0, "")
+	require.NoError(t, cmd.Flags().Set("count", "3"))
+
+	stdout, stderr := captureOutput(t, func() {
+		require.EqualError(t, output.run(cmd, []string{"arg"}, cmd.RunE), "failed")
+	})
+
+	var result struct {
+		Command string `json:"command"`
+		Inputs  struct {
+			Args  []string          `json:"args"`
+			Flags map[string]string `json:"flags"`
+		} `json:"inputs"`
+		Result map[string]interface{} `json:"result"`
+		Error  string                 `json:"error"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(stdout), &result))
+	require.Equal(t, "test", result.Command)
+	require.Equal(t, []string{"arg"}, result.Inputs.Args)
+	require.Equal(t, map[string]string{"count": "3"}, result.Inputs.Flags)
+	require.Equal(t, map[string]interface{}{"count": float64(3)}, result.Result)
+	require.Equal(t, "failed", result.Error)
+
+	require.Contains(t, stderr, `"message":"printed"`)
+	require.Contains(t, stderr, `"message":"logged"`)
+}
+
+func TestExecuteInvalidArgsJSON(t *testing.T) {
+	defer resetOutput(outputText)()
+	stdout, stderr := captureOutput(t, func() {
+		require.Error(t, execute(newRootCommand(), []string{"block-store", "verify", "--output", "json"}))
+	})
+
+	var result struct {
+		Command string `json:"command"`
+		Error   string `json:"error"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(stdout), &result))
+	require.Equal(t, "clusterkit block-store verify", result.Command)
+	require.NotEmpty(t, result.Error)
+	require.Empty(t, stderr)
+}
+
+func TestExecuteInvalidArgsText(t *testing.T) {
+	defer resetOutput(outputText)()
+	stdout, stderr := captureOutput(t, func() {
+		require.Error(t, execute(newRootCommand(), []string{"block-store", "verify"}))
+	})
+	require.Contains(t, stdout+stderr, "Usage:")
+}
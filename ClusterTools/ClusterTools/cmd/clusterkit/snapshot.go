@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/dappchain/clusterkit/snapshot"
+)
+
+// withBackup takes a snapshot of the given DBs in backupDir before calling fn, and restores the
+// snapshot if fn fails or panics, a panic is returned as an error. fn must close the DBs before it
+// returns. DBs that don't exist are skipped, and nothing is backed up if backupDir is empty.
+func withBackup(backupDir, label string, dbPaths []string, fn func() error) error {
+	if len(backupDir) == 0 {
+		return fn()
+	}
+	var existing []string
+	for _, dbPath := range dbPaths {
+		if info, err := os.Stat(dbPath); err == nil && info.IsDir() {
+			existing = append(existing, dbPath)
+		}
+	}
+	snap, err := snapshot.Create(backupDir, label, existing)
+	if err != nil {
+		return errors.Wrap(err, "failed to back up DBs")
+	}
+	output.set("snapshot", snap.Dir)
+	fmt.Printf("Backed up %d DBs to %s\n", len(snap.DBs), snap.Dir)
+
+	if err := callAndRecover(fn); err != nil {
+		fmt.Printf("Restoring DBs from %s\n", snap.Dir)
+		if _, restoreErr := snapshot.Restore(snap.Dir); restoreErr != nil {
+			return errors.Wrapf(err, "failed to restore DBs from %s (%v)", snap.Dir, restoreErr)
+		}
+		output.set("restored", true)
+		return err
+	}
+	return nil
+}
+
+// callAndRecover calls fn and turns a panic into an error, the block & state stores panic if they
+// fail to open their DBs.
+func callAndRecover(fn func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return fn()
+}
+
+// addBackupFlag adds the flag used to back up the DBs a command modifies in place.
+func addBackupFlag(cmd *cobra.Command, backupDir *string) {
+	cmd.Flags().StringVar(backupDir, "backup-dir", "", "Take a snapshot of the DBs in this directory before modifying them, the snapshot is restored if the command fails.")
+}
+
+func newCreateSnapshotCommand() *cobra.Command {
+	var label string
+	cmd := &cobra.Command{
+		Use:   "create <path/to/backup/dir> <path/to/db>...",
+		Short: "Takes a snapshot of one or more LevelDB directories",
+		Args:  cobra.MinimumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			snap, err := snapshot.Create(args[0], label, args[1:])
+			if err != nil {
+				return err
+			}
+			output.set("snapshot", snap)
+			fmt.Printf("Created snapshot %s in %s\n", snap.ID, snap.Dir)
+			printSnapshotDBs(snap)
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&label, "label", "", "Label to add to the snapshot ID.")
+	return cmd
+}
+
+func newRestoreSnapshotCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "restore <path/to/backup/dir> <snapshot-id>",
+		Short: "Replaces the DBs in a snapshot with the copies stored in the snapshot",
+		Args:  cobra.MinimumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			snap, err := snapshot.Restore(filepath.Join(args[0], args[1]))
+			if err != nil {
+				return err
+			}
+			output.set("snapshot", snap)
+			fmt.Printf("Restored snapshot %s\n", snap.ID)
+			printSnapshotDBs(snap)
+			return nil
+		},
+	}
+}
+
+func newListSnapshotsCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list <path/to/backup/dir>",
+		Short: "Lists the snapshots in a backup directory",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			snaps, err := snapshot.List(args[0])
+			if err != nil {
+				return err
+			}
+			output.set("snapshots", snaps)
+			if output.isJSON() {
+				return nil
+			}
+			for _, snap := range snaps {
+				fmt.Printf("%s (created %s)\n", snap.ID, snap.CreatedAt.Format("2006-01-02 15:04:05 MST"))
+				printSnapshotDBs(snap)
+			}
+			return nil
+		},
+	}
+}
+
+func printSnapshotDBs(snap *snapshot.Snapshot) {
+	if output.isJSON() {
+		return
+	}
+	for _, db := range snap.DBs {
+		fmt.Printf("  %s (%d files linked, %d files copied)\n", db.Path, db.NumLinked, db.NumCopied)
+	}
+}
+
+func newSnapshotCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "snapshot",
+		Short: "Snapshots of LevelDB directories, taken before the DBs are modified in place",
+	}
+	cmd.AddCommand(
+		newCreateSnapshotCommand(),
+		newRestoreSnapshotCommand(),
+		newListSnapshotsCommand(),
+	)
+	return cmd
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+func TestWithBackupRestoresOnPanic(t *testing.T) {
+	defer resetOutput(outputText)()
+	dbPath := "./tempWithBackup.db"
+	backupDir := "./tempWithBackupSnapshots"
+	_ = os.RemoveAll(dbPath)
+	defer os.RemoveAll(dbPath)
+	_ = os.RemoveAll(backupDir)
+	defer os.RemoveAll(backupDir)
+
+	ldb, err := leveldb.OpenFile(dbPath, nil)
+	require.NoError(t, err)
+	require.NoError(t, ldb.Put([]byte("key"), []byte("before"), nil))
+	require.NoError(t, ldb.Close())
+
+	err = withBackup(backupDir, "test", []string{dbPath}, func() error {
+		ldb, err := leveldb.OpenFile(dbPath, nil)
+		require.NoError(t, err)
+		defer ldb.Close()
+		require.NoError(t, ldb.Put([]byte("key"), []byte("after"), nil))
+		panic("failed to open the other DB")
+	})
+	require.EqualError(t, err, "panic: failed to open the other DB")
+	require.Equal(t, true, output.Result["restored"])
+
+	ldb, err = leveldb.OpenFile(dbPath, nil)
+	require.NoError(t, err)
+	defer ldb.Close()
+	value, err := ldb.Get([]byte("key"), nil)
+	require.NoError(t, err)
+	require.Equal(t, []byte("before"), value)
+}
@@ -0,0 +1,175 @@
+package compact
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"math/big"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// CompactionStats describes a compaction done by CompactDB.
+type CompactionStats struct {
+	// Number of chunks the key range was split into, and the number that were compacted.
+	NumChunks    int           `json:"numChunks"`
+	NumCompacted int           `json:"numCompacted"`
+	Interrupted  bool          `json:"interrupted"`
+	TimeTaken    time.Duration `json:"timeTaken"`
+}
+
+// CompactDB compacts the keys from start (inclusive) to limit (exclusive) in the LevelDB at
+// dbPath, a nil start or limit means the range isn't bounded on that side. The range is split into
+// numChunks chunks that are compacted one at a time, if interrupt is closed the compaction stops
+// once the current chunk is done. Stopping part way through leaves the DB consistent, the
+// remaining chunks just aren't compacted.
+func CompactDB(dbPath string, start, limit []byte, numChunks int, interrupt <-chan struct{}) (*CompactionStats, error) {
+	ldb, err := leveldb.OpenFile(dbPath, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open %s", dbPath)
+	}
+	defer ldb.Close()
+
+	startTime := time.Now()
+	chunks := SplitRange(ldb, start, limit, numChunks)
+	stats := &CompactionStats{NumChunks: len(chunks)}
+	for i, chunk := range chunks {
+		select {
+		case <-interrupt:
+			stats.Interrupted = true
+			stats.TimeTaken = time.Since(startTime)
+			return stats, nil
+		default:
+		}
+		chunkStart := time.Now()
+		if err := ldb.CompactRange(chunk); err != nil {
+			return nil, errors.Wrapf(err, "failed to compact %s", dbPath)
+		}
+		stats.NumCompacted++
+		log.Printf("compacted chunk %d of %d in %v\n", i+1, len(chunks), time.Since(chunkStart))
+	}
+	stats.TimeTaken = time.Since(startTime)
+	return stats, nil
+}
+
+// SplitRange splits the keys from start to limit in the DB into at most n chunks. The split keys
+// are interpolated between the first & last key in the range, so the chunks only contain a similar
+// number of keys if the keys are evenly distributed, which is a lot cheaper than walking the whole
+// range to find better split keys. If there are no live keys in the range (e.g. they've all just
+// been deleted) the whole range is returned as a single chunk, since it may still hold the deleted
+// keys.
+func SplitRange(ldb *leveldb.DB, start, limit []byte, n int) []util.Range {
+	it := ldb.NewIterator(&util.Range{Start: start, Limit: limit}, nil)
+	defer it.Release()
+	if !it.First() {
+		return []util.Range{{Start: start, Limit: limit}}
+	}
+	first := append([]byte(nil), it.Key()...)
+	it.Last()
+	last := append([]byte(nil), it.Key()...)
+	if n <= 1 || bytes.Equal(first, last) {
+		return []util.Range{{Start: start, Limit: limit}}
+	}
+
+	// Interpolate over the 8 bytes that follow the prefix shared by the first & last keys.
+	prefixLen := 0
+	for prefixLen < len(first) && prefixLen < len(last) && first[prefixLen] == last[prefixLen] {
+		prefixLen++
+	}
+	prefix := first[:prefixLen]
+	from := new(big.Int).SetUint64(keyUint64(first[prefixLen:]))
+	to := new(big.Int).SetUint64(keyUint64(last[prefixLen:]))
+	span := new(big.Int).Sub(to, from)
+
+	chunks := []util.Range{}
+	chunkStart := start
+	for i := 1; i < n; i++ {
+		offset := new(big.Int).Mul(span, big.NewInt(int64(i)))
+		offset.Div(offset, big.NewInt(int64(n)))
+		splitKey := make([]byte, prefixLen+8)
+		copy(splitKey, prefix)
+		binary.BigEndian.PutUint64(splitKey[prefixLen:], offset.Add(offset, from).Uint64())
+		// skip split keys that would produce empty or out of order chunks
+		if bytes.Compare(splitKey, first) <= 0 || (chunkStart != nil && bytes.Compare(splitKey, chunkStart) <= 0) {
+			continue
+		}
+		chunks = append(chunks, util.Range{Start: chunkStart, Limit: splitKey})
+		chunkStart = splitKey
+	}
+	return append(chunks, util.Range{Start: chunkStart, Limit: limit})
+}
+
+// keyUint64 returns the first 8 bytes of the key as a big-endian integer, shorter keys are padded
+// with zeros.
+func keyUint64(key []byte) uint64 {
+	buf := make([]byte, 8)
+	copy(buf, key)
+	return binary.BigEndian.Uint64(buf)
+}
+
+// ParseRange parses a key range of the form start:end, either of which may be empty to leave that
+// side of the range unbounded. Keys may contain the escape sequences \xHH, \\ and \: (for a colon
+// that's part of a key).
+func ParseRange(s string) (start, limit []byte, err error) {
+	sep := -1
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' {
+			i++
+		} else if s[i] == ':' {
+			sep = i
+			break
+		}
+	}
+	if sep == -1 {
+		return nil, nil, fmt.Errorf("invalid range '%s', expected start:end", s)
+	}
+	if start, err = unescapeKey(s[:sep]); err != nil {
+		return nil, nil, err
+	}
+	if limit, err = unescapeKey(s[sep+1:]); err != nil {
+		return nil, nil, err
+	}
+	if start != nil && limit != nil && bytes.Compare(start, limit) >= 0 {
+		return nil, nil, fmt.Errorf("invalid range '%s', the start must be before the end", s)
+	}
+	return start, limit, nil
+}
+
+func unescapeKey(s string) ([]byte, error) {
+	if len(s) == 0 {
+		return nil, nil
+	}
+	var key []byte
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			key = append(key, s[i])
+			continue
+		}
+		if i+1 >= len(s) {
+			return nil, fmt.Errorf("invalid escape sequence at the end of '%s'", s)
+		}
+		i++
+		switch s[i] {
+		case '\\', ':':
+			key = append(key, s[i])
+		case 'x':
+			if i+3 > len(s) {
+				return nil, fmt.Errorf("invalid escape sequence in '%s'", s)
+			}
+			b, err := hex.DecodeString(s[i+1 : i+3])
+			if err != nil {
+				return nil, fmt.Errorf("invalid escape sequence in '%s'", s)
+			}
+			key = append(key, b...)
+			i += 2
+		default:
+			return nil, fmt.Errorf("invalid escape sequence \\%c in '%s'", s[i], s)
+		}
+	}
+	return key, nil
+}
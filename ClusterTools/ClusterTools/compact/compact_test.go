@@ -0,0 +1,154 @@
+package compact
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+func makeTestDB(t *testing.T, dbPath string, numKeys int) {
+	_ = os.RemoveAll(dbPath)
+	ldb, err := leveldb.OpenFile(dbPath, nil)
+	require.NoError(t, err)
+	defer ldb.Close()
+	for i := 0; i < numKeys; i++ {
+		require.NoError(t, ldb.Put([]byte(fmt.Sprintf("key%06d", i)), []byte(fmt.Sprintf("value%d", i)), nil))
+	}
+}
+
+func countKeys(t *testing.T, ldb *leveldb.DB, r *util.Range) int {
+	it := ldb.NewIterator(r, nil)
+	defer it.Release()
+	n := 0
+	for it.Next() {
+		n++
+	}
+	require.NoError(t, it.Error())
+	return n
+}
+
+func TestParseRange(t *testing.T) {
+	start, limit, err := ParseRange("H\\:1:H\\:9")
+	require.NoError(t, err)
+	require.Equal(t, []byte("H:1"), start)
+	require.Equal(t, []byte("H:9"), limit)
+
+	start, limit, err = ParseRange("\\x00\\xff:")
+	require.NoError(t, err)
+	require.Equal(t, []byte{0, 255}, start)
+	require.Nil(t, limit)
+
+	start, limit, err = ParseRange(":vm")
+	require.NoError(t, err)
+	require.Nil(t, start)
+	require.Equal(t, []byte("vm"), limit)
+
+	_, _, err = ParseRange("vm")
+	require.Error(t, err)
+	_, _, err = ParseRange("b:a")
+	require.Error(t, err)
+	_, _, err = ParseRange("\\xzz:")
+	require.Error(t, err)
+}
+
+func TestSplitRange(t *testing.T) {
+	dbPath := "./tempSplitRange.db"
+	makeTestDB(t, dbPath, 1000)
+	defer os.RemoveAll(dbPath)
+	ldb, err := leveldb.OpenFile(dbPath, nil)
+	require.NoError(t, err)
+	defer ldb.Close()
+
+	for _, r := range []util.Range{{}, {Start: []byte("key000100"), Limit: []byte("key000200")}} {
+		numKeys := countKeys(t, ldb, &r)
+		chunks := SplitRange(ldb, r.Start, r.Limit, 10)
+		require.True(t, len(chunks) > 1)
+		require.Equal(t, r.Start, chunks[0].Start)
+		require.Equal(t, r.Limit, chunks[len(chunks)-1].Limit)
+		total := 0
+		for i, chunk := range chunks {
+			if i > 0 {
+				require.Equal(t, chunks[i-1].Limit, chunk.Start)
+			}
+			n := countKeys(t, ldb, &chunk)
+			require.True(t, n > 0)
+			total += n
+		}
+		require.Equal(t, numKeys, total)
+	}
+
+	require.Equal(t, 1, len(SplitRange(ldb, nil, nil, 1)))
+	// there are no keys in the range, but it may still need compacting
+	require.Equal(t, []util.Range{{Start: []byte("x")}}, SplitRange(ldb, []byte("x"), nil, 10))
+}
+
+func TestCompactDB(t *testing.T) {
+	dbPath := "./tempCompact.db"
+	makeTestDB(t, dbPath, 1000)
+	defer os.RemoveAll(dbPath)
+
+	interrupt := make(chan struct{})
+	close(interrupt)
+	stats, err := CompactDB(dbPath, nil, nil, 4, interrupt)
+	require.NoError(t, err)
+	require.True(t, stats.Interrupted)
+	require.Equal(t, 0, stats.NumCompacted)
+
+	stats, err = CompactDB(dbPath, nil, nil, 4, nil)
+	require.NoError(t, err)
+	require.False(t, stats.Interrupted)
+	require.Equal(t, stats.NumChunks, stats.NumCompacted)
+
+	ldb, err := leveldb.OpenFile(dbPath, nil)
+	require.NoError(t, err)
+	defer ldb.Close()
+	require.Equal(t, 1000, countKeys(t, ldb, nil))
+}
+
+func dirSize(t *testing.T, dir string) int64 {
+	var size int64
+	require.NoError(t, filepath.Walk(dir, func(_ string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			size += info.Size()
+		}
+		return err
+	}))
+	return size
+}
+
+func TestCompactDeletedRange(t *testing.T) {
+	dbPath := "./tempCompactDeleted.db"
+	_ = os.RemoveAll(dbPath)
+	defer os.RemoveAll(dbPath)
+
+	ldb, err := leveldb.OpenFile(dbPath, nil)
+	require.NoError(t, err)
+	value := make([]byte, 1024)
+	for i := 0; i < 2000; i++ {
+		require.NoError(t, ldb.Put([]byte(fmt.Sprintf("key%06d", i)), value, nil))
+	}
+	require.NoError(t, ldb.CompactRange(util.Range{}))
+	for i := 0; i < 1900; i++ {
+		require.NoError(t, ldb.Delete([]byte(fmt.Sprintf("key%06d", i)), nil))
+	}
+	require.NoError(t, ldb.Close())
+	sizeBefore := dirSize(t, dbPath)
+
+	// all the keys in the range have been deleted, so it's compacted as a single chunk
+	stats, err := CompactDB(dbPath, []byte("key000000"), []byte("key001900"), 10, nil)
+	require.NoError(t, err)
+	require.Equal(t, 1, stats.NumChunks)
+	require.Equal(t, 1, stats.NumCompacted)
+	sizeAfter := dirSize(t, dbPath)
+	require.True(t, sizeAfter < sizeBefore/2, "%d bytes before, %d after", sizeBefore, sizeAfter)
+
+	ldb, err = leveldb.OpenFile(dbPath, nil)
+	require.NoError(t, err)
+	defer ldb.Close()
+	require.Equal(t, 100, countKeys(t, ldb, nil))
+}
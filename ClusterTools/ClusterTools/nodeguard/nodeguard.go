@@ -0,0 +1,193 @@
+package nodeguard
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+	"github.com/syndtr/goleveldb/leveldb/storage"
+	"github.com/tendermint/tendermint/config"
+)
+
+// How long to wait for a connection to the node's RPC server.
+const rpcDialTimeout = time.Second
+
+// NodeRunningError is returned by Check when there are signs a node is still using the DBs.
+type NodeRunningError struct {
+	Reasons []string
+	// The flag that skips the check, --force by default.
+	SkipFlag string
+}
+
+func (e *NodeRunningError) Error() string {
+	skipFlag := e.SkipFlag
+	if len(skipFlag) == 0 {
+		skipFlag = "--force"
+	}
+	return fmt.Sprintf(
+		"the node appears to be running (%s), stop the node first or use %s to skip this check",
+		strings.Join(e.Reasons, "; "), skipFlag,
+	)
+}
+
+// Check looks for signs that a node is running before its DBs are modified. It returns a
+// NodeRunningError if any of the given LevelDB directories is locked by another process, the
+// process in pidFile is alive, or something is listening on rpcAddress. pidFile & rpcAddress are
+// skipped if they're empty.
+func Check(dbPaths []string, pidFile, rpcAddress string) error {
+	var reasons []string
+	for _, dbPath := range dbPaths {
+		locked, err := IsDBLocked(dbPath)
+		if err != nil {
+			return err
+		}
+		if locked {
+			reasons = append(reasons, fmt.Sprintf("%s is locked by another process", dbPath))
+		}
+	}
+	if len(pidFile) > 0 {
+		pid, alive, err := IsProcessAlive(pidFile)
+		if err != nil {
+			return err
+		}
+		if alive {
+			reasons = append(reasons, fmt.Sprintf("process %d from %s is alive", pid, pidFile))
+		}
+	}
+	if len(rpcAddress) > 0 {
+		listening, err := IsListening(rpcAddress)
+		if err != nil {
+			return err
+		}
+		if listening {
+			reasons = append(reasons, fmt.Sprintf("RPC server is listening on %s", rpcAddress))
+		}
+	}
+	if len(reasons) > 0 {
+		return &NodeRunningError{Reasons: reasons}
+	}
+	return nil
+}
+
+// CheckDBs is like Check, but reads the RPC listen address from config/config.toml in the node's
+// chaindata directory. The RPC check is skipped if chainDataDir is empty or has no config.toml.
+func CheckDBs(dbPaths []string, pidFile, chainDataDir string) error {
+	var rpcAddress string
+	if len(chainDataDir) > 0 {
+		var err error
+		if rpcAddress, err = RPCAddress(chainDataDir); err != nil {
+			return err
+		}
+	}
+	return Check(dbPaths, pidFile, rpcAddress)
+}
+
+// RPCAddress returns the RPC listen address from config/config.toml in the node's chaindata
+// directory, or an empty string if there's no config.toml.
+func RPCAddress(chainDataDir string) (string, error) {
+	configPath := filepath.Join(chainDataDir, "config", "config.toml")
+	if _, err := os.Stat(configPath); os.IsNotExist(err) {
+		return "", nil
+	} else if err != nil {
+		return "", errors.Wrapf(err, "failed to access %s", configPath)
+	}
+	v := viper.New()
+	v.AutomaticEnv()
+	v.SetEnvPrefix("TM")
+	v.SetConfigFile(configPath)
+	if err := v.ReadInConfig(); err != nil {
+		return "", errors.Wrapf(err, "failed to load %s", configPath)
+	}
+	conf := config.DefaultConfig()
+	if err := v.Unmarshal(conf); err != nil {
+		return "", errors.Wrapf(err, "failed to load %s", configPath)
+	}
+	return conf.RPC.ListenAddress, nil
+}
+
+// IsDBLocked checks if the LevelDB in the given directory is held open by another process (or by
+// this one). A DB that doesn't exist isn't locked.
+func IsDBLocked(dbPath string) (bool, error) {
+	if _, err := os.Stat(filepath.Join(dbPath, "LOCK")); os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, errors.Wrapf(err, "failed to access %s", dbPath)
+	}
+	// A read-only open takes a shared lock, which fails while a writer holds the exclusive lock,
+	// and doesn't create or modify anything in the directory.
+	stor, err := storage.OpenFile(dbPath, true)
+	if err != nil {
+		if err == syscall.EWOULDBLOCK || err == syscall.EAGAIN {
+			return true, nil
+		}
+		return false, errors.Wrapf(err, "failed to check lock on %s", dbPath)
+	}
+	stor.Close()
+	return false, nil
+}
+
+// IsProcessAlive checks if the process whose PID is stored in pidFile is still running. A PID file
+// that doesn't exist means the process isn't running.
+func IsProcessAlive(pidFile string) (int, bool, error) {
+	buf, err := ioutil.ReadFile(pidFile)
+	if os.IsNotExist(err) {
+		return 0, false, nil
+	} else if err != nil {
+		return 0, false, errors.Wrapf(err, "failed to read PID file %s", pidFile)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(buf)))
+	if err != nil || pid <= 0 {
+		return 0, false, errors.Errorf("invalid PID file %s", pidFile)
+	}
+	proc, err := os.FindProcess(pid)
+	if err != nil {
+		return pid, false, nil
+	}
+	// Signal 0 only checks if the process exists, EPERM means it belongs to another user.
+	err = proc.Signal(syscall.Signal(0))
+	return pid, err == nil || err == syscall.EPERM, nil
+}
+
+// IsListening checks if something accepts connections on the given Tendermint listen address,
+// e.g. tcp://0.0.0.0:46657 or unix:///path/to/socket.
+func IsListening(address string) (bool, error) {
+	network, addr := "tcp", address
+	if strings.Contains(address, "://") {
+		u, err := url.Parse(address)
+		if err != nil {
+			return false, errors.Wrapf(err, "invalid listen address %s", address)
+		}
+		network = u.Scheme
+		if network == "unix" {
+			addr = u.Host + u.Path
+		} else {
+			addr = u.Host
+		}
+	}
+	if network != "unix" {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return false, errors.Wrapf(err, "invalid listen address %s", address)
+		}
+		// the node listens on all interfaces, so it should be reachable on localhost
+		if host == "" || host == "0.0.0.0" || host == "::" {
+			host = "127.0.0.1"
+		}
+		addr = net.JoinHostPort(host, port)
+	}
+	conn, err := net.DialTimeout(network, addr, rpcDialTimeout)
+	if err != nil {
+		return false, nil
+	}
+	conn.Close()
+	return true, nil
+}
@@ -0,0 +1,99 @@
+package nodeguard
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+func TestCheckDBLock(t *testing.T) {
+	dbPath := "./tempLocked.db"
+	_ = os.RemoveAll(dbPath)
+	defer os.RemoveAll(dbPath)
+
+	// a DB that doesn't exist isn't locked
+	require.NoError(t, Check([]string{dbPath}, "", ""))
+
+	ldb, err := leveldb.OpenFile(dbPath, nil)
+	require.NoError(t, err)
+	err = Check([]string{dbPath}, "", "")
+	require.Error(t, err)
+	require.IsType(t, &NodeRunningError{}, err)
+	require.Contains(t, err.Error(), "--force")
+
+	require.NoError(t, ldb.Close())
+	require.NoError(t, Check([]string{dbPath}, "", ""))
+}
+
+func TestCheckPIDFile(t *testing.T) {
+	pidFile := "./tempNode.pid"
+	defer os.Remove(pidFile)
+
+	// a missing PID file means the node isn't running
+	_ = os.Remove(pidFile)
+	require.NoError(t, Check(nil, pidFile, ""))
+
+	require.NoError(t, ioutil.WriteFile(pidFile, []byte(fmt.Sprintf("%d\n", os.Getpid())), 0644))
+	err := Check(nil, pidFile, "")
+	require.IsType(t, &NodeRunningError{}, err)
+
+	require.NoError(t, ioutil.WriteFile(pidFile, []byte("not-a-pid"), 0644))
+	err = Check(nil, pidFile, "")
+	require.Error(t, err)
+	require.False(t, isNodeRunningError(err))
+}
+
+func TestCheckRPCAddress(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := ln.Addr().(*net.TCPAddr).Port
+
+	err = Check(nil, "", fmt.Sprintf("tcp://0.0.0.0:%d", port))
+	require.IsType(t, &NodeRunningError{}, err)
+	err = Check(nil, "", fmt.Sprintf("127.0.0.1:%d", port))
+	require.IsType(t, &NodeRunningError{}, err)
+
+	require.NoError(t, ln.Close())
+	require.NoError(t, Check(nil, "", fmt.Sprintf("tcp://0.0.0.0:%d", port)))
+}
+
+func TestCheckDBsRPCAddressFromConfig(t *testing.T) {
+	chainDataDir := "./tempChainData"
+	_ = os.RemoveAll(chainDataDir)
+	defer os.RemoveAll(chainDataDir)
+
+	// no config.toml, so the RPC address isn't checked
+	require.NoError(t, CheckDBs(nil, "", chainDataDir))
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	require.NoError(t, os.MkdirAll(filepath.Join(chainDataDir, "config"), 0755))
+	require.NoError(t, ioutil.WriteFile(
+		filepath.Join(chainDataDir, "config", "config.toml"),
+		[]byte(fmt.Sprintf("[rpc]\nladdr = \"tcp://0.0.0.0:%d\"\n", ln.Addr().(*net.TCPAddr).Port)),
+		0644,
+	))
+	err = CheckDBs(nil, "", chainDataDir)
+	require.IsType(t, &NodeRunningError{}, err)
+	require.Contains(t, err.Error(), "RPC server")
+	require.Contains(t, err.Error(), "--force")
+
+	err.(*NodeRunningError).SkipFlag = "--skip-node-check"
+	require.Contains(t, err.Error(), "--skip-node-check")
+	require.NotContains(t, err.Error(), "--force")
+
+	// an empty chaindata dir skips the RPC check
+	require.NoError(t, CheckDBs(nil, "", ""))
+}
+
+func isNodeRunningError(err error) bool {
+	_, ok := err.(*NodeRunningError)
+	return ok
+}
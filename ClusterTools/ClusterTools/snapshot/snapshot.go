@@ -0,0 +1,258 @@
+package snapshot
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/dappchain/clusterkit/nodeguard"
+)
+
+// Name of the file in each snapshot directory that describes the snapshot.
+const manifestFile = "snapshot.json"
+
+// DB describes a LevelDB directory stored in a snapshot.
+type DB struct {
+	// Absolute path the DB was copied from, and is restored to.
+	Path string `json:"path"`
+	// Name of the directory the DB is stored in within the snapshot.
+	Name string `json:"name"`
+	// Number of table files hardlinked to the original, and the number & total size of the other
+	// files, which had to be copied.
+	NumLinked int   `json:"numLinked"`
+	NumCopied int   `json:"numCopied"`
+	NumBytes  int64 `json:"numBytes"`
+}
+
+// Snapshot is a consistent copy of one or more LevelDB directories, taken before they're modified.
+type Snapshot struct {
+	ID        string    `json:"id"`
+	Label     string    `json:"label"`
+	CreatedAt time.Time `json:"createdAt"`
+	DBs       []DB      `json:"dbs"`
+	// Directory the snapshot is stored in.
+	Dir string `json:"-"`
+}
+
+// Create takes a snapshot of the given LevelDB directories and stores it in a new directory in
+// backupDir. The DBs must not be open. LevelDB never modifies a table file once it's been written,
+// so the table files are hardlinked rather than copied where possible, which means a snapshot only
+// takes up extra space once the original DBs are modified.
+func Create(backupDir, label string, dbPaths []string) (*Snapshot, error) {
+	if len(dbPaths) == 0 {
+		return nil, errors.New("no DBs to snapshot")
+	}
+	snap := &Snapshot{
+		Label:     label,
+		CreatedAt: time.Now().UTC(),
+	}
+	snap.ID = snap.CreatedAt.Format("20060102-150405.000")
+	if len(label) > 0 {
+		snap.ID += "-" + label
+	}
+	snap.Dir = filepath.Join(backupDir, snap.ID)
+	if _, err := os.Stat(snap.Dir); !os.IsNotExist(err) {
+		return nil, fmt.Errorf("snapshot %s already exists", snap.Dir)
+	}
+
+	names := map[string]bool{}
+	for _, dbPath := range dbPaths {
+		absPath, err := filepath.Abs(dbPath)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to resolve DB path %s", dbPath)
+		}
+		if info, err := os.Stat(absPath); err != nil || !info.IsDir() {
+			return nil, fmt.Errorf("DB cannot be found at '%s'", absPath)
+		}
+		locked, err := nodeguard.IsDBLocked(absPath)
+		if err != nil {
+			return nil, err
+		}
+		if locked {
+			return nil, fmt.Errorf("can't snapshot %s while it's open", absPath)
+		}
+		name := filepath.Base(absPath)
+		for i := 1; names[name]; i++ {
+			name = fmt.Sprintf("%s-%d", filepath.Base(absPath), i)
+		}
+		names[name] = true
+		snap.DBs = append(snap.DBs, DB{Path: absPath, Name: name})
+	}
+
+	for i := range snap.DBs {
+		db := &snap.DBs[i]
+		var err error
+		db.NumLinked, db.NumCopied, db.NumBytes, err = copyDB(db.Path, filepath.Join(snap.Dir, db.Name))
+		if err != nil {
+			os.RemoveAll(snap.Dir)
+			return nil, errors.Wrapf(err, "failed to snapshot %s", db.Path)
+		}
+	}
+	buf, err := json.MarshalIndent(snap, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(filepath.Join(snap.Dir, manifestFile), buf, 0644); err != nil {
+		os.RemoveAll(snap.Dir)
+		return nil, errors.Wrap(err, "failed to write snapshot manifest")
+	}
+	return snap, nil
+}
+
+// Load reads the snapshot stored in snapshotDir.
+func Load(snapshotDir string) (*Snapshot, error) {
+	buf, err := ioutil.ReadFile(filepath.Join(snapshotDir, manifestFile))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to load snapshot %s", snapshotDir)
+	}
+	snap := &Snapshot{}
+	if err := json.Unmarshal(buf, snap); err != nil {
+		return nil, errors.Wrapf(err, "invalid snapshot manifest in %s", snapshotDir)
+	}
+	snap.Dir = snapshotDir
+	return snap, nil
+}
+
+// List returns the snapshots stored in backupDir, oldest first.
+func List(backupDir string) ([]*Snapshot, error) {
+	entries, err := ioutil.ReadDir(backupDir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read %s", backupDir)
+	}
+	var snaps []*Snapshot
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		dir := filepath.Join(backupDir, entry.Name())
+		if _, err := os.Stat(filepath.Join(dir, manifestFile)); err != nil {
+			// not a snapshot, or one that wasn't completed
+			continue
+		}
+		snap, err := Load(dir)
+		if err != nil {
+			return nil, err
+		}
+		snaps = append(snaps, snap)
+	}
+	sort.Slice(snaps, func(i, j int) bool {
+		return snaps[i].CreatedAt.Before(snaps[j].CreatedAt)
+	})
+	return snaps, nil
+}
+
+// Restore replaces the DBs in the snapshot stored in snapshotDir with the copies in the snapshot.
+// None of the DBs may be open. The snapshot itself is left intact so it can be restored again.
+func Restore(snapshotDir string) (*Snapshot, error) {
+	snap, err := Load(snapshotDir)
+	if err != nil {
+		return nil, err
+	}
+	for _, db := range snap.DBs {
+		locked, err := nodeguard.IsDBLocked(db.Path)
+		if err != nil {
+			return nil, err
+		}
+		if locked {
+			return nil, fmt.Errorf("can't restore %s while it's open", db.Path)
+		}
+	}
+	// Copy all the DBs next to the originals first, so there's less chance of only some of the DBs
+	// being restored if something goes wrong.
+	for _, db := range snap.DBs {
+		tmpPath := db.Path + ".restore"
+		if err := os.RemoveAll(tmpPath); err != nil {
+			return nil, err
+		}
+		if _, _, _, err := copyDB(filepath.Join(snap.Dir, db.Name), tmpPath); err != nil {
+			os.RemoveAll(tmpPath)
+			return nil, errors.Wrapf(err, "failed to restore %s", db.Path)
+		}
+	}
+	// Move each original aside before the restored copy takes its place, so there's always a
+	// complete copy of the DB on disk, and only delete the original once it's been replaced.
+	for _, db := range snap.DBs {
+		oldPath := db.Path + ".old"
+		if err := os.RemoveAll(oldPath); err != nil {
+			return nil, err
+		}
+		if err := os.Rename(db.Path, oldPath); err != nil && !os.IsNotExist(err) {
+			return nil, errors.Wrapf(err, "failed to move %s aside", db.Path)
+		}
+		if err := os.Rename(db.Path+".restore", db.Path); err != nil {
+			if _, statErr := os.Stat(oldPath); statErr == nil {
+				os.Rename(oldPath, db.Path)
+			}
+			return nil, errors.Wrapf(err, "failed to restore %s", db.Path)
+		}
+		if err := os.RemoveAll(oldPath); err != nil {
+			return nil, errors.Wrapf(err, "failed to remove the original %s", db.Path)
+		}
+	}
+	return snap, nil
+}
+
+// isTableFile checks if the given file is a LevelDB table file, which is never modified once
+// it's written.
+func isTableFile(name string) bool {
+	return strings.HasSuffix(name, ".ldb") || strings.HasSuffix(name, ".sst")
+}
+
+// copyDB copies the files of the LevelDB in srcDir to destDir, table files are hardlinked if
+// possible. The LOCK file is skipped, LevelDB creates it when the DB is opened.
+func copyDB(srcDir, destDir string) (numLinked, numCopied int, numBytes int64, err error) {
+	entries, err := ioutil.ReadDir(srcDir)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		return 0, 0, 0, err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || entry.Name() == "LOCK" {
+			continue
+		}
+		src := filepath.Join(srcDir, entry.Name())
+		dest := filepath.Join(destDir, entry.Name())
+		// linking fails if the destination is on another filesystem, fall back to copying then
+		if isTableFile(entry.Name()) && os.Link(src, dest) == nil {
+			numLinked++
+			continue
+		}
+		n, err := copyFile(src, dest)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		numCopied++
+		numBytes += n
+	}
+	return numLinked, numCopied, numBytes, nil
+}
+
+func copyFile(src, dest string) (int64, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return 0, err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(out, in)
+	if err == nil {
+		err = out.Sync()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	return n, err
+}
@@ -0,0 +1,93 @@
+package snapshot
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+func writeTestDB(t *testing.T, dbPath string, from, to int) {
+	ldb, err := leveldb.OpenFile(dbPath, nil)
+	require.NoError(t, err)
+	for i := from; i < to; i++ {
+		require.NoError(t, ldb.Put([]byte(fmt.Sprintf("key%06d", i)), []byte(fmt.Sprintf("value%d", i)), nil))
+	}
+	// flush the memtable to a table file
+	require.NoError(t, ldb.CompactRange(util.Range{}))
+	require.NoError(t, ldb.Close())
+}
+
+func readTestDB(t *testing.T, dbPath string) map[string]string {
+	ldb, err := leveldb.OpenFile(dbPath, nil)
+	require.NoError(t, err)
+	defer ldb.Close()
+	kvs := map[string]string{}
+	it := ldb.NewIterator(nil, nil)
+	defer it.Release()
+	for it.Next() {
+		kvs[string(it.Key())] = string(it.Value())
+	}
+	require.NoError(t, it.Error())
+	return kvs
+}
+
+func TestSnapshotCreateRestore(t *testing.T) {
+	dbDir := "./tempSnapshotDBs"
+	backupDir := "./tempSnapshots"
+	_ = os.RemoveAll(dbDir)
+	_ = os.RemoveAll(backupDir)
+	defer os.RemoveAll(dbDir)
+	defer os.RemoveAll(backupDir)
+
+	aPath := filepath.Join(dbDir, "a.db")
+	bPath := filepath.Join(dbDir, "b.db")
+	writeTestDB(t, aPath, 0, 1000)
+	writeTestDB(t, bPath, 0, 10)
+	expectedA := readTestDB(t, aPath)
+	expectedB := readTestDB(t, bPath)
+
+	// open DBs can't be snapshotted
+	ldb, err := leveldb.OpenFile(aPath, nil)
+	require.NoError(t, err)
+	_, err = Create(backupDir, "test", []string{aPath, bPath})
+	require.Error(t, err)
+	require.NoError(t, ldb.Close())
+
+	snap, err := Create(backupDir, "test", []string{aPath, bPath})
+	require.NoError(t, err)
+	require.Equal(t, 2, len(snap.DBs))
+	require.True(t, snap.DBs[0].NumLinked > 0)
+
+	// modify the DBs, including the table files, then restore them
+	writeTestDB(t, aPath, 500, 2000)
+	require.NoError(t, os.RemoveAll(bPath))
+	require.Equal(t, 2000, len(readTestDB(t, aPath)))
+
+	snaps, err := List(backupDir)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(snaps))
+	require.Equal(t, snap.ID, snaps[0].ID)
+
+	_, err = Restore(snaps[0].Dir)
+	require.NoError(t, err)
+	require.Equal(t, expectedA, readTestDB(t, aPath))
+	require.Equal(t, expectedB, readTestDB(t, bPath))
+	// the originals and the copies made while restoring are cleaned up
+	for _, path := range []string{aPath, bPath} {
+		for _, suffix := range []string{".old", ".restore"} {
+			_, err := os.Stat(path + suffix)
+			require.True(t, os.IsNotExist(err))
+		}
+	}
+
+	// the snapshot can be restored again after the restored DBs are modified
+	writeTestDB(t, aPath, 0, 2000)
+	_, err = Restore(snap.Dir)
+	require.NoError(t, err)
+	require.Equal(t, expectedA, readTestDB(t, aPath))
+}